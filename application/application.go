@@ -1,13 +1,52 @@
 package application
 
 import (
+	"newdemo1/application/bulk"
+	"newdemo1/application/calendar"
+	"newdemo1/application/deadletter"
+	"newdemo1/application/event"
+	"newdemo1/application/outbox"
+	"newdemo1/application/reconciler"
+	"newdemo1/application/run"
+	"newdemo1/application/scheduler"
+	"newdemo1/application/subscription"
 	"newdemo1/infrastructure"
 	"newdemo1/resource"
 )
 
 type Application struct {
+	Subscription subscription.Service
+	Scheduler    scheduler.Scheduler
+	Event        event.Service
+	Outbox       outbox.Relay
+	Reconciler   reconciler.Reconciler
+	DeadLetter   deadletter.Service
+	Runs         *run.Broadcaster
+	Ledger       run.Service
+	Calendar     calendar.Service
+	Bulk         bulk.Service
 }
 
 func NewApplication(resource *resource.Resource, infrastructure *infrastructure.Infrastructure) (*Application, error) {
-	return &Application{}, nil
+	calendars, err := calendar.NewService(resource, infrastructure, subscription.NewRescheduler(resource))
+	if err != nil {
+		return nil, err
+	}
+	runs := run.NewBroadcaster()
+	if channel := resource.Config.Runs.Channel; channel != "" {
+		runs = run.NewRelayedBroadcaster(infrastructure.Fanout, channel, resource.Log)
+	}
+	subscriptions := subscription.NewService(resource, infrastructure, calendars)
+	return &Application{
+		Subscription: subscriptions,
+		Scheduler:    scheduler.NewScheduler(resource, infrastructure, runs, calendars),
+		Event:        event.NewService(resource, infrastructure, runs),
+		Outbox:       outbox.NewRelay(resource, infrastructure),
+		Reconciler:   reconciler.NewReconciler(resource, infrastructure, runs),
+		DeadLetter:   deadletter.NewService(resource, infrastructure),
+		Runs:         runs,
+		Ledger:       run.NewService(resource, infrastructure),
+		Calendar:     calendars,
+		Bulk:         bulk.NewService(resource, infrastructure, subscriptions),
+	}, nil
 }
@@ -0,0 +1,316 @@
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"newdemo1/application/subscription"
+	"newdemo1/constant"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/resource"
+	commonErr "newdemo1/resource/jaeger/common/error"
+	"newdemo1/resource/jaeger/common/tracer"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+
+	ActionCreate = "create"
+	ActionUpdate = "update"
+
+	exportBatchSize = 500
+)
+
+type (
+	// Service moves subscriptions in and out in batches, a row at a time. A row
+	// has the fields of subscription.CreateRequest under their JSON names, which
+	// are also the CSV column names; the retry policy is only carried by JSON Lines.
+	// An imported subscription was charged elsewhere until now: it starts at
+	// its first occurrence after lastRunAt, or after now when that is later.
+	Service interface {
+		// Import creates a subscription per row, or with Upsert updates the one
+		// with the same external reference, and passes every row result to
+		// report as soon as it is known. A failing row does not stop the import.
+		// DryRun validates the rows and reports what would be done without saving.
+		Import(ctx context.Context, r io.Reader, req ImportRequest, report func(RowResult) error) (Summary, error)
+		// Export streams the subscriptions matching req to w and returns how many were written.
+		Export(ctx context.Context, w io.Writer, req ExportRequest) (int64, error)
+	}
+	service struct {
+		resource      *resource.Resource
+		repo          *repository.Repository
+		subscriptions subscription.Service
+	}
+
+	ImportRequest struct {
+		Format string `form:"format" validate:"required,oneof=csv jsonl"`
+		DryRun bool   `form:"dryRun"`
+		Upsert bool   `form:"upsert"`
+	}
+	ExportRequest struct {
+		Format  string `form:"format" validate:"required,oneof=csv jsonl"`
+		OwnerID string `form:"ownerId" validate:"max=64"`
+		Status  string `form:"status" validate:"omitempty,oneof=active paused cancelled completed expired"`
+	}
+
+	// RowResult tells what happened to a row, or would have on a dry run.
+	RowResult struct {
+		Row            int    `json:"row"`
+		ExternalRef    string `json:"externalRef,omitempty"`
+		Action         string `json:"action,omitempty"`
+		SubscriptionID uint64 `json:"subscriptionId,omitempty"`
+		ErrorCode      string `json:"errorCode,omitempty"`
+		Error          string `json:"error,omitempty"`
+	}
+	Summary struct {
+		Rows    int  `json:"rows"`
+		Created int  `json:"created"`
+		Updated int  `json:"updated"`
+		Failed  int  `json:"failed"`
+		DryRun  bool `json:"dryRun"`
+	}
+)
+
+func NewService(resource *resource.Resource, infrastructure *infrastructure.Infrastructure, subscriptions subscription.Service) Service {
+	return &service{
+		resource:      resource,
+		repo:          infrastructure.Store.Repository,
+		subscriptions: subscriptions,
+	}
+}
+
+func (s *service) Import(ctx context.Context, r io.Reader, req ImportRequest, report func(RowResult) error) (Summary, error) {
+	tr := tracer.StartTrace(ctx, "application.bulk.Import")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return Summary{}, err
+	}
+	var (
+		rows rowReader
+		err  error
+	)
+	if req.Format == FormatCSV {
+		if rows, err = newCSVReader(r); err != nil {
+			return Summary{}, invalid(err)
+		}
+	} else {
+		rows = newJSONLReader(r)
+	}
+
+	summary := Summary{DryRun: req.DryRun}
+	refs := make(refSet)
+	for {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		row, create, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			return summary, nil
+		}
+		var rowErr *RowError
+		if err != nil && !errors.As(err, &rowErr) {
+			return summary, err
+		}
+
+		result := RowResult{Row: row, ExternalRef: create.ExternalRef}
+		if rowErr != nil {
+			err = invalid(rowErr.Err)
+		} else if err = refs.add(create.ExternalRef, row); err == nil {
+			result.Action, result.SubscriptionID, err = s.importRow(ctx, create, req)
+		}
+		summary.Rows++
+		switch {
+		case err != nil:
+			summary.Failed++
+			result.Action = ""
+			result.ErrorCode, result.Error = describe(err)
+		case result.Action == ActionCreate:
+			summary.Created++
+		default:
+			summary.Updated++
+		}
+		if err := report(result); err != nil {
+			return summary, err
+		}
+	}
+}
+
+// importRow creates or updates the subscription of a row and returns the action
+// taken and the subscription id, which a dry run only knows for updates.
+func (s *service) importRow(ctx context.Context, create subscription.CreateRequest, req ImportRequest) (string, uint64, error) {
+	if err := s.validate(create); err != nil {
+		return "", 0, err
+	}
+	create.SkipMissed = true
+
+	var existing *repository.Subscription
+	if create.ExternalRef != "" {
+		sub, err := s.repo.GetSubscriptionByExternalRef(ctx, create.ExternalRef)
+		switch {
+		case err == nil:
+			existing = &sub
+		case !errors.Is(err, constant.SubscriptionNotFound):
+			return "", 0, err
+		}
+	}
+	if existing != nil {
+		if !req.Upsert {
+			return "", 0, constant.SubscriptionExists
+		}
+		if existing.OwnerID != create.OwnerID {
+			return "", 0, commonErr.ServiceError{
+				Code:    constant.InvalidRequest.Code,
+				Message: "external reference belongs to another owner",
+			}
+		}
+	}
+
+	if req.DryRun {
+		preview := subscription.PreviewRequest{
+			Schedule:   create.Schedule,
+			Timezone:   create.Timezone,
+			Calendar:   create.Calendar,
+			Adjustment: create.Adjustment,
+			StartAt:    create.StartAt,
+			EndAt:      create.EndAt,
+			Count:      1,
+		}
+		action, id := ActionCreate, uint64(0)
+		if existing != nil {
+			action, id = ActionUpdate, existing.ID
+			preview.StartAt, preview.EndAt = &existing.StartAt, existing.EndAt
+		}
+		planned, err := s.subscriptions.Preview(ctx, preview)
+		if err != nil {
+			return "", 0, err
+		}
+		if len(planned.Occurrences) == 0 {
+			return "", 0, commonErr.ServiceError{
+				Code:    constant.InvalidSchedule.Code,
+				Message: "schedule has no occurrence between startAt and endAt",
+			}
+		}
+		return action, id, nil
+	}
+
+	if existing != nil {
+		sub, err := s.subscriptions.Update(ctx, existing.ID, updateRequest(create))
+		return ActionUpdate, sub.ID, err
+	}
+	sub, err := s.subscriptions.Create(ctx, create)
+	return ActionCreate, sub.ID, err
+}
+
+func (s *service) Export(ctx context.Context, w io.Writer, req ExportRequest) (int64, error) {
+	tr := tracer.StartTrace(ctx, "application.bulk.Export")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return 0, err
+	}
+	var (
+		rows rowWriter
+		err  error
+	)
+	if req.Format == FormatCSV {
+		if rows, err = newCSVWriter(w); err != nil {
+			return 0, err
+		}
+	} else {
+		rows = jsonlWriter{encoder: json.NewEncoder(w)}
+	}
+
+	var written int64
+	err = s.repo.EachSubscription(ctx, repository.SubscriptionFilter{
+		OwnerID: req.OwnerID,
+		Status:  req.Status,
+	}, exportBatchSize, func(batch []repository.Subscription) error {
+		for _, sub := range batch {
+			if err := rows.Write(sub); err != nil {
+				return err
+			}
+			written++
+		}
+		return rows.Flush()
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, rows.Flush()
+}
+
+// refSet remembers the row of every external reference of an import, so a
+// reference repeated in the same file fails the same way on a dry run.
+type refSet map[string]int
+
+func (refs refSet) add(ref string, row int) error {
+	if ref == "" {
+		return nil
+	}
+	if first, ok := refs[ref]; ok {
+		return commonErr.ServiceError{
+			Code:    constant.SubscriptionExists.Code,
+			Message: fmt.Sprintf("external reference repeats row %d", first),
+		}
+	}
+	refs[ref] = row
+	return nil
+}
+
+// updateRequest turns a row into an update of every field it carries. The
+// start and end of a subscription cannot change, and an empty timezone,
+// adjustment, misfire or concurrency policy keeps the current one.
+func updateRequest(create subscription.CreateRequest) subscription.UpdateRequest {
+	update := subscription.UpdateRequest{
+		Schedule:       &create.Schedule,
+		Calendar:       &create.Calendar,
+		Amount:         &create.Amount,
+		Currency:       &create.Currency,
+		Description:    &create.Description,
+		RetryPolicy:    create.RetryPolicy,
+		MisfireMaxRuns: &create.MisfireMaxRuns,
+	}
+	if create.Timezone != "" {
+		update.Timezone = &create.Timezone
+	}
+	if create.Adjustment != "" {
+		update.Adjustment = &create.Adjustment
+	}
+	if create.MisfirePolicy != "" {
+		update.MisfirePolicy = &create.MisfirePolicy
+	}
+	if create.ConcurrencyPolicy != "" {
+		update.ConcurrencyPolicy = &create.ConcurrencyPolicy
+	}
+	return update
+}
+
+func (s *service) validate(req interface{}) error {
+	if err := s.resource.Validator.Struct(req); err != nil {
+		return invalid(err)
+	}
+	return nil
+}
+
+func invalid(err error) error {
+	return commonErr.ServiceError{
+		Code:    constant.InvalidRequest.Code,
+		Message: err.Error(),
+	}
+}
+
+// describe returns the code and message reported for a failed row.
+func describe(err error) (string, string) {
+	var serviceErr commonErr.ServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.Code, serviceErr.Message
+	}
+	return constant.InternalError.Code, err.Error()
+}
@@ -0,0 +1,25 @@
+package bulk
+
+import (
+	"errors"
+	"newdemo1/constant"
+	commonErr "newdemo1/resource/jaeger/common/error"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefSet(t *testing.T) {
+	refs := make(refSet)
+	require.NoError(t, refs.add("legacy-1", 1))
+	require.NoError(t, refs.add("", 2))
+	require.NoError(t, refs.add("", 3))
+	require.NoError(t, refs.add("legacy-2", 4))
+
+	err := refs.add("legacy-1", 5)
+	var serviceErr commonErr.ServiceError
+	require.True(t, errors.As(err, &serviceErr))
+	assert.Equal(t, constant.SubscriptionExists.Code, serviceErr.Code)
+	assert.Contains(t, serviceErr.Message, "row 1")
+}
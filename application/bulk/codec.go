@@ -0,0 +1,298 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"newdemo1/application/subscription"
+	"newdemo1/infrastructure/repository"
+	"strconv"
+	"time"
+)
+
+// RowError is a row that could not be decoded; the rows after it are still read.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// rowReader reads one subscription per call to Next, numbering rows from one.
+// Next returns io.EOF after the last row and a *RowError for a malformed one.
+type rowReader interface {
+	Next() (int, subscription.CreateRequest, error)
+}
+
+// column maps a CSV column to a subscription. Columns without set are only
+// exported; importing ignores them so an export can be imported again.
+type column struct {
+	name string
+	get  func(sub repository.Subscription) string
+	set  func(req *subscription.CreateRequest, value string) error
+}
+
+var columns = []column{
+	{name: "id", get: func(sub repository.Subscription) string { return strconv.FormatUint(sub.ID, 10) }},
+	{name: "externalRef", get: func(sub repository.Subscription) string {
+		if sub.ExternalRef == nil {
+			return ""
+		}
+		return *sub.ExternalRef
+	}, set: func(req *subscription.CreateRequest, value string) error {
+		req.ExternalRef = value
+		return nil
+	}},
+	{name: "ownerId", get: func(sub repository.Subscription) string { return sub.OwnerID },
+		set: func(req *subscription.CreateRequest, value string) error {
+			req.OwnerID = value
+			return nil
+		}},
+	{name: "schedule", get: func(sub repository.Subscription) string { return sub.Schedule },
+		set: func(req *subscription.CreateRequest, value string) error {
+			req.Schedule = value
+			return nil
+		}},
+	{name: "timezone", get: func(sub repository.Subscription) string { return sub.Timezone },
+		set: func(req *subscription.CreateRequest, value string) error {
+			req.Timezone = value
+			return nil
+		}},
+	{name: "calendar", get: func(sub repository.Subscription) string { return sub.Calendar },
+		set: func(req *subscription.CreateRequest, value string) error {
+			req.Calendar = value
+			return nil
+		}},
+	{name: "adjustment", get: func(sub repository.Subscription) string { return sub.Adjustment },
+		set: func(req *subscription.CreateRequest, value string) error {
+			req.Adjustment = value
+			return nil
+		}},
+	{name: "amount", get: func(sub repository.Subscription) string { return strconv.FormatInt(sub.Amount, 10) },
+		set: func(req *subscription.CreateRequest, value string) (err error) {
+			req.Amount, err = strconv.ParseInt(value, 10, 64)
+			return err
+		}},
+	{name: "currency", get: func(sub repository.Subscription) string { return sub.Currency },
+		set: func(req *subscription.CreateRequest, value string) error {
+			req.Currency = value
+			return nil
+		}},
+	{name: "description", get: func(sub repository.Subscription) string { return sub.Description },
+		set: func(req *subscription.CreateRequest, value string) error {
+			req.Description = value
+			return nil
+		}},
+	{name: "startAt", get: func(sub repository.Subscription) string { return formatTime(&sub.StartAt) },
+		set: func(req *subscription.CreateRequest, value string) (err error) {
+			req.StartAt, err = parseTime(value)
+			return err
+		}},
+	{name: "endAt", get: func(sub repository.Subscription) string { return formatTime(sub.EndAt) },
+		set: func(req *subscription.CreateRequest, value string) (err error) {
+			req.EndAt, err = parseTime(value)
+			return err
+		}},
+	{name: "misfirePolicy", get: func(sub repository.Subscription) string { return sub.MisfirePolicy },
+		set: func(req *subscription.CreateRequest, value string) error {
+			req.MisfirePolicy = value
+			return nil
+		}},
+	{name: "misfireMaxRuns", get: func(sub repository.Subscription) string { return strconv.Itoa(sub.MisfireMaxRuns) },
+		set: func(req *subscription.CreateRequest, value string) (err error) {
+			if value == "" {
+				return nil
+			}
+			req.MisfireMaxRuns, err = strconv.Atoi(value)
+			return err
+		}},
+	{name: "concurrencyPolicy", get: func(sub repository.Subscription) string { return sub.ConcurrencyPolicy },
+		set: func(req *subscription.CreateRequest, value string) error {
+			req.ConcurrencyPolicy = value
+			return nil
+		}},
+	{name: "lastRunAt", get: func(sub repository.Subscription) string { return formatTime(sub.LastRunAt) },
+		set: func(req *subscription.CreateRequest, value string) (err error) {
+			req.LastRunAt, err = parseTime(value)
+			return err
+		}},
+	{name: "status", get: func(sub repository.Subscription) string { return sub.Status }},
+	{name: "nextRunAt", get: func(sub repository.Subscription) string { return formatTime(sub.NextRunAt) }},
+}
+
+func columnByName(name string) (column, bool) {
+	for _, c := range columns {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns []column
+	row     int
+}
+
+// newCSVReader reads the header naming the columns of the rows that follow.
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv: missing header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	cr := &csvReader{reader: reader, columns: make([]column, len(header))}
+	for i, name := range header {
+		c, ok := columnByName(name)
+		if !ok {
+			return nil, fmt.Errorf("csv: unknown column %q", name)
+		}
+		cr.columns[i] = c
+	}
+	return cr, nil
+}
+
+func (r *csvReader) Next() (int, subscription.CreateRequest, error) {
+	var req subscription.CreateRequest
+	record, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, req, io.EOF
+	}
+	r.row++
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return r.row, req, &RowError{Row: r.row, Err: err}
+	}
+	if err != nil {
+		return r.row, req, err
+	}
+	for i, value := range record {
+		c := r.columns[i]
+		if c.set == nil {
+			continue
+		}
+		if err := c.set(&req, value); err != nil {
+			return r.row, req, &RowError{Row: r.row, Err: fmt.Errorf("%s: %w", c.name, err)}
+		}
+	}
+	return r.row, req, nil
+}
+
+// jsonlReader reads one JSON object per line, skipping blank lines. Rows
+// are numbered by line.
+type jsonlReader struct {
+	reader *bufio.Reader
+	row    int
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	return &jsonlReader{reader: bufio.NewReader(r)}
+}
+
+func (r *jsonlReader) Next() (int, subscription.CreateRequest, error) {
+	// A row also carries the import-only fields a create request does not decode.
+	var row struct {
+		subscription.CreateRequest
+		LastRunAt *time.Time `json:"lastRunAt"`
+	}
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return 0, subscription.CreateRequest{}, err
+		}
+		r.row++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(line, &row); err != nil {
+			return r.row, row.CreateRequest, &RowError{Row: r.row, Err: err}
+		}
+		req := row.CreateRequest
+		req.LastRunAt = row.LastRunAt
+		return r.row, req, nil
+	}
+}
+
+// rowWriter writes subscriptions in an export format.
+type rowWriter interface {
+	Write(sub repository.Subscription) error
+	Flush() error
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+// newCSVWriter writes the header of every column.
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: writer, record: make([]string, len(columns))}, nil
+}
+
+func (w *csvWriter) Write(sub repository.Subscription) error {
+	for i, c := range columns {
+		w.record[i] = c.get(sub)
+	}
+	return w.writer.Write(w.record)
+}
+
+func (w *csvWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// jsonlWriter writes a subscription as one JSON object per line; its keys are
+// those of an import row.
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (w jsonlWriter) Write(sub repository.Subscription) error {
+	return w.encoder.Encode(sub)
+}
+
+func (w jsonlWriter) Flush() error {
+	return nil
+}
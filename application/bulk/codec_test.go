@@ -0,0 +1,126 @@
+package bulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"newdemo1/application/subscription"
+	"newdemo1/infrastructure/repository"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVReader(t *testing.T) {
+	rows, err := newCSVReader(strings.NewReader(
+		"externalRef,ownerId,schedule,amount,currency,startAt,misfireMaxRuns\n" +
+			"legacy-1,owner-1,0 9 * * *,1500,IDR,2024-01-01T09:00:00+07:00,\n" +
+			"legacy-2,owner-1,0 9 * * *,lots,IDR,,\n" +
+			"legacy-3,owner-2\n" +
+			"legacy-4,owner-2,FREQ=MONTHLY,99,USD,,3\n"))
+	require.NoError(t, err)
+
+	row, req, err := rows.Next()
+	require.NoError(t, err)
+	assert.Equal(t, 1, row)
+	assert.Equal(t, "legacy-1", req.ExternalRef)
+	assert.Equal(t, int64(1500), req.Amount)
+	require.NotNil(t, req.StartAt)
+	assert.True(t, req.StartAt.Equal(time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)))
+
+	var rowErr *RowError
+	row, _, err = rows.Next()
+	require.True(t, errors.As(err, &rowErr))
+	assert.Equal(t, 2, row)
+	assert.Contains(t, err.Error(), "amount")
+
+	row, _, err = rows.Next()
+	require.True(t, errors.As(err, &rowErr))
+	assert.Equal(t, 3, row)
+
+	row, req, err = rows.Next()
+	require.NoError(t, err)
+	assert.Equal(t, 4, row)
+	assert.Equal(t, 3, req.MisfireMaxRuns)
+
+	_, _, err = rows.Next()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = newCSVReader(strings.NewReader("ownerId,colour\n"))
+	assert.Error(t, err)
+}
+
+func TestJSONLReader(t *testing.T) {
+	rows := newJSONLReader(strings.NewReader(
+		`{"externalRef":"legacy-1","ownerId":"owner-1","amount":1500,"lastRunAt":"2024-06-01T02:00:00Z"}` + "\n\n" +
+			`{"amount":"lots"}` + "\n" +
+			`{"externalRef":"legacy-3","id":42,"status":"active"}`))
+
+	row, req, err := rows.Next()
+	require.NoError(t, err)
+	assert.Equal(t, 1, row)
+	assert.Equal(t, "legacy-1", req.ExternalRef)
+	require.NotNil(t, req.LastRunAt)
+	assert.Equal(t, time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC), *req.LastRunAt)
+
+	// An API request does not decode the import-only field.
+	var api subscription.CreateRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"lastRunAt":"2024-06-01T02:00:00Z"}`), &api))
+	assert.Nil(t, api.LastRunAt)
+
+	var rowErr *RowError
+	row, _, err = rows.Next()
+	require.True(t, errors.As(err, &rowErr))
+	assert.Equal(t, 3, row)
+
+	row, req, err = rows.Next()
+	require.NoError(t, err)
+	assert.Equal(t, 4, row)
+	assert.Equal(t, "legacy-3", req.ExternalRef)
+
+	_, _, err = rows.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	ref := "legacy-1"
+	end := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	lastRun := time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC)
+	sub := repository.Subscription{
+		ID:          7,
+		ExternalRef: &ref,
+		OwnerID:     "owner-1",
+		Schedule:    "0 9 * * *",
+		Timezone:    "Asia/Jakarta",
+		Amount:      1500,
+		Currency:    "IDR",
+		Description: "Rent, monthly",
+		StartAt:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndAt:       &end,
+		LastRunAt:   &lastRun,
+		Status:      repository.SubscriptionStatusActive,
+	}
+
+	var buf bytes.Buffer
+	writer, err := newCSVWriter(&buf)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(sub))
+	require.NoError(t, writer.Flush())
+
+	rows, err := newCSVReader(&buf)
+	require.NoError(t, err)
+	_, req, err := rows.Next()
+	require.NoError(t, err)
+	assert.Equal(t, ref, req.ExternalRef)
+	assert.Equal(t, sub.Description, req.Description)
+	assert.Equal(t, sub.Timezone, req.Timezone)
+	require.NotNil(t, req.EndAt)
+	assert.True(t, end.Equal(*req.EndAt))
+	// The last run travels so the import does not charge its period again.
+	require.NotNil(t, req.LastRunAt)
+	assert.True(t, lastRun.Equal(*req.LastRunAt))
+}
@@ -0,0 +1,205 @@
+package calendar
+
+import (
+	"fmt"
+	"newdemo1/application/recurrence"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Business day conventions moving an occurrence off a weekend or holiday.
+const (
+	AdjustNone              = "none"
+	AdjustFollowing         = "following"
+	AdjustModifiedFollowing = "modified-following"
+	AdjustPreceding         = "preceding"
+)
+
+const (
+	// DateLayout is the layout of holiday dates.
+	DateLayout = "2006-01-02"
+
+	SourceFile     = "file"
+	SourceDatabase = "database"
+
+	// maxShift bounds how many days an occurrence may move.
+	maxShift = 366
+	// maxSkipped bounds the occurrences Next passes over when they move onto
+	// or before the given time.
+	maxSkipped = 100000
+	// maxOccurrences bounds Between like the recurrence rules do.
+	maxOccurrences = 10000
+)
+
+// DefaultWeekend is the weekend of calendars that name none.
+var DefaultWeekend = []string{"saturday", "sunday"}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+type (
+	// Calendar tells business days from weekends and holidays. The zero
+	// Calendar treats every day as a business day.
+	Calendar struct {
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+		Source      string    `json:"source"`
+		Weekend     []string  `json:"weekend"`
+		Holidays    []Holiday `json:"holidays"`
+
+		weekend  map[time.Weekday]bool
+		holidays map[string]bool
+	}
+
+	Holiday struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	}
+)
+
+// New builds a calendar from weekday names and holidays dated with DateLayout.
+func New(name, description, source string, weekend []string, holidays []Holiday) (Calendar, error) {
+	cal := Calendar{
+		Name:        name,
+		Description: description,
+		Source:      source,
+		Weekend:     make([]string, 0, len(weekend)),
+		Holidays:    make([]Holiday, 0, len(holidays)),
+		weekend:     make(map[time.Weekday]bool, len(weekend)),
+		holidays:    make(map[string]bool, len(holidays)),
+	}
+	for _, day := range weekend {
+		day = strings.ToLower(strings.TrimSpace(day))
+		weekday, ok := weekdays[day]
+		if !ok {
+			return Calendar{}, fmt.Errorf("calendar %s: unknown weekday %q", name, day)
+		}
+		if !cal.weekend[weekday] {
+			cal.weekend[weekday] = true
+			cal.Weekend = append(cal.Weekend, day)
+		}
+	}
+	if len(cal.weekend) == len(weekdays) {
+		return Calendar{}, fmt.Errorf("calendar %s: every weekday is a weekend day", name)
+	}
+	for _, holiday := range holidays {
+		if _, err := time.Parse(DateLayout, holiday.Date); err != nil {
+			return Calendar{}, fmt.Errorf("calendar %s: invalid holiday date %q", name, holiday.Date)
+		}
+		if !cal.holidays[holiday.Date] {
+			cal.holidays[holiday.Date] = true
+			cal.Holidays = append(cal.Holidays, holiday)
+		}
+	}
+	sort.Slice(cal.Holidays, func(i, j int) bool { return cal.Holidays[i].Date < cal.Holidays[j].Date })
+	return cal, nil
+}
+
+// IsBusinessDay reports whether the date of t, in the location of t, is
+// neither a weekend day nor a holiday.
+func (c Calendar) IsBusinessDay(t time.Time) bool {
+	return !c.weekend[t.Weekday()] && !c.holidays[t.Format(DateLayout)]
+}
+
+// Adjust moves t to a business day by convention, keeping its wall clock.
+// Following takes the next business day, preceding the previous one, and
+// modified-following the next one unless that is in another month.
+func (c Calendar) Adjust(t time.Time, convention string) time.Time {
+	switch convention {
+	case AdjustFollowing:
+		return c.shift(t, 1)
+	case AdjustPreceding:
+		return c.shift(t, -1)
+	case AdjustModifiedFollowing:
+		if following := c.shift(t, 1); following.Month() == t.Month() {
+			return following
+		}
+		return c.shift(t, -1)
+	default:
+		return t
+	}
+}
+
+func (c Calendar) shift(t time.Time, days int) time.Time {
+	for i := 0; i < maxShift && !c.IsBusinessDay(t); i++ {
+		t = t.AddDate(0, 0, days)
+	}
+	return t
+}
+
+// Rule moves the occurrences of rule by convention. Its location is the zone
+// business days are told apart in. Occurrences moved onto the same time
+// collapse into one.
+func Rule(rule recurrence.Rule, cal Calendar, convention string, location *time.Location) recurrence.Rule {
+	if convention == "" || convention == AdjustNone {
+		return rule
+	}
+	return adjusted{rule: rule, calendar: cal, convention: convention, location: location}
+}
+
+type adjusted struct {
+	rule       recurrence.Rule
+	calendar   Calendar
+	convention string
+	location   *time.Location
+}
+
+// Next relies on every convention keeping occurrences in order: it returns
+// the first moved occurrence after the given time.
+func (a adjusted) Next(after time.Time) (time.Time, bool) {
+	cursor := a.lookback(after)
+	for i := 0; i < maxSkipped; i++ {
+		nominal, ok := a.rule.Next(cursor)
+		if !ok {
+			return time.Time{}, false
+		}
+		if next := a.calendar.Adjust(nominal, a.convention); next.After(after) {
+			return next, true
+		}
+		cursor = nominal
+	}
+	return time.Time{}, false
+}
+
+func (a adjusted) Between(from, to time.Time) []time.Time {
+	var occurrences []time.Time
+	cursor := from.Add(-time.Nanosecond)
+	for len(occurrences) < maxOccurrences {
+		next, ok := a.Next(cursor)
+		if !ok || !next.Before(to) {
+			break
+		}
+		occurrences = append(occurrences, next)
+		cursor = next
+	}
+	return occurrences
+}
+
+// lookback returns where Next starts reading nominal occurrences. Following
+// conventions may move an occurrence from the non-business days before after
+// past it, so those days are read again.
+func (a adjusted) lookback(after time.Time) time.Time {
+	if a.convention == AdjustPreceding {
+		return after
+	}
+	local := after.In(a.location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, a.location)
+	if a.calendar.IsBusinessDay(day) {
+		day = day.AddDate(0, 0, -1)
+		if a.calendar.IsBusinessDay(day) {
+			return after
+		}
+	}
+	for i := 0; i < maxShift && !a.calendar.IsBusinessDay(day.AddDate(0, 0, -1)); i++ {
+		day = day.AddDate(0, 0, -1)
+	}
+	return day.Add(-time.Nanosecond)
+}
@@ -0,0 +1,95 @@
+package calendar
+
+import (
+	"newdemo1/application/recurrence"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2024, month, d, 9, 0, 0, 0, time.UTC)
+}
+
+func TestAdjust(t *testing.T) {
+	cal, err := New("test", "", SourceDatabase, DefaultWeekend, []Holiday{{Date: "2024-06-03", Name: "Holiday"}})
+	require.NoError(t, err)
+
+	assert.True(t, cal.IsBusinessDay(day(6, 4)))
+	assert.False(t, cal.IsBusinessDay(day(6, 1)))
+	assert.False(t, cal.IsBusinessDay(day(6, 3)))
+
+	// Saturday 1 June, with Monday 3 June a holiday.
+	assert.Equal(t, day(6, 1), cal.Adjust(day(6, 1), AdjustNone))
+	assert.Equal(t, day(6, 4), cal.Adjust(day(6, 1), AdjustFollowing))
+	assert.Equal(t, day(5, 31), cal.Adjust(day(6, 1), AdjustPreceding))
+	assert.Equal(t, day(6, 4), cal.Adjust(day(6, 1), AdjustModifiedFollowing))
+	// Saturday 31 August would follow into September, so it precedes instead.
+	assert.Equal(t, day(9, 2), cal.Adjust(day(8, 31), AdjustFollowing))
+	assert.Equal(t, day(8, 30), cal.Adjust(day(8, 31), AdjustModifiedFollowing))
+
+	_, err = New("test", "", SourceDatabase, []string{"caturday"}, nil)
+	assert.Error(t, err)
+	_, err = New("test", "", SourceDatabase, nil, []Holiday{{Date: "2024-13-01"}})
+	assert.Error(t, err)
+}
+
+func TestRule(t *testing.T) {
+	cal, err := New("test", "", SourceDatabase, DefaultWeekend, nil)
+	require.NoError(t, err)
+	daily, err := recurrence.Parse("0 9 * * *", day(5, 29))
+	require.NoError(t, err)
+
+	// The weekend runs of a daily schedule collapse onto Monday or Friday.
+	following := Rule(daily, cal, AdjustFollowing, time.UTC)
+	assert.Equal(t, []time.Time{day(5, 30), day(5, 31), day(6, 3), day(6, 4)},
+		following.Between(day(5, 30), day(6, 5)))
+	preceding := Rule(daily, cal, AdjustPreceding, time.UTC)
+	assert.Equal(t, []time.Time{day(5, 30), day(5, 31), day(6, 3), day(6, 4)},
+		preceding.Between(day(5, 30), day(6, 5)))
+
+	// Read from the weekend, the Saturday run still moves onto Monday.
+	next, ok := following.Next(day(6, 2))
+	require.True(t, ok)
+	assert.Equal(t, day(6, 3), next)
+
+	monthly, err := recurrence.Parse("0 9 1 * *", day(5, 1))
+	require.NoError(t, err)
+	next, ok = Rule(monthly, cal, AdjustFollowing, time.UTC).Next(day(5, 31))
+	require.True(t, ok)
+	assert.Equal(t, day(6, 3), next)
+
+	assert.Equal(t, daily, Rule(daily, cal, AdjustNone, time.UTC))
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "id.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`
+description: Indonesian bank holidays
+holidays:
+  - date: "2024-12-25"
+    name: Christmas
+`), 0o600))
+	cal, err := LoadFile(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, "id", cal.Name)
+	assert.Equal(t, SourceFile, cal.Source)
+	assert.Equal(t, DefaultWeekend, cal.Weekend)
+	assert.False(t, cal.IsBusinessDay(day(12, 25)))
+
+	jsonPath := filepath.Join(dir, "gulf.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"name":"gulf","weekend":["friday","saturday"]}`), 0o600))
+	cal, err = LoadFile(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, "gulf", cal.Name)
+	assert.True(t, cal.IsBusinessDay(day(6, 2)))
+	assert.False(t, cal.IsBusinessDay(day(5, 31)))
+
+	_, err = LoadFile(filepath.Join(dir, "missing.toml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// file is the layout of a calendar file. A file without weekend gets
+// DefaultWeekend; an empty list means no weekend.
+type file struct {
+	Name        string    `yaml:"name" json:"name"`
+	Description string    `yaml:"description" json:"description"`
+	Weekend     []string  `yaml:"weekend" json:"weekend"`
+	Holidays    []Holiday `yaml:"holidays" json:"holidays"`
+}
+
+// LoadFile reads a calendar from a YAML or JSON file, told apart by extension.
+// The calendar is named after the file when the file names none.
+func LoadFile(path string) (Calendar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Calendar{}, err
+	}
+
+	var f file
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &f)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &f)
+	default:
+		return Calendar{}, fmt.Errorf("calendar %s: unsupported file type", path)
+	}
+	if err != nil {
+		return Calendar{}, fmt.Errorf("calendar %s: %w", path, err)
+	}
+
+	if f.Name == "" {
+		f.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if f.Weekend == nil {
+		f.Weekend = DefaultWeekend
+	}
+	return New(f.Name, f.Description, SourceFile, f.Weekend, f.Holidays)
+}
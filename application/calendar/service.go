@@ -0,0 +1,291 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"newdemo1/constant"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/resource"
+	commonErr "newdemo1/resource/jaeger/common/error"
+	"newdemo1/resource/jaeger/common/tracer"
+)
+
+type (
+	// Service looks calendars up by name among the configured files and the
+	// database, and manages the database ones. File calendars are read-only.
+	Service interface {
+		// Get returns the named calendar; the empty name is a calendar of
+		// DefaultWeekend without holidays.
+		Get(ctx context.Context, name string) (Calendar, error)
+		List(ctx context.Context) ([]Calendar, error)
+		Create(ctx context.Context, req CreateRequest) (Calendar, error)
+		// Delete refuses a calendar still adjusting active or paused subscriptions.
+		Delete(ctx context.Context, name string) error
+		// SaveHoliday adds a holiday on date, renaming the one already there.
+		// Both it and RemoveHoliday move the pending next runs the calendar adjusts.
+		SaveHoliday(ctx context.Context, name, date string, req HolidayRequest) (Calendar, error)
+		RemoveHoliday(ctx context.Context, name, date string) (Calendar, error)
+	}
+	// Rescheduler moves the next runs a calendar adjusts once its holidays
+	// changed, through repo, the repository of the transaction changing them.
+	Rescheduler interface {
+		Reschedule(ctx context.Context, repo *repository.Repository, cal Calendar) error
+	}
+	service struct {
+		resource    *resource.Resource
+		repo        *repository.Repository
+		rescheduler Rescheduler
+		files       map[string]Calendar
+		// names keeps the file calendars in configuration order.
+		names []string
+	}
+
+	// CreateRequest creates a database calendar; a nil Weekend is DefaultWeekend.
+	CreateRequest struct {
+		Name        string           `json:"name" validate:"required,max=64"`
+		Description string           `json:"description" validate:"max=255"`
+		Weekend     []string         `json:"weekend" validate:"max=6,dive,oneof=monday tuesday wednesday thursday friday saturday sunday"`
+		Holidays    []HolidayRequest `json:"holidays" validate:"max=1000,dive"`
+	}
+	HolidayRequest struct {
+		Date string `json:"date" validate:"required,datetime=2006-01-02"`
+		Name string `json:"name" validate:"max=255"`
+	}
+)
+
+// NewService loads the calendar files of the configuration. Holiday changes
+// reschedule the subscriptions of the calendar through rescheduler.
+func NewService(resource *resource.Resource, infrastructure *infrastructure.Infrastructure, rescheduler Rescheduler) (Service, error) {
+	files := make(map[string]Calendar, len(resource.Config.Calendar.Files))
+	names := make([]string, 0, len(resource.Config.Calendar.Files))
+	for _, path := range resource.Config.Calendar.Files {
+		cal, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := files[cal.Name]; ok {
+			return nil, fmt.Errorf("calendar %s: defined by more than one file", cal.Name)
+		}
+		files[cal.Name] = cal
+		names = append(names, cal.Name)
+	}
+	return &service{
+		resource:    resource,
+		repo:        infrastructure.Store.Repository,
+		rescheduler: rescheduler,
+		files:       files,
+		names:       names,
+	}, nil
+}
+
+func (s *service) Get(ctx context.Context, name string) (Calendar, error) {
+	tr := tracer.StartTrace(ctx, "application.calendar.Get")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if name == "" {
+		return New("", "", "", DefaultWeekend, nil)
+	}
+	if cal, ok := s.files[name]; ok {
+		return cal, nil
+	}
+	record, err := s.repo.GetCalendar(ctx, name)
+	if err != nil {
+		return Calendar{}, err
+	}
+	return fromRecord(record)
+}
+
+func (s *service) List(ctx context.Context) ([]Calendar, error) {
+	tr := tracer.StartTrace(ctx, "application.calendar.List")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	records, err := s.repo.ListCalendars(ctx)
+	if err != nil {
+		return nil, err
+	}
+	calendars := make([]Calendar, 0, len(s.names)+len(records))
+	for _, name := range s.names {
+		calendars = append(calendars, s.files[name])
+	}
+	for _, record := range records {
+		cal, err := fromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, cal)
+	}
+	return calendars, nil
+}
+
+func (s *service) Create(ctx context.Context, req CreateRequest) (Calendar, error) {
+	tr := tracer.StartTrace(ctx, "application.calendar.Create")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return Calendar{}, err
+	}
+	if _, ok := s.files[req.Name]; ok {
+		return Calendar{}, readOnly(req.Name)
+	}
+	if _, err := s.repo.GetCalendar(ctx, req.Name); err == nil {
+		return Calendar{}, commonErr.ServiceError{
+			Code:    constant.CalendarConflict.Code,
+			Message: fmt.Sprintf("calendar %s already exists", req.Name),
+		}
+	} else if !errors.Is(err, constant.CalendarNotFound) {
+		return Calendar{}, err
+	}
+
+	weekend := req.Weekend
+	if weekend == nil {
+		weekend = DefaultWeekend
+	}
+	holidays := make([]Holiday, 0, len(req.Holidays))
+	for _, holiday := range req.Holidays {
+		holidays = append(holidays, Holiday{Date: holiday.Date, Name: holiday.Name})
+	}
+	cal, err := New(req.Name, req.Description, SourceDatabase, weekend, holidays)
+	if err != nil {
+		return Calendar{}, invalid(err)
+	}
+
+	record := repository.Calendar{
+		Name:        cal.Name,
+		Description: cal.Description,
+		Weekend:     cal.Weekend,
+	}
+	for _, holiday := range cal.Holidays {
+		record.Holidays = append(record.Holidays, repository.CalendarHoliday{Date: holiday.Date, Name: holiday.Name})
+	}
+	if err := s.repo.CreateCalendar(ctx, &record); err != nil {
+		return Calendar{}, err
+	}
+	return cal, nil
+}
+
+func (s *service) Delete(ctx context.Context, name string) error {
+	tr := tracer.StartTrace(ctx, "application.calendar.Delete")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if _, ok := s.files[name]; ok {
+		return readOnly(name)
+	}
+	return s.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		record, err := repo.GetCalendar(ctx, name)
+		if err != nil {
+			return err
+		}
+		inUse, err := repo.CountSubscriptionsByCalendar(ctx, name)
+		if err != nil {
+			return err
+		}
+		if inUse > 0 {
+			return commonErr.ServiceError{
+				Code:    constant.CalendarConflict.Code,
+				Message: fmt.Sprintf("calendar %s adjusts %d subscriptions", name, inUse),
+			}
+		}
+		return repo.DeleteCalendar(ctx, record.ID)
+	})
+}
+
+func (s *service) SaveHoliday(ctx context.Context, name, date string, req HolidayRequest) (Calendar, error) {
+	tr := tracer.StartTrace(ctx, "application.calendar.SaveHoliday")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	req.Date = date
+	if err := s.validate(req); err != nil {
+		return Calendar{}, err
+	}
+	return s.changeHolidays(ctx, name, func(repo *repository.Repository, record repository.Calendar) error {
+		return repo.SaveCalendarHoliday(ctx, &repository.CalendarHoliday{
+			CalendarID: record.ID,
+			Date:       date,
+			Name:       req.Name,
+		})
+	})
+}
+
+func (s *service) RemoveHoliday(ctx context.Context, name, date string) (Calendar, error) {
+	tr := tracer.StartTrace(ctx, "application.calendar.RemoveHoliday")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return s.changeHolidays(ctx, name, func(repo *repository.Repository, record repository.Calendar) error {
+		err := repo.DeleteCalendarHoliday(ctx, record.ID, date)
+		if errors.Is(err, constant.CalendarNotFound) {
+			return commonErr.ServiceError{
+				Code:    constant.CalendarNotFound.Code,
+				Message: fmt.Sprintf("calendar %s has no holiday on %s", name, date),
+			}
+		}
+		return err
+	})
+}
+
+// changeHolidays applies change to a database calendar and returns it as
+// changed, with the next runs it adjusts moved in the same transaction.
+func (s *service) changeHolidays(ctx context.Context, name string,
+	change func(repo *repository.Repository, record repository.Calendar) error) (Calendar, error) {
+	if _, ok := s.files[name]; ok {
+		return Calendar{}, readOnly(name)
+	}
+	var cal Calendar
+	err := s.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		current, err := repo.GetCalendar(ctx, name)
+		if err != nil {
+			return err
+		}
+		if err := change(repo, current); err != nil {
+			return err
+		}
+		record, err := repo.GetCalendar(ctx, name)
+		if err != nil {
+			return err
+		}
+		if cal, err = fromRecord(record); err != nil {
+			return err
+		}
+		return s.rescheduler.Reschedule(ctx, repo, cal)
+	})
+	if err != nil {
+		return Calendar{}, err
+	}
+	return cal, nil
+}
+
+func (s *service) validate(req interface{}) error {
+	if err := s.resource.Validator.Struct(req); err != nil {
+		return invalid(err)
+	}
+	return nil
+}
+
+func fromRecord(record repository.Calendar) (Calendar, error) {
+	holidays := make([]Holiday, 0, len(record.Holidays))
+	for _, holiday := range record.Holidays {
+		holidays = append(holidays, Holiday{Date: holiday.Date, Name: holiday.Name})
+	}
+	return New(record.Name, record.Description, SourceDatabase, record.Weekend, holidays)
+}
+
+func invalid(err error) error {
+	return commonErr.ServiceError{
+		Code:    constant.InvalidRequest.Code,
+		Message: err.Error(),
+	}
+}
+
+func readOnly(name string) error {
+	return commonErr.ServiceError{
+		Code:    constant.CalendarConflict.Code,
+		Message: fmt.Sprintf("calendar %s is defined by a file and cannot be changed", name),
+	}
+}
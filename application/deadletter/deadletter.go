@@ -0,0 +1,187 @@
+package deadletter
+
+import (
+	"context"
+	"newdemo1/application/outbox"
+	"newdemo1/constant"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/mq/pubsub1"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/resource"
+	commonErr "newdemo1/resource/jaeger/common/error"
+	"newdemo1/resource/jaeger/common/tracer"
+	"strconv"
+	"time"
+)
+
+const (
+	// AttributeRedrivenFrom is set on a redriven message to the id of its dead letter.
+	AttributeRedrivenFrom = "redrivenFrom"
+	// AttributeRedriveTo is set on a redriven message to the subscription it failed
+	// on. Consumers of other subscriptions on the topic ack it without handling it.
+	AttributeRedriveTo = "redriveTo"
+)
+
+type (
+	// Service keeps messages that exhausted their delivery attempts and lets
+	// operators inspect, redrive or purge them.
+	Service interface {
+		Record(ctx context.Context, subscription string, message *pubsub1.Message, attempts int, cause error) error
+		List(ctx context.Context, req ListRequest) ([]repository.DeadLetter, int64, error)
+		Get(ctx context.Context, id uint64) (repository.DeadLetter, error)
+		// Redrive publishes the message again on the topic of its subscription,
+		// addressed to that subscription only.
+		Redrive(ctx context.Context, id uint64) (repository.DeadLetter, error)
+		Delete(ctx context.Context, id uint64) error
+		Purge(ctx context.Context, req PurgeRequest) (int64, error)
+	}
+	service struct {
+		resource *resource.Resource
+		repo     *repository.Repository
+	}
+
+	ListRequest struct {
+		Subscription string `form:"subscription" validate:"max=255"`
+		Status       string `form:"status" validate:"omitempty,oneof=pending redriven"`
+		Page         int    `form:"page" validate:"gte=0"`
+		Size         int    `form:"size" validate:"gte=0,lte=100"`
+	}
+	PurgeRequest struct {
+		Subscription string `form:"subscription" validate:"max=255"`
+		Status       string `form:"status" validate:"omitempty,oneof=pending redriven"`
+		// All must be set to purge without a subscription or status.
+		All bool `form:"all"`
+	}
+)
+
+const defaultPageSize = 20
+
+func NewService(resource *resource.Resource, infrastructure *infrastructure.Infrastructure) Service {
+	return &service{
+		resource: resource,
+		repo:     infrastructure.Store.Repository,
+	}
+}
+
+func (s *service) Record(ctx context.Context, subscription string, message *pubsub1.Message, attempts int, cause error) error {
+	tr := tracer.StartTrace(ctx, "application.deadletter.Record")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return s.repo.CreateDeadLetter(ctx, &repository.DeadLetter{
+		Subscription: subscription,
+		Topic:        s.resource.Config.Pubsub.Subscriber.Settings[subscription].Topic,
+		MessageID:    message.ID,
+		Data:         message.Data,
+		Attributes:   message.Attributes,
+		Attempts:     attempts,
+		Error:        cause.Error(),
+		Status:       repository.DeadLetterStatusPending,
+	})
+}
+
+func (s *service) List(ctx context.Context, req ListRequest) ([]repository.DeadLetter, int64, error) {
+	tr := tracer.StartTrace(ctx, "application.deadletter.List")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return nil, 0, err
+	}
+	size := req.Size
+	if size == 0 {
+		size = defaultPageSize
+	}
+
+	return s.repo.ListDeadLetters(ctx, repository.DeadLetterFilter{
+		Subscription: req.Subscription,
+		Status:       req.Status,
+		Offset:       req.Page * size,
+		Limit:        size,
+	})
+}
+
+func (s *service) Get(ctx context.Context, id uint64) (repository.DeadLetter, error) {
+	tr := tracer.StartTrace(ctx, "application.deadletter.Get")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return s.repo.GetDeadLetter(ctx, id)
+}
+
+func (s *service) Redrive(ctx context.Context, id uint64) (repository.DeadLetter, error) {
+	tr := tracer.StartTrace(ctx, "application.deadletter.Redrive")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	deadLetter, err := s.repo.GetDeadLetter(ctx, id)
+	if err != nil {
+		return repository.DeadLetter{}, err
+	}
+	if deadLetter.Status != repository.DeadLetterStatusPending {
+		return repository.DeadLetter{}, constant.DeadLetterRedriven
+	}
+	if deadLetter.Topic == "" {
+		return repository.DeadLetter{}, constant.DeadLetterNoTopic
+	}
+
+	attributes := make(map[string]string, len(deadLetter.Attributes)+2)
+	for k, v := range deadLetter.Attributes {
+		attributes[k] = v
+	}
+	attributes[AttributeRedrivenFrom] = strconv.FormatUint(deadLetter.ID, 10)
+	attributes[AttributeRedriveTo] = deadLetter.Subscription
+
+	now := time.Now()
+	err = s.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		if err := repo.MarkDeadLetterRedriven(ctx, deadLetter.ID, now); err != nil {
+			return err
+		}
+		return outbox.Enqueue(ctx, repo, deadLetter.Topic, pubsub1.NewMessage(deadLetter.Data, attributes))
+	})
+	if err != nil {
+		return repository.DeadLetter{}, err
+	}
+	deadLetter.Status = repository.DeadLetterStatusRedriven
+	deadLetter.RedrivenAt = &now
+	return deadLetter, nil
+}
+
+func (s *service) Delete(ctx context.Context, id uint64) error {
+	tr := tracer.StartTrace(ctx, "application.deadletter.Delete")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return s.repo.DeleteDeadLetter(ctx, id)
+}
+
+func (s *service) Purge(ctx context.Context, req PurgeRequest) (int64, error) {
+	tr := tracer.StartTrace(ctx, "application.deadletter.Purge")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return 0, err
+	}
+	if req.Subscription == "" && req.Status == "" && !req.All {
+		return 0, commonErr.ServiceError{
+			Code:    constant.InvalidRequest.Code,
+			Message: "purge needs a subscription, a status or all=true",
+		}
+	}
+	return s.repo.PurgeDeadLetters(ctx, repository.DeadLetterFilter{
+		Subscription: req.Subscription,
+		Status:       req.Status,
+		All:          req.All,
+	})
+}
+
+func (s *service) validate(req interface{}) error {
+	if err := s.resource.Validator.Struct(req); err != nil {
+		return commonErr.ServiceError{
+			Code:    constant.InvalidRequest.Code,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"newdemo1/application/run"
+	"newdemo1/application/subscription"
+	"newdemo1/constant"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/resource"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+
+	retriesExhaustedReason = "retries exhausted"
+)
+
+type (
+	// Service handles the events downstream services send back about occurrences.
+	// A returned error means the message should be redelivered; malformed or
+	// orphaned messages are logged and acknowledged.
+	Service interface {
+		HandleHappenResult(ctx context.Context, data []byte) error
+		HandleJobFinish(ctx context.Context, data []byte) error
+	}
+	service struct {
+		resource  *resource.Resource
+		repo      *repository.Repository
+		runs      *run.Broadcaster
+		lifecycle subscription.Lifecycle
+	}
+
+	// HappenResult reports the outcome of one recurring-happen event.
+	// CorrelationID and Attempt are those of the happen event, when the sender
+	// echoes them; a result of an earlier attempt than the last is ignored.
+	HappenResult struct {
+		SubscriptionID uint64    `json:"subscriptionId" validate:"required"`
+		ScheduledAt    time.Time `json:"scheduledAt" validate:"required"`
+		CorrelationID  string    `json:"correlationId" validate:"max=64"`
+		Attempt        int       `json:"attempt" validate:"min=0"`
+		Status         string    `json:"status" validate:"required,oneof=success failed"`
+		ErrorCode      string    `json:"errorCode" validate:"max=64"`
+		ErrorMessage   string    `json:"errorMessage"`
+	}
+	// JobFinish reports that the job started by an occurrence has completed.
+	JobFinish struct {
+		SubscriptionID uint64    `json:"subscriptionId" validate:"required"`
+		ScheduledAt    time.Time `json:"scheduledAt" validate:"required"`
+		CorrelationID  string    `json:"correlationId" validate:"max=64"`
+		FinishedAt     time.Time `json:"finishedAt"`
+	}
+)
+
+func NewService(resource *resource.Resource, infrastructure *infrastructure.Infrastructure, runs *run.Broadcaster) Service {
+	return &service{
+		resource:  resource,
+		repo:      infrastructure.Store.Repository,
+		runs:      runs,
+		lifecycle: subscription.NewLifecycle(resource),
+	}
+}
+
+func (s *service) HandleHappenResult(ctx context.Context, data []byte) error {
+	tr := tracer.StartTrace(ctx, "application.event.HandleHappenResult")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var result HappenResult
+	if !s.decode(ctx, data, &result) {
+		return nil
+	}
+
+	now := time.Now()
+	var (
+		sub       repository.Subscription
+		duplicate bool
+	)
+	err := s.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		var err error
+		sub, err = repo.GetSubscriptionForUpdate(ctx, result.SubscriptionID)
+		if err != nil {
+			return err
+		}
+		ledger, err := s.findRun(ctx, repo, repository.RunKey{
+			CorrelationID:  result.CorrelationID,
+			SubscriptionID: result.SubscriptionID,
+			ScheduledAt:    result.ScheduledAt,
+		})
+		if err != nil {
+			return err
+		}
+		if ledger != nil {
+			if reason := ignoredResult(*ledger, result.Attempt); reason != "" {
+				s.resource.Log.Warn(ctx, reason,
+					zap.Uint64("runId", ledger.ID),
+					zap.String("status", ledger.Status),
+					zap.Int("attempt", result.Attempt),
+					zap.Int("lastAttempt", ledger.Attempts))
+				duplicate = true
+				return nil
+			}
+		}
+		if err := repo.UpdateSubscriptionResult(ctx, sub.ID, result.Status, now); err != nil {
+			return err
+		}
+		if ledger == nil {
+			return nil
+		}
+		return s.settle(ctx, repo, &sub, ledger, result, now)
+	})
+	if errors.Is(err, constant.SubscriptionNotFound) {
+		s.resource.Log.Warn(ctx, "happen result for unknown subscription",
+			zap.Uint64("subscriptionId", result.SubscriptionID))
+		return nil
+	}
+	if err != nil || duplicate {
+		return err
+	}
+
+	eventType := run.EventSucceeded
+	if result.Status == ResultFailed {
+		eventType = run.EventFailed
+	}
+	s.runs.Publish(run.Event{
+		SubscriptionID: sub.ID,
+		OwnerID:        sub.OwnerID,
+		ScheduledAt:    result.ScheduledAt,
+		Type:           eventType,
+		ErrorCode:      result.ErrorCode,
+		ErrorMessage:   result.ErrorMessage,
+		OccurredAt:     now,
+	})
+	return nil
+}
+
+// settle records result on its run. A failure is retried as far as the retry
+// policy of sub allows; once it is not, sub moves to the exhausted status of
+// that policy. The failure of a replaced run is only recorded.
+func (s *service) settle(ctx context.Context, repo *repository.Repository, sub *repository.Subscription,
+	ledger *repository.SubscriptionRun, result HappenResult, now time.Time) error {
+	ledger.ResultAt = &now
+	ledger.NextRetryAt = nil
+	if result.Status == ResultSuccess {
+		ledger.Status = repository.RunStatusSucceeded
+		ledger.ErrorCode = ""
+		ledger.ErrorMessage = ""
+		return repo.UpdateSubscriptionRun(ctx, ledger)
+	}
+
+	ledger.Status = repository.RunStatusFailed
+	ledger.ErrorCode = result.ErrorCode
+	ledger.ErrorMessage = result.ErrorMessage
+	if ledger.ReplacedBy != nil {
+		return repo.UpdateSubscriptionRun(ctx, ledger)
+	}
+	if subscription.ShouldRetry(sub.RetryPolicy, ledger.Attempts, result.ErrorCode) {
+		retryAt := subscription.NextRetry(sub.RetryPolicy, ledger.Attempts, now)
+		ledger.NextRetryAt = &retryAt
+		return repo.UpdateSubscriptionRun(ctx, ledger)
+	}
+	if err := repo.UpdateSubscriptionRun(ctx, ledger); err != nil {
+		return err
+	}
+
+	to := subscription.ExhaustedStatus(sub.RetryPolicy)
+	if to == "" || !subscription.CanTransition(sub.Status, to) {
+		return nil
+	}
+	return s.lifecycle.Transition(ctx, repo, sub, to, retriesExhaustedReason)
+}
+
+func (s *service) HandleJobFinish(ctx context.Context, data []byte) error {
+	tr := tracer.StartTrace(ctx, "application.event.HandleJobFinish")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var finish JobFinish
+	if !s.decode(ctx, data, &finish) {
+		return nil
+	}
+
+	sub, err := s.repo.GetSubscription(ctx, finish.SubscriptionID)
+	if err != nil {
+		if errors.Is(err, constant.SubscriptionNotFound) {
+			s.resource.Log.Warn(ctx, "job finish for unknown subscription",
+				zap.Uint64("subscriptionId", finish.SubscriptionID))
+			return nil
+		}
+		return err
+	}
+	if finish.FinishedAt.IsZero() {
+		finish.FinishedAt = time.Now()
+	}
+	// Only a run of the ledger finishing for the first time is announced.
+	finished := false
+	err = s.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		ledger, err := s.findRun(ctx, repo, repository.RunKey{
+			CorrelationID:  finish.CorrelationID,
+			SubscriptionID: finish.SubscriptionID,
+			ScheduledAt:    finish.ScheduledAt,
+		})
+		if ledger == nil || err != nil {
+			return err
+		}
+		if ledger.FinishedAt != nil {
+			s.resource.Log.Warn(ctx, "duplicate job finish ignored",
+				zap.Uint64("runId", ledger.ID),
+				zap.Time("finishedAt", *ledger.FinishedAt))
+			return nil
+		}
+		ledger.FinishedAt = &finish.FinishedAt
+		// A finish after the reconciler gave up on it restores the run.
+		if ledger.Status == repository.RunStatusTimedOut && ledger.ErrorCode == repository.RunErrorFinishTimeout {
+			ledger.Status = repository.RunStatusSucceeded
+			ledger.ErrorCode = ""
+			ledger.ErrorMessage = ""
+		}
+		if err := repo.UpdateSubscriptionRun(ctx, ledger); err != nil {
+			return err
+		}
+		finished = true
+		return nil
+	})
+	if err != nil || !finished {
+		return err
+	}
+	s.resource.Log.Info(ctx, "job finished",
+		zap.Uint64("subscriptionId", finish.SubscriptionID),
+		zap.Time("scheduledAt", finish.ScheduledAt))
+	s.runs.Publish(run.Event{
+		SubscriptionID: sub.ID,
+		OwnerID:        sub.OwnerID,
+		ScheduledAt:    finish.ScheduledAt,
+		Type:           run.EventFinished,
+		OccurredAt:     finish.FinishedAt,
+	})
+	return nil
+}
+
+// ignoredResult returns why a result for attempt of ledger is ignored, or ""
+// when the run takes it: a run settled already saw a duplicate, and a result
+// for an attempt other than the last was superseded by a retry. Senders that
+// do not report the attempt send 0.
+func ignoredResult(ledger repository.SubscriptionRun, attempt int) string {
+	if !awaitsResult(ledger) {
+		return "duplicate result for settled run"
+	}
+	if attempt != 0 && attempt != ledger.Attempts {
+		return "result for superseded attempt"
+	}
+	return ""
+}
+
+// awaitsResult reports whether ledger still takes a result: it is triggered,
+// or the reconciler timed it out for want of one.
+func awaitsResult(ledger repository.SubscriptionRun) bool {
+	return ledger.Status == repository.RunStatusTriggered ||
+		ledger.Status == repository.RunStatusTimedOut && ledger.ErrorCode == repository.RunErrorResultTimeout
+}
+
+// findRun locks the ledger entry of key. A result for an occurrence the ledger
+// does not know, such as one fired before the ledger existed, is logged and
+// yields no entry.
+func (s *service) findRun(ctx context.Context, repo *repository.Repository, key repository.RunKey) (*repository.SubscriptionRun, error) {
+	ledger, err := repo.FindSubscriptionRunForUpdate(ctx, key)
+	if errors.Is(err, constant.RunNotFound) {
+		s.resource.Log.Warn(ctx, "result for unknown run",
+			zap.Uint64("subscriptionId", key.SubscriptionID),
+			zap.Time("scheduledAt", key.ScheduledAt),
+			zap.String("correlationId", key.CorrelationID))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ledger, nil
+}
+
+// decode unmarshals and validates a message, logging and reporting false when it can never be processed.
+func (s *service) decode(ctx context.Context, data []byte, v interface{}) bool {
+	err := json.Unmarshal(data, v)
+	if err == nil {
+		err = s.resource.Validator.Struct(v)
+	}
+	if err != nil {
+		s.resource.Log.Error(ctx, "dropping malformed message", err, zap.ByteString("data", data))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"newdemo1/application/run"
+	"newdemo1/application/subscription"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/infrastructure/repository/repositorytest"
+	"newdemo1/resource"
+	"newdemo1/resource/logger"
+	dataValidator "newdemo1/resource/validator"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(context.Context, string, ...zap.Field)         {}
+func (nopLogger) Warn(context.Context, string, ...zap.Field)         {}
+func (nopLogger) Error(context.Context, string, error, ...zap.Field) {}
+
+// newService returns a service on an empty ledger and a watch of the run events it publishes.
+func newService(t *testing.T) (*service, <-chan run.Event) {
+	res := &resource.Resource{
+		Log:       logger.Logger{Logger: nopLogger{}},
+		Validator: dataValidator.Validator{Validate: validator.New()},
+	}
+	runs := run.NewBroadcaster()
+	events, stop := runs.Watch(run.Filter{}, 10)
+	t.Cleanup(stop)
+	return &service{resource: res, repo: repositorytest.New(t), runs: runs, lifecycle: subscription.NewLifecycle(res)}, events
+}
+
+// newRun records a subscription of policy with one run per status, each
+// scheduled an hour after the previous one and correlated by its status.
+func newRun(t *testing.T, repo *repository.Repository, policy repository.RetryPolicy, statuses ...string) (repository.Subscription, []repository.SubscriptionRun) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	sub := repository.Subscription{OwnerID: "owner-1", Schedule: "0 9 * * *", Timezone: "UTC", Amount: 1500,
+		Currency: "IDR", Status: repository.SubscriptionStatusActive, StartAt: start, RetryPolicy: policy}
+	require.NoError(t, repo.CreateSubscription(ctx, &sub))
+	ledgers := make([]repository.SubscriptionRun, len(statuses))
+	for i, status := range statuses {
+		ledgers[i] = repository.SubscriptionRun{SubscriptionID: sub.ID, OwnerID: sub.OwnerID,
+			ScheduledAt: start.Add(time.Duration(i) * time.Hour), TriggeredAt: start, CorrelationID: status,
+			Status: status, Attempts: 1}
+		require.NoError(t, repo.CreateSubscriptionRun(ctx, &ledgers[i]))
+	}
+	return sub, ledgers
+}
+
+func message(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
+
+// drain returns the types of the events published so far.
+func drain(events <-chan run.Event) []string {
+	var types []string
+	for len(events) > 0 {
+		types = append(types, (<-events).Type)
+	}
+	return types
+}
+
+func TestIgnoredResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		ledger  repository.SubscriptionRun
+		attempt int
+		ignored bool
+	}{
+		{name: "triggered", ledger: repository.SubscriptionRun{Status: repository.RunStatusTriggered, Attempts: 1}, attempt: 1},
+		{name: "attempt not reported", ledger: repository.SubscriptionRun{Status: repository.RunStatusTriggered, Attempts: 2}},
+		{name: "superseded attempt", ledger: repository.SubscriptionRun{Status: repository.RunStatusTriggered, Attempts: 2}, attempt: 1, ignored: true},
+		{name: "duplicate after success", ledger: repository.SubscriptionRun{Status: repository.RunStatusSucceeded, Attempts: 1}, attempt: 1, ignored: true},
+		{name: "duplicate after failure", ledger: repository.SubscriptionRun{Status: repository.RunStatusFailed, Attempts: 1}, ignored: true},
+		{name: "skipped", ledger: repository.SubscriptionRun{Status: repository.RunStatusSkipped}, ignored: true},
+		{name: "late after result timeout", ledger: repository.SubscriptionRun{Status: repository.RunStatusTimedOut,
+			ErrorCode: repository.RunErrorResultTimeout, Attempts: 1}, attempt: 1},
+		{name: "after finish timeout", ledger: repository.SubscriptionRun{Status: repository.RunStatusTimedOut,
+			ErrorCode: repository.RunErrorFinishTimeout, Attempts: 1}, attempt: 1, ignored: true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ignored, ignoredResult(tt.ledger, tt.attempt) != "", tt.name)
+	}
+}
+
+func TestHappenResultErrorCode(t *testing.T) {
+	result := HappenResult{SubscriptionID: 1, ScheduledAt: time.Now(), Status: "failed", ErrorCode: strings.Repeat("e", 64)}
+	assert.NoError(t, validator.New().Struct(result))
+
+	// The run ledger keeps 64 characters of error code.
+	result.ErrorCode += "e"
+	assert.Error(t, validator.New().Struct(result))
+}
+
+func TestHandleHappenResult(t *testing.T) {
+	ctx := context.Background()
+	s, events := newService(t)
+	sub, ledgers := newRun(t, s.repo, repository.RetryPolicy{MaxAttempts: 2, InitialBackoffMs: 1000, Multiplier: 2},
+		repository.RunStatusTriggered, repository.RunStatusTimedOut)
+	result := func(ledger repository.SubscriptionRun, attempt int, status string) []byte {
+		return message(t, HappenResult{SubscriptionID: sub.ID, ScheduledAt: ledger.ScheduledAt,
+			CorrelationID: ledger.CorrelationID, Attempt: attempt, Status: status, ErrorCode: "insufficient_funds"})
+	}
+
+	// A failure within the retry policy waits for its retry.
+	require.NoError(t, s.HandleHappenResult(ctx, result(ledgers[0], 1, ResultFailed)))
+	failed, err := s.repo.GetSubscriptionRun(ctx, ledgers[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusFailed, failed.Status)
+	assert.Equal(t, "insufficient_funds", failed.ErrorCode)
+	require.NotNil(t, failed.NextRetryAt)
+	assert.Equal(t, []string{run.EventFailed}, drain(events))
+
+	// A duplicate, and a result of an attempt a retry superseded, are ignored.
+	require.NoError(t, s.HandleHappenResult(ctx, result(ledgers[0], 1, ResultSuccess)))
+	failed.Status, failed.Attempts, failed.NextRetryAt = repository.RunStatusTriggered, 2, nil
+	require.NoError(t, s.repo.UpdateSubscriptionRun(ctx, &failed))
+	require.NoError(t, s.HandleHappenResult(ctx, result(ledgers[0], 1, ResultSuccess)))
+	assert.Empty(t, drain(events))
+
+	// The failure of the last attempt the policy allows pauses the subscription.
+	require.NoError(t, s.HandleHappenResult(ctx, result(ledgers[0], 2, ResultFailed)))
+	exhausted, err := s.repo.GetSubscriptionRun(ctx, ledgers[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusFailed, exhausted.Status)
+	assert.Nil(t, exhausted.NextRetryAt)
+	paused, err := s.repo.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.SubscriptionStatusPaused, paused.Status)
+	assert.Equal(t, retriesExhaustedReason, paused.StatusReason)
+	assert.Equal(t, []string{run.EventFailed}, drain(events))
+
+	// A late success settles a run the reconciler timed out for want of one.
+	ledgers[1].ErrorCode = repository.RunErrorResultTimeout
+	require.NoError(t, s.repo.UpdateSubscriptionRun(ctx, &ledgers[1]))
+	require.NoError(t, s.HandleHappenResult(ctx, result(ledgers[1], 1, ResultSuccess)))
+	succeeded, err := s.repo.GetSubscriptionRun(ctx, ledgers[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusSucceeded, succeeded.Status)
+	assert.Empty(t, succeeded.ErrorCode)
+	assert.NotNil(t, succeeded.ResultAt)
+	assert.Equal(t, []string{run.EventSucceeded}, drain(events))
+}
+
+func TestHandleJobFinish(t *testing.T) {
+	ctx := context.Background()
+	s, events := newService(t)
+	sub, ledgers := newRun(t, s.repo, repository.RetryPolicy{}, repository.RunStatusTimedOut)
+	ledgers[0].ErrorCode = repository.RunErrorFinishTimeout
+	ledgers[0].ErrorMessage = "no job finish within 6h0m0s of its result"
+	require.NoError(t, s.repo.UpdateSubscriptionRun(ctx, &ledgers[0]))
+	finish := message(t, JobFinish{SubscriptionID: sub.ID, ScheduledAt: ledgers[0].ScheduledAt,
+		FinishedAt: time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC)})
+
+	// A finish after the reconciler gave up on it restores the run.
+	require.NoError(t, s.HandleJobFinish(ctx, finish))
+	restored, err := s.repo.GetSubscriptionRun(ctx, ledgers[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusSucceeded, restored.Status)
+	assert.Empty(t, restored.ErrorCode)
+	assert.Empty(t, restored.ErrorMessage)
+	require.NotNil(t, restored.FinishedAt)
+	assert.Equal(t, []string{run.EventFinished}, drain(events))
+
+	// A duplicate finish, or one of a run the ledger does not know, is not announced.
+	require.NoError(t, s.HandleJobFinish(ctx, finish))
+	require.NoError(t, s.HandleJobFinish(ctx, message(t, JobFinish{SubscriptionID: sub.ID,
+		ScheduledAt: ledgers[0].ScheduledAt.Add(24 * time.Hour)})))
+	require.NoError(t, s.HandleJobFinish(ctx, message(t, JobFinish{SubscriptionID: sub.ID + 1,
+		ScheduledAt: ledgers[0].ScheduledAt})))
+	assert.Empty(t, drain(events))
+}
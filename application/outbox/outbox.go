@@ -0,0 +1,205 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redsync/redsync/v4"
+	"go.uber.org/zap"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/mq/pubsub1"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/infrastructure/sync"
+	"newdemo1/resource"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+const (
+	lockKey            = "recurring:outbox-relay"
+	defaultInterval    = 2 * time.Second
+	defaultBatchSize   = 100
+	defaultBaseBackoff = time.Second
+	defaultMaxBackoff  = 5 * time.Minute
+	defaultRetention   = 7 * 24 * time.Hour
+	pruneInterval      = time.Hour
+	pruneBatchSize     = 1000
+)
+
+type (
+	Relay interface {
+		// Run relays until ctx is cancelled.
+		Run(ctx context.Context)
+		// Relay publishes the pending messages that are due.
+		Relay(ctx context.Context) error
+	}
+	relay struct {
+		resource    *resource.Resource
+		repo        *repository.Repository
+		pubsub      pubsub1.Client
+		sync        sync.Sync
+		interval    time.Duration
+		batchSize   int
+		baseBackoff time.Duration
+		maxBackoff  time.Duration
+		retention   time.Duration
+		// prunedAt is when this replica last deleted the sent messages.
+		prunedAt time.Time
+	}
+)
+
+func NewRelay(resource *resource.Resource, infrastructure *infrastructure.Infrastructure) Relay {
+	cfg := resource.Config.Outbox
+	r := &relay{
+		resource:    resource,
+		repo:        infrastructure.Store.Repository,
+		pubsub:      infrastructure.MQ.PubSub(),
+		sync:        infrastructure.Sync,
+		interval:    cfg.Interval,
+		batchSize:   cfg.BatchSize,
+		baseBackoff: cfg.BaseBackoff,
+		maxBackoff:  cfg.MaxBackoff,
+		retention:   cfg.Retention,
+	}
+	if r.interval <= 0 {
+		r.interval = defaultInterval
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = defaultBatchSize
+	}
+	if r.baseBackoff <= 0 {
+		r.baseBackoff = defaultBaseBackoff
+	}
+	if r.maxBackoff <= 0 {
+		r.maxBackoff = defaultMaxBackoff
+	}
+	if r.retention <= 0 {
+		r.retention = defaultRetention
+	}
+	return r
+}
+
+// Enqueue records message for topic through repo, which should be the
+// repository of the transaction that makes the change the message announces.
+// The trace context of ctx travels with the row so the relay continues the trace.
+func Enqueue(ctx context.Context, repo *repository.Repository, topic string, message *pubsub1.Message) error {
+	pubsub1.InjectTrace(ctx, message)
+	return repo.CreateOutboxMessage(ctx, &repository.OutboxMessage{
+		Topic:         topic,
+		Data:          message.Data,
+		Attributes:    message.Attributes,
+		Status:        repository.OutboxStatusPending,
+		NextAttemptAt: time.Now(),
+	})
+}
+
+func (r *relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Relay(ctx); err != nil {
+			r.resource.Log.Error(ctx, "outbox relay failed", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *relay) Relay(ctx context.Context) error {
+	// Only the replica holding the lock relays, so replicas do not publish the same rows.
+	unlock, err := r.sync.Lock(ctx, lockKey, redsync.WithTries(1), redsync.WithExpiry(r.interval))
+	if errors.Is(err, redsync.ErrFailed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = unlock.Unlock(context.Background())
+	}()
+	extendedAt := time.Now()
+
+	tr := tracer.StartTrace(ctx, "application.outbox.Relay")
+	pending, err := r.repo.ListPendingOutboxMessages(tr.Context(), time.Now(), r.batchSize)
+	tr.Finish()
+	if err != nil {
+		return err
+	}
+	// Each message is published in the trace it was enqueued in, not the relay's.
+	// The lock is extended while the batch runs past half its expiry, and the
+	// batch stops once it is lost, before another replica lists the same rows.
+	for _, message := range pending {
+		if time.Since(extendedAt) > r.interval/2 {
+			if err := unlock.Extend(ctx); err != nil {
+				return err
+			}
+			extendedAt = time.Now()
+		}
+		if err := r.publish(ctx, message); err != nil {
+			r.resource.Log.Error(ctx, "failed to relay outbox message", err,
+				zap.Uint64("outboxId", message.ID),
+				zap.String("topic", message.Topic),
+				zap.Int("attempts", message.Attempts))
+		}
+	}
+	if time.Since(r.prunedAt) >= pruneInterval {
+		r.prune(ctx)
+	}
+	return nil
+}
+
+// prune deletes a batch of the messages sent longer ago than the retention.
+func (r *relay) prune(ctx context.Context) {
+	tr := tracer.StartTrace(ctx, "application.outbox.prune")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	deleted, err := r.repo.DeleteSentOutboxMessages(ctx, time.Now().Add(-r.retention), pruneBatchSize)
+	if err != nil {
+		r.resource.Log.Error(ctx, "failed to prune sent outbox messages", err)
+		return
+	}
+	// A full batch means more are left; the next relay deletes them.
+	if deleted < pruneBatchSize {
+		r.prunedAt = time.Now()
+	}
+}
+
+// publish sends one row, marking it sent or scheduling its next attempt.
+func (r *relay) publish(ctx context.Context, row repository.OutboxMessage) error {
+	message := pubsub1.NewMessage(row.Data, row.Attributes)
+	tr := tracer.StartTrace(pubsub1.ExtractTrace(ctx, message), "application.outbox.publish")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	publishErr := r.pubsub.Publish(ctx, row.Topic, message)
+	if publishErr == nil {
+		return r.repo.MarkOutboxMessageSent(ctx, row.ID, time.Now())
+	}
+
+	attempts := row.Attempts + 1
+	next := time.Now().Add(Backoff(attempts, r.baseBackoff, r.maxBackoff))
+	if err := r.repo.MarkOutboxMessageFailed(ctx, row.ID, attempts, next, publishErr.Error()); err != nil {
+		return err
+	}
+	return publishErr
+}
+
+// Backoff returns the delay before the given attempt: base doubled for every
+// earlier failure, capped at max.
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max || delay <= 0 {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
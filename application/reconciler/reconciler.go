@@ -0,0 +1,247 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redsync/redsync/v4"
+	"go.uber.org/zap"
+	"newdemo1/application/run"
+	"newdemo1/application/scheduler"
+	"newdemo1/constant"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/infrastructure/sync"
+	"newdemo1/resource"
+	"newdemo1/resource/jaeger/common/telemetry"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+const (
+	ActionRepublish = "republish"
+	ActionTimeout   = "timeout"
+
+	lockKey              = "recurring:reconciler"
+	stuckMetric          = "recurring.reconciler.stuck"
+	reconciledMetric     = "recurring.reconciler.reconciled"
+	defaultInterval      = time.Minute
+	defaultBatchSize     = 100
+	defaultResultTimeout = 15 * time.Minute
+	defaultFinishTimeout = 6 * time.Hour
+	defaultAction        = ActionRepublish
+	defaultMaxRepublish  = 3
+)
+
+type (
+	Reconciler interface {
+		// Run reconciles until ctx is cancelled.
+		Run(ctx context.Context)
+		// Reconcile reports the backlog of stuck runs and settles a batch of them.
+		Reconcile(ctx context.Context) error
+	}
+	reconciler struct {
+		resource      *resource.Resource
+		repo          *repository.Repository
+		sync          sync.Sync
+		metrics       telemetry.Metrics
+		runs          *run.Broadcaster
+		interval      time.Duration
+		batchSize     int
+		resultTimeout time.Duration
+		finishTimeout time.Duration
+		action        string
+		maxRepublish  int
+	}
+)
+
+func NewReconciler(resource *resource.Resource, infrastructure *infrastructure.Infrastructure, runs *run.Broadcaster) Reconciler {
+	cfg := resource.Config.Reconciler
+	r := &reconciler{
+		resource:      resource,
+		repo:          infrastructure.Store.Repository,
+		sync:          infrastructure.Sync,
+		metrics:       resource.Datadog.Metrics(),
+		runs:          runs,
+		interval:      cfg.Interval,
+		batchSize:     cfg.BatchSize,
+		resultTimeout: cfg.ResultTimeout,
+		finishTimeout: cfg.FinishTimeout,
+		action:        cfg.Action,
+		maxRepublish:  cfg.MaxRepublish,
+	}
+	if r.interval <= 0 {
+		r.interval = defaultInterval
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = defaultBatchSize
+	}
+	if r.resultTimeout <= 0 {
+		r.resultTimeout = defaultResultTimeout
+	}
+	if r.finishTimeout <= 0 {
+		r.finishTimeout = defaultFinishTimeout
+	}
+	if r.action == "" {
+		r.action = defaultAction
+	}
+	if r.maxRepublish <= 0 {
+		r.maxRepublish = defaultMaxRepublish
+	}
+	return r
+}
+
+func (r *reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Reconcile(ctx); err != nil {
+			r.resource.Log.Error(ctx, "run reconciliation failed", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *reconciler) Reconcile(ctx context.Context) error {
+	// Only the replica holding the lock reconciles, and reports the backlog once.
+	unlock, err := r.sync.Lock(ctx, lockKey, redsync.WithTries(1), redsync.WithExpiry(r.interval))
+	if errors.Is(err, redsync.ErrFailed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = unlock.Unlock(context.Background())
+	}()
+
+	tr := tracer.StartTrace(ctx, "application.reconciler.Reconcile")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	now := time.Now()
+	resultBefore, finishBefore := now.Add(-r.resultTimeout), now.Add(-r.finishTimeout)
+	awaitingResult, awaitingFinish, err := r.repo.CountStuckSubscriptionRuns(ctx, resultBefore, finishBefore)
+	if err != nil {
+		return err
+	}
+	r.gauge("result", awaitingResult)
+	r.gauge("finish", awaitingFinish)
+	if awaitingResult+awaitingFinish == 0 {
+		return nil
+	}
+
+	stuck, err := r.repo.ListStuckSubscriptionRuns(ctx, resultBefore, finishBefore, r.batchSize)
+	if err != nil {
+		return err
+	}
+	for _, ledger := range stuck {
+		if err := r.reconcile(ctx, ledger, resultBefore, finishBefore); err != nil {
+			r.resource.Log.Error(ctx, "failed to reconcile run", err,
+				zap.Uint64("runId", ledger.ID),
+				zap.Uint64("subscriptionId", ledger.SubscriptionID))
+		}
+	}
+	return nil
+}
+
+// reconcile publishes a stuck run again or times it out, unless a result or
+// job finish arrived since it was listed.
+func (r *reconciler) reconcile(ctx context.Context, due repository.SubscriptionRun, resultBefore, finishBefore time.Time) error {
+	var (
+		action string
+		event  *run.Event
+	)
+	err := r.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		// Lock the subscription before the run, in the order results do.
+		sub, err := repo.GetSubscriptionForUpdate(ctx, due.SubscriptionID)
+		if err != nil && !errors.Is(err, constant.SubscriptionNotFound) {
+			return err
+		}
+		ledger, err := repo.GetSubscriptionRunForUpdate(ctx, due.ID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		switch {
+		case ledger.Status == repository.RunStatusTriggered && ledger.UpdatedAt.Before(resultBefore):
+			republishable := sub.Status == repository.SubscriptionStatusActive && ledger.ReplacedBy == nil
+			action = decide(r.action, ledger.Republished, r.maxRepublish, republishable)
+			if action == ActionRepublish {
+				ledger.Republished++
+				if err := scheduler.EnqueueHappen(ctx, repo, r.resource.Config.Pubsub.PublishTopic.RecurringHappen, sub, ledger); err != nil {
+					return err
+				}
+				break
+			}
+			ledger.Status = repository.RunStatusTimedOut
+			ledger.ErrorCode = repository.RunErrorResultTimeout
+			ledger.ErrorMessage = fmt.Sprintf("no happen result after %d publications", ledger.Republished+1)
+		case ledger.Status == repository.RunStatusSucceeded && ledger.FinishedAt == nil &&
+			ledger.ResultAt != nil && ledger.ResultAt.Before(finishBefore):
+			action = ActionTimeout
+			ledger.Status = repository.RunStatusTimedOut
+			ledger.ErrorCode = repository.RunErrorFinishTimeout
+			ledger.ErrorMessage = fmt.Sprintf("no job finish within %s of its result", r.finishTimeout)
+		default:
+			return nil
+		}
+		if err := repo.UpdateSubscriptionRun(ctx, &ledger); err != nil {
+			return err
+		}
+
+		r.resource.Log.Warn(ctx, "reconciled stuck run",
+			zap.Uint64("runId", ledger.ID),
+			zap.Uint64("subscriptionId", ledger.SubscriptionID),
+			zap.Time("scheduledAt", ledger.ScheduledAt),
+			zap.String("action", action),
+			zap.String("errorCode", ledger.ErrorCode))
+		eventType := run.EventTimedOut
+		if action == ActionRepublish {
+			eventType = run.EventRepublished
+		}
+		event = &run.Event{
+			SubscriptionID: ledger.SubscriptionID,
+			OwnerID:        ledger.OwnerID,
+			ScheduledAt:    ledger.ScheduledAt,
+			Type:           eventType,
+			ErrorCode:      ledger.ErrorCode,
+			ErrorMessage:   ledger.ErrorMessage,
+			OccurredAt:     now,
+		}
+		return nil
+	})
+	if err != nil || event == nil {
+		return err
+	}
+	r.runs.Publish(*event)
+	r.metrics.Count(reconciledMetric, 1, []string{
+		"action:" + action,
+		"src_env:" + r.resource.Config.Telemetry.Tracer.SourceEnv,
+	})
+	return nil
+}
+
+// gauge reports how many runs are stuck waiting for kind, a result or a finish.
+func (r *reconciler) gauge(kind string, count int64) {
+	r.metrics.Gauge(stuckMetric, float64(count), []string{
+		"kind:" + kind,
+		"src_env:" + r.resource.Config.Telemetry.Tracer.SourceEnv,
+	})
+}
+
+// decide returns what to do with a run without result that was republished
+// republished times. Only a run of an active subscription that was not replaced
+// is published again.
+func decide(action string, republished, maxRepublish int, active bool) string {
+	if action == ActionRepublish && active && republished < maxRepublish {
+		return ActionRepublish
+	}
+	return ActionTimeout
+}
@@ -0,0 +1,159 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"newdemo1/application/run"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/infrastructure/repository/repositorytest"
+	"newdemo1/infrastructure/sync"
+	"newdemo1/resource"
+	"newdemo1/resource/jaeger/common/telemetry"
+	"newdemo1/resource/logger"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(context.Context, string, ...zap.Field)         {}
+func (nopLogger) Warn(context.Context, string, ...zap.Field)         {}
+func (nopLogger) Error(context.Context, string, error, ...zap.Field) {}
+
+// locks grants every lock, as a replica alone does.
+type locks struct{}
+
+func (locks) Lock(context.Context, string, ...redsync.Option) (sync.Unlock, error) {
+	return unlocked{}, nil
+}
+
+type unlocked struct{}
+
+func (unlocked) Unlock(context.Context) error { return nil }
+func (unlocked) Extend(context.Context) error { return nil }
+
+// metrics records the counts and gauges reported, keyed by name and tags.
+type metrics struct {
+	telemetry.Metrics
+	counts map[string]int64
+	gauges map[string]float64
+}
+
+func (m *metrics) Count(name string, value int64, tags []string) {
+	m.counts[name+" "+strings.Join(tags, ",")] += value
+}
+
+func (m *metrics) Gauge(name string, value float64, tags []string) {
+	m.gauges[name+" "+strings.Join(tags, ",")] = value
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	repo := repositorytest.New(t)
+	res := &resource.Resource{Log: logger.Logger{Logger: nopLogger{}}}
+	res.Config.Pubsub.PublishTopic.RecurringHappen = "recurring-happen"
+	m := &metrics{counts: map[string]int64{}, gauges: map[string]float64{}}
+	runs := run.NewBroadcaster()
+	events, stop := runs.Watch(run.Filter{}, 10)
+	defer stop()
+	r := &reconciler{resource: res, repo: repo, sync: locks{}, metrics: m, runs: runs,
+		batchSize: 10, resultTimeout: 15 * time.Minute, finishTimeout: 6 * time.Hour,
+		action: ActionRepublish, maxRepublish: 2}
+
+	now := time.Now().UTC()
+	sub := repository.Subscription{OwnerID: "owner-1", Schedule: "0 9 * * *", Timezone: "UTC",
+		Amount: 1500, Currency: "IDR", Status: repository.SubscriptionStatusActive, StartAt: now}
+	require.NoError(t, repo.CreateSubscription(ctx, &sub))
+	stale, late := now.Add(-time.Hour), now.Add(-7*time.Hour)
+	ledgers := []repository.SubscriptionRun{
+		// Published once without result: published again.
+		{Status: repository.RunStatusTriggered, Attempts: 1, UpdatedAt: stale},
+		// Published as often as allowed: timed out.
+		{Status: repository.RunStatusTriggered, Attempts: 1, Republished: 2, UpdatedAt: stale},
+		// Succeeded without a job finish for too long: timed out.
+		{Status: repository.RunStatusSucceeded, Attempts: 1, ResultAt: &late, UpdatedAt: late},
+		// Still within its timeout: left alone.
+		{Status: repository.RunStatusTriggered, Attempts: 1},
+	}
+	for i := range ledgers {
+		ledgers[i].SubscriptionID = sub.ID
+		ledgers[i].OwnerID = sub.OwnerID
+		ledgers[i].ScheduledAt = now.Add(time.Duration(i-10) * time.Hour).Truncate(time.Second)
+		ledgers[i].TriggeredAt = ledgers[i].ScheduledAt
+		ledgers[i].CorrelationID = fmt.Sprintf("run-%d", i)
+		require.NoError(t, repo.CreateSubscriptionRun(ctx, &ledgers[i]))
+	}
+
+	require.NoError(t, r.Reconcile(ctx))
+
+	assert.Equal(t, map[string]float64{
+		"recurring.reconciler.stuck kind:result,src_env:": 2,
+		"recurring.reconciler.stuck kind:finish,src_env:": 1,
+	}, m.gauges)
+	assert.Equal(t, map[string]int64{
+		"recurring.reconciler.reconciled action:republish,src_env:": 1,
+		"recurring.reconciler.reconciled action:timeout,src_env:":   2,
+	}, m.counts)
+
+	republished, err := repo.GetSubscriptionRun(ctx, ledgers[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusTriggered, republished.Status)
+	assert.Equal(t, 1, republished.Republished)
+	pending, err := repo.ListPendingOutboxMessages(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "recurring-happen", pending[0].Topic)
+	assert.Equal(t, "run-0", pending[0].Attributes["correlationId"])
+
+	exhausted, err := repo.GetSubscriptionRun(ctx, ledgers[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusTimedOut, exhausted.Status)
+	assert.Equal(t, repository.RunErrorResultTimeout, exhausted.ErrorCode)
+	assert.Equal(t, "no happen result after 3 publications", exhausted.ErrorMessage)
+
+	unfinished, err := repo.GetSubscriptionRun(ctx, ledgers[2].ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusTimedOut, unfinished.Status)
+	assert.Equal(t, repository.RunErrorFinishTimeout, unfinished.ErrorCode)
+
+	fresh, err := repo.GetSubscriptionRun(ctx, ledgers[3].ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusTriggered, fresh.Status)
+	assert.Zero(t, fresh.Republished)
+
+	types := map[string]int{}
+	for len(events) > 0 {
+		types[(<-events).Type]++
+	}
+	assert.Equal(t, map[string]int{run.EventRepublished: 1, run.EventTimedOut: 2}, types)
+
+	// The runs it timed out are no longer stuck; the republished one waits again.
+	require.NoError(t, r.Reconcile(ctx))
+	assert.Zero(t, m.gauges["recurring.reconciler.stuck kind:result,src_env:"])
+	assert.Zero(t, m.gauges["recurring.reconciler.stuck kind:finish,src_env:"])
+}
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		action      string
+		republished int
+		active      bool
+		want        string
+	}{
+		{action: ActionRepublish, republished: 0, active: true, want: ActionRepublish},
+		{action: ActionRepublish, republished: 2, active: true, want: ActionRepublish},
+		{action: ActionRepublish, republished: 3, active: true, want: ActionTimeout},
+		{action: ActionRepublish, republished: 0, active: false, want: ActionTimeout},
+		{action: ActionTimeout, republished: 0, active: true, want: ActionTimeout},
+	}
+	for _, tt := range tests {
+		got := decide(tt.action, tt.republished, 3, tt.active)
+		assert.Equal(t, tt.want, got, "%s after %d, active %v", tt.action, tt.republished, tt.active)
+	}
+}
@@ -0,0 +1,203 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronHorizon is how far ahead Next searches before giving up on a cron
+// expression that can never match (e.g. "0 0 30 2 *").
+const cronHorizon = 8
+
+var (
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+	monthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	dayNames = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+)
+
+// cron is a standard five-field expression: minute hour day-of-month month day-of-week.
+// Day-of-month additionally accepts "L" (last day) and "LW" (last weekday).
+// When both day fields are restricted a day matches if either does.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	lastDay, lastWeekday          bool
+	start                         time.Time
+}
+
+func parseCron(expr string, start time.Time) (Rule, error) {
+	if descriptor, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("recurrence: cron expression %q must have 5 fields", expr)
+	}
+
+	c := &cron{start: start}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	switch strings.ToUpper(fields[2]) {
+	case "L":
+		c.lastDay = true
+	case "LW":
+		c.lastWeekday = true
+	default:
+		if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+			return nil, err
+		}
+		c.domStar = fields[2] == "*" || fields[2] == "?"
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.dowStar = fields[4] == "*" || fields[4] == "?"
+	return c, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step, hasStep := 1, false
+		if i := strings.Index(part, "/"); i >= 0 {
+			hasStep = true
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("recurrence: invalid step in %q", field)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = cronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(bounds[1], names); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if lo, err = cronValue(part, names); err != nil {
+				return 0, err
+			}
+			if !hasStep {
+				hi = lo
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("recurrence: value out of range in %q", field)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("recurrence: invalid cron value %q", s)
+	}
+	return v, nil
+}
+
+// Next walks the wall clock of the start location rather than absolute time,
+// so an occurrence DST repeats fires once and one it skips fires when the
+// clocks jump past it.
+func (c *cron) Next(after time.Time) (time.Time, bool) {
+	if after.Before(c.start) {
+		after = c.start.Add(-time.Nanosecond)
+	}
+	loc := c.start.Location()
+	w := wallClock(after.In(loc)).Truncate(time.Minute).Add(time.Minute)
+	horizon := w.Year() + cronHorizon
+
+	for w.Year() <= horizon {
+		if c.month&(1<<uint(w.Month())) == 0 {
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.dayMatches(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<uint(w.Hour())) == 0 {
+			w = time.Date(w.Year(), w.Month(), w.Day(), w.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.minute&(1<<uint(w.Minute())) == 0 {
+			w = w.Add(time.Minute)
+			continue
+		}
+		// The first instant of a repeated wall time may be the one already fired.
+		if t := instant(w, loc); t.After(after) {
+			return t, true
+		}
+		w = w.Add(time.Minute)
+	}
+	return time.Time{}, false
+}
+
+func (c *cron) Between(from, to time.Time) []time.Time {
+	return between(c, from, to)
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	last := daysIn(t.Year(), t.Month())
+	domMatch := c.dom&(1<<uint(t.Day())) != 0 ||
+		(c.lastDay && t.Day() == last) ||
+		(c.lastWeekday && t.Day() == lastWeekdayOf(t.Year(), t.Month()))
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func lastWeekdayOf(year int, month time.Month) int {
+	day := daysIn(year, month)
+	for {
+		switch time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday() {
+		case time.Saturday, time.Sunday:
+			day--
+		default:
+			return day
+		}
+	}
+}
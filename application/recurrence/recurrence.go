@@ -0,0 +1,118 @@
+package recurrence
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// LastBusinessDay is the RRULE for the last Monday-to-Friday of every month.
+const LastBusinessDay = "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1"
+
+// maxOccurrences bounds Between so a dense rule over a wide window cannot exhaust memory.
+const maxOccurrences = 10000
+
+var ErrNoOccurrence = errors.New("recurrence: rule yields no occurrence")
+
+// Rule computes the occurrences of a recurring schedule.
+type Rule interface {
+	// Next returns the first occurrence strictly after the given time.
+	// It reports false once the rule is exhausted by COUNT or UNTIL.
+	Next(after time.Time) (time.Time, bool)
+	// Between returns the occurrences in [from, to).
+	Between(from, to time.Time) []time.Time
+}
+
+// Parse builds a Rule from a cron expression or an iCalendar RRULE.
+// start anchors the rule: no occurrence is earlier than start and its location
+// is the zone wall-clock fields are evaluated in. A DTSTART line in an RRULE
+// overrides start.
+func Parse(expr string, start time.Time) (Rule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errors.New("recurrence: empty expression")
+	}
+
+	var (
+		rule Rule
+		err  error
+	)
+	upper := strings.ToUpper(expr)
+	if strings.HasPrefix(upper, "RRULE:") || strings.HasPrefix(upper, "DTSTART") || strings.Contains(upper, "FREQ=") {
+		rule, err = parseRRule(expr, start)
+	} else {
+		rule, err = parseCron(expr, start)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := rule.Next(start.Add(-time.Nanosecond)); !ok {
+		return nil, ErrNoOccurrence
+	}
+	return rule, nil
+}
+
+func between(rule Rule, from, to time.Time) []time.Time {
+	var occurrences []time.Time
+	cursor := from.Add(-time.Nanosecond)
+	for len(occurrences) < maxOccurrences {
+		next, ok := rule.Next(cursor)
+		if !ok || !next.Before(to) {
+			break
+		}
+		occurrences = append(occurrences, next)
+		cursor = next
+	}
+	return occurrences
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// wallClock returns the wall-clock fields of t as a UTC time, where adding
+// minutes or days never crosses a DST transition.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// instant returns the first instant loc shows the wall clock w at, w holding
+// wall-clock fields as wallClock returns them. A wall time DST repeats is the
+// first of its two instants, and one a DST gap skips is the instant the clocks
+// jump past it, so it is neither fired twice nor lost.
+func instant(w time.Time, loc *time.Location) time.Time {
+	var first, lo, hi time.Time
+	for _, probe := range []time.Time{w.AddDate(0, 0, -1), w, w.AddDate(0, 0, 1)} {
+		_, offset := probe.In(loc).Zone()
+		candidate := w.Add(-time.Duration(offset) * time.Second)
+		if wallClock(candidate.In(loc)).Equal(w) {
+			if first.IsZero() || candidate.Before(first) {
+				first = candidate
+			}
+			continue
+		}
+		if lo.IsZero() || candidate.Before(lo) {
+			lo = candidate
+		}
+		if hi.IsZero() || candidate.After(hi) {
+			hi = candidate
+		}
+	}
+	if !first.IsZero() {
+		return first.In(loc)
+	}
+	if lo.Equal(hi) {
+		return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), loc)
+	}
+	// w falls in a gap: the wall clock is before it at lo and after it at hi.
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+		if wallClock(mid.In(loc)).After(w) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi.In(loc)
+}
@@ -0,0 +1,351 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		start time.Time
+		after time.Time
+		want  []time.Time
+	}{
+		{
+			name:  "cron every 15 minutes",
+			expr:  "*/15 * * * *",
+			start: date(2024, 1, 1, 0, 0),
+			after: date(2024, 1, 1, 10, 7),
+			want:  []time.Time{date(2024, 1, 1, 10, 15), date(2024, 1, 1, 10, 30)},
+		},
+		{
+			name:  "cron 31st skips short months",
+			expr:  "0 9 31 * *",
+			start: date(2024, 1, 1, 0, 0),
+			after: date(2024, 1, 31, 9, 0),
+			want:  []time.Time{date(2024, 3, 31, 9, 0), date(2024, 5, 31, 9, 0)},
+		},
+		{
+			name:  "cron last day of month in leap year",
+			expr:  "0 9 L * *",
+			start: date(2024, 1, 1, 0, 0),
+			after: date(2024, 1, 31, 9, 0),
+			want:  []time.Time{date(2024, 2, 29, 9, 0), date(2024, 3, 31, 9, 0), date(2024, 4, 30, 9, 0)},
+		},
+		{
+			name:  "cron last day of month in common year",
+			expr:  "0 9 L * *",
+			start: date(2023, 1, 1, 0, 0),
+			after: date(2023, 1, 31, 9, 0),
+			want:  []time.Time{date(2023, 2, 28, 9, 0)},
+		},
+		{
+			name:  "cron last weekday of month",
+			expr:  "30 8 LW * *",
+			start: date(2024, 8, 1, 0, 0),
+			after: date(2024, 8, 1, 0, 0),
+			want:  []time.Time{date(2024, 8, 30, 8, 30), date(2024, 9, 30, 8, 30), date(2024, 10, 31, 8, 30)},
+		},
+		{
+			name:  "cron leap day waits for next leap year",
+			expr:  "0 0 29 2 *",
+			start: date(2024, 1, 1, 0, 0),
+			after: date(2024, 3, 1, 0, 0),
+			want:  []time.Time{date(2028, 2, 29, 0, 0)},
+		},
+		{
+			name:  "cron day of month or day of week",
+			expr:  "0 0 1 * MON",
+			start: date(2024, 1, 1, 0, 0),
+			after: date(2024, 1, 27, 0, 0),
+			want:  []time.Time{date(2024, 1, 29, 0, 0), date(2024, 2, 1, 0, 0), date(2024, 2, 5, 0, 0)},
+		},
+		{
+			name:  "cron descriptor",
+			expr:  "@monthly",
+			start: date(2024, 1, 1, 0, 0),
+			after: date(2024, 1, 15, 0, 0),
+			want:  []time.Time{date(2024, 2, 1, 0, 0), date(2024, 3, 1, 0, 0)},
+		},
+		{
+			name:  "cron never before start",
+			expr:  "0 12 * * *",
+			start: date(2024, 6, 10, 13, 0),
+			after: date(2024, 1, 1, 0, 0),
+			want:  []time.Time{date(2024, 6, 11, 12, 0)},
+		},
+		{
+			name:  "rrule daily with interval",
+			expr:  "FREQ=DAILY;INTERVAL=3",
+			start: date(2024, 2, 27, 7, 0),
+			after: date(2024, 2, 27, 7, 0),
+			want:  []time.Time{date(2024, 3, 1, 7, 0), date(2024, 3, 4, 7, 0)},
+		},
+		{
+			name:  "rrule weekly every other monday and friday",
+			expr:  "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			start: date(2024, 1, 1, 9, 0),
+			after: date(2024, 1, 1, 9, 0),
+			want:  []time.Time{date(2024, 1, 5, 9, 0), date(2024, 1, 15, 9, 0), date(2024, 1, 19, 9, 0)},
+		},
+		{
+			name:  "rrule monthly on the 31st skips short months",
+			expr:  "FREQ=MONTHLY",
+			start: date(2024, 1, 31, 9, 0),
+			after: date(2024, 1, 31, 9, 0),
+			want:  []time.Time{date(2024, 3, 31, 9, 0), date(2024, 5, 31, 9, 0)},
+		},
+		{
+			name:  "rrule month end with negative month day",
+			expr:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: date(2024, 1, 31, 9, 0),
+			after: date(2024, 1, 31, 9, 0),
+			want:  []time.Time{date(2024, 2, 29, 9, 0), date(2024, 3, 31, 9, 0), date(2024, 4, 30, 9, 0)},
+		},
+		{
+			name:  "rrule month end in common year",
+			expr:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: date(2023, 1, 31, 9, 0),
+			after: date(2023, 1, 31, 9, 0),
+			want:  []time.Time{date(2023, 2, 28, 9, 0)},
+		},
+		{
+			name:  "rrule last business day",
+			expr:  LastBusinessDay,
+			start: date(2024, 3, 1, 10, 0),
+			after: date(2024, 3, 1, 10, 0),
+			want:  []time.Time{date(2024, 3, 29, 10, 0), date(2024, 4, 30, 10, 0), date(2024, 5, 31, 10, 0), date(2024, 6, 28, 10, 0)},
+		},
+		{
+			name:  "rrule first monday and last friday",
+			expr:  "FREQ=MONTHLY;BYDAY=1MO,-1FR",
+			start: date(2024, 2, 1, 8, 0),
+			after: date(2024, 2, 1, 8, 0),
+			want:  []time.Time{date(2024, 2, 5, 8, 0), date(2024, 2, 23, 8, 0), date(2024, 3, 4, 8, 0), date(2024, 3, 29, 8, 0)},
+		},
+		{
+			name:  "rrule yearly on leap day",
+			expr:  "FREQ=YEARLY",
+			start: date(2024, 2, 29, 0, 0),
+			after: date(2024, 2, 29, 0, 0),
+			want:  []time.Time{date(2028, 2, 29, 0, 0), date(2032, 2, 29, 0, 0)},
+		},
+		{
+			name:  "rrule yearly month end of february",
+			expr:  "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1",
+			start: date(2023, 1, 1, 0, 0),
+			after: date(2023, 1, 1, 0, 0),
+			want:  []time.Time{date(2023, 2, 28, 0, 0), date(2024, 2, 29, 0, 0), date(2025, 2, 28, 0, 0)},
+		},
+		{
+			name:  "rrule count stops the rule",
+			expr:  "FREQ=DAILY;COUNT=2",
+			start: date(2024, 1, 1, 6, 0),
+			after: date(2023, 12, 31, 0, 0),
+			want:  []time.Time{date(2024, 1, 1, 6, 0), date(2024, 1, 2, 6, 0)},
+		},
+		{
+			name:  "rrule until is inclusive of the date",
+			expr:  "FREQ=WEEKLY;UNTIL=20240115",
+			start: date(2024, 1, 1, 6, 0),
+			after: date(2024, 1, 1, 6, 0),
+			want:  []time.Time{date(2024, 1, 8, 6, 0), date(2024, 1, 15, 6, 0)},
+		},
+		{
+			name:  "rrule hours within a day",
+			expr:  "FREQ=DAILY;BYHOUR=9,17;BYMINUTE=30",
+			start: date(2024, 1, 1, 0, 0),
+			after: date(2024, 1, 1, 10, 0),
+			want:  []time.Time{date(2024, 1, 1, 17, 30), date(2024, 1, 2, 9, 30)},
+		},
+		{
+			name:  "rrule dtstart overrides start",
+			expr:  "DTSTART:20240110T080000Z\nRRULE:FREQ=MONTHLY;BYMONTHDAY=10",
+			start: date(2020, 1, 1, 0, 0),
+			after: date(2020, 1, 1, 0, 0),
+			want:  []time.Time{date(2024, 1, 10, 8, 0), date(2024, 2, 10, 8, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.expr, tt.start)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			cursor := tt.after
+			var got []time.Time
+			for range tt.want {
+				next, ok := rule.Next(cursor)
+				if !ok {
+					break
+				}
+				got = append(got, next.UTC())
+				cursor = next
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if !assert.NoError(t, err) {
+		return
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, newYork)
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+		want  []time.Time
+	}{
+		{
+			// 01:30 happens twice on 2024-11-03, at 05:30 UTC (EDT) and 06:30 UTC (EST).
+			name:  "cron repeated wall time fires once",
+			expr:  "30 1 * * *",
+			after: date(2024, 11, 2, 12, 0),
+			want:  []time.Time{date(2024, 11, 3, 5, 30), date(2024, 11, 4, 6, 30)},
+		},
+		{
+			name:  "cron not again after the second pass began",
+			expr:  "30 1 * * *",
+			after: date(2024, 11, 3, 6, 10),
+			want:  []time.Time{date(2024, 11, 4, 6, 30)},
+		},
+		{
+			name:  "cron repeated hour",
+			expr:  "*/30 1 * * *",
+			after: date(2024, 11, 3, 4, 59),
+			want:  []time.Time{date(2024, 11, 3, 5, 0), date(2024, 11, 3, 5, 30), date(2024, 11, 4, 6, 0)},
+		},
+		{
+			// 02:30 does not exist on 2024-03-10: the clocks go from 02:00 EST to 03:00 EDT at 07:00 UTC.
+			name:  "cron skipped wall time fires when the clocks jump",
+			expr:  "30 2 * * *",
+			after: date(2024, 3, 9, 12, 0),
+			want:  []time.Time{date(2024, 3, 10, 7, 0), date(2024, 3, 11, 6, 30)},
+		},
+		{
+			name:  "cron skipped hour collapses into one occurrence",
+			expr:  "0,30 2 * * *",
+			after: date(2024, 3, 10, 6, 0),
+			want:  []time.Time{date(2024, 3, 10, 7, 0), date(2024, 3, 11, 6, 0)},
+		},
+		{
+			name:  "rrule repeated wall time fires once",
+			expr:  "FREQ=DAILY;BYHOUR=1;BYMINUTE=30",
+			after: date(2024, 11, 2, 12, 0),
+			want:  []time.Time{date(2024, 11, 3, 5, 30), date(2024, 11, 4, 6, 30)},
+		},
+		{
+			name:  "rrule skipped wall time fires when the clocks jump",
+			expr:  "FREQ=DAILY;BYHOUR=2;BYMINUTE=30",
+			after: date(2024, 3, 9, 12, 0),
+			want:  []time.Time{date(2024, 3, 10, 7, 0), date(2024, 3, 11, 6, 30)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.expr, start)
+			if !assert.NoError(t, err) {
+				return
+			}
+			cursor := tt.after
+			var got []time.Time
+			for range tt.want {
+				next, ok := rule.Next(cursor)
+				if !ok {
+					break
+				}
+				got = append(got, next.UTC())
+				cursor = next
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNextExhausted(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+	}{
+		{name: "count", expr: "FREQ=MONTHLY;COUNT=3", after: date(2024, 3, 1, 0, 0)},
+		{name: "until", expr: "FREQ=DAILY;UNTIL=20240105T000000Z", after: date(2024, 1, 5, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.expr, date(2024, 1, 1, 0, 0))
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, ok := rule.Next(tt.after)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		from, to time.Time
+		want     int
+	}{
+		{name: "cron hourly half open", expr: "@hourly", from: date(2024, 1, 1, 0, 0), to: date(2024, 1, 2, 0, 0), want: 24},
+		{name: "month ends of a leap year", expr: "FREQ=MONTHLY;BYMONTHDAY=-1", from: date(2024, 1, 1, 0, 0), to: date(2025, 1, 1, 0, 0), want: 12},
+		{name: "31st only in long months", expr: "0 0 31 * *", from: date(2024, 1, 1, 0, 0), to: date(2025, 1, 1, 0, 0), want: 7},
+		{name: "count caps the window", expr: "FREQ=DAILY;COUNT=5", from: date(2024, 1, 1, 0, 0), to: date(2024, 2, 1, 0, 0), want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.expr, date(2024, 1, 1, 0, 0))
+			if !assert.NoError(t, err) {
+				return
+			}
+			got := rule.Between(tt.from, tt.to)
+			assert.Len(t, got, tt.want)
+			for i := 1; i < len(got); i++ {
+				assert.True(t, got[i].After(got[i-1]))
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "empty", expr: ""},
+		{name: "cron field count", expr: "0 0 * *"},
+		{name: "cron out of range", expr: "60 0 * * *"},
+		{name: "cron never matches", expr: "0 0 30 2 *"},
+		{name: "rrule missing freq", expr: "RRULE:INTERVAL=2"},
+		{name: "rrule unknown freq", expr: "FREQ=SECONDLY"},
+		{name: "rrule bad byday", expr: "FREQ=WEEKLY;BYDAY=XX"},
+		{name: "rrule count and until", expr: "FREQ=DAILY;COUNT=2;UNTIL=20250101"},
+		{name: "rrule never matches", expr: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.expr, date(2024, 1, 1, 0, 0))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,480 @@
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPeriods bounds how many FREQ periods Next walks before concluding the rule
+// has no further occurrence.
+const maxPeriods = 100000
+
+type frequency int
+
+const (
+	daily frequency = iota
+	weekly
+	monthly
+	yearly
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+type weekdayNum struct {
+	n   int
+	day time.Weekday
+}
+
+// rrule is the subset of RFC 5545 recurrence rules the service schedules with:
+// FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, COUNT, UNTIL, BYMONTH,
+// BYMONTHDAY, BYDAY, BYSETPOS, BYHOUR, BYMINUTE and WKST.
+type rrule struct {
+	freq       frequency
+	interval   int
+	count      int
+	until      time.Time
+	byMonth    []int
+	byMonthDay []int
+	byDay      []weekdayNum
+	bySetPos   []int
+	byHour     []int
+	byMinute   []int
+	wkst       time.Weekday
+	dtstart    time.Time
+}
+
+func parseRRule(expr string, start time.Time) (Rule, error) {
+	r := &rrule{interval: 1, wkst: time.Monday, dtstart: start}
+
+	var body string
+	for _, line := range strings.Fields(expr) {
+		upper := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(upper, "DTSTART"):
+			dtstart, err := parseDTStart(line, start.Location())
+			if err != nil {
+				return nil, err
+			}
+			r.dtstart = dtstart
+		case strings.HasPrefix(upper, "RRULE:"):
+			body = line[len("RRULE:"):]
+		default:
+			body = line
+		}
+	}
+	if body == "" {
+		return nil, fmt.Errorf("recurrence: missing RRULE in %q", expr)
+	}
+
+	hasFreq := false
+	for _, part := range strings.Split(body, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("recurrence: invalid rule part %q", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+
+		var err error
+		switch key {
+		case "FREQ":
+			hasFreq = true
+			switch value {
+			case "DAILY":
+				r.freq = daily
+			case "WEEKLY":
+				r.freq = weekly
+			case "MONTHLY":
+				r.freq = monthly
+			case "YEARLY":
+				r.freq = yearly
+			default:
+				return nil, fmt.Errorf("recurrence: unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			if r.interval, err = strconv.Atoi(value); err != nil || r.interval <= 0 {
+				return nil, fmt.Errorf("recurrence: invalid INTERVAL %q", value)
+			}
+		case "COUNT":
+			if r.count, err = strconv.Atoi(value); err != nil || r.count <= 0 {
+				return nil, fmt.Errorf("recurrence: invalid COUNT %q", value)
+			}
+		case "UNTIL":
+			if r.until, err = parseICalTime(value, r.dtstart.Location(), true); err != nil {
+				return nil, err
+			}
+		case "BYMONTH":
+			r.byMonth, err = parseIntList(value, 1, 12, false)
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseIntList(value, 1, 31, true)
+		case "BYSETPOS":
+			r.bySetPos, err = parseIntList(value, 1, 366, true)
+		case "BYHOUR":
+			r.byHour, err = parseIntList(value, 0, 23, false)
+		case "BYMINUTE":
+			r.byMinute, err = parseIntList(value, 0, 59, false)
+		case "BYDAY":
+			r.byDay, err = parseByDay(value)
+		case "WKST":
+			day, ok := weekdays[value]
+			if !ok {
+				return nil, fmt.Errorf("recurrence: invalid WKST %q", value)
+			}
+			r.wkst = day
+		default:
+			return nil, fmt.Errorf("recurrence: unsupported rule part %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !hasFreq {
+		return nil, fmt.Errorf("recurrence: missing FREQ in %q", expr)
+	}
+	if r.count > 0 && !r.until.IsZero() {
+		return nil, fmt.Errorf("recurrence: COUNT and UNTIL are mutually exclusive")
+	}
+	return r, nil
+}
+
+func parseDTStart(line string, loc *time.Location) (time.Time, error) {
+	i := strings.LastIndex(line, ":")
+	if i < 0 {
+		return time.Time{}, fmt.Errorf("recurrence: invalid DTSTART %q", line)
+	}
+	for _, param := range strings.Split(line[:i], ";")[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], "TZID") {
+			tz, err := time.LoadLocation(kv[1])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("recurrence: invalid TZID %q", kv[1])
+			}
+			loc = tz
+		}
+	}
+	return parseICalTime(line[i+1:], loc, false)
+}
+
+// parseICalTime parses DATE or DATE-TIME values. A trailing Z means UTC.
+// A bare DATE used as UNTIL covers the whole day.
+func parseICalTime(value string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		value, loc = strings.TrimSuffix(value, "Z"), time.UTC
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("20060102", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("recurrence: invalid date %q", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+func parseIntList(value string, min, max int, allowNegative bool) ([]int, error) {
+	var values []int
+	for _, s := range strings.Split(value, ",") {
+		v, err := strconv.Atoi(s)
+		abs := v
+		if abs < 0 && allowNegative {
+			abs = -abs
+		}
+		if err != nil || abs < min || abs > max {
+			return nil, fmt.Errorf("recurrence: invalid value %q", s)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func parseByDay(value string) ([]weekdayNum, error) {
+	var days []weekdayNum
+	for _, s := range strings.Split(value, ",") {
+		if len(s) < 2 {
+			return nil, fmt.Errorf("recurrence: invalid BYDAY %q", s)
+		}
+		day, ok := weekdays[s[len(s)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("recurrence: invalid BYDAY %q", s)
+		}
+		n := 0
+		if prefix := s[:len(s)-2]; prefix != "" {
+			var err error
+			if n, err = strconv.Atoi(prefix); err != nil || n == 0 || n > 53 || n < -53 {
+				return nil, fmt.Errorf("recurrence: invalid BYDAY %q", s)
+			}
+		}
+		days = append(days, weekdayNum{n: n, day: day})
+	}
+	return days, nil
+}
+
+func (r *rrule) Next(after time.Time) (time.Time, bool) {
+	first := 0
+	if r.count == 0 {
+		first = r.periodsUntil(after) - 1
+		if first < 0 {
+			first = 0
+		}
+	}
+
+	seen := 0
+	for k := first; k < first+maxPeriods; k++ {
+		for _, occurrence := range r.expand(k) {
+			if occurrence.Before(r.dtstart) {
+				continue
+			}
+			if !r.until.IsZero() && occurrence.After(r.until) {
+				return time.Time{}, false
+			}
+			seen++
+			if r.count > 0 && seen > r.count {
+				return time.Time{}, false
+			}
+			if occurrence.After(after) {
+				return occurrence, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *rrule) Between(from, to time.Time) []time.Time {
+	return between(r, from, to)
+}
+
+// periodsUntil returns how many whole periods separate dtstart from t.
+func (r *rrule) periodsUntil(t time.Time) int {
+	t = t.In(r.dtstart.Location())
+	if !t.After(r.dtstart) {
+		return 0
+	}
+	var periods int
+	switch r.freq {
+	case daily:
+		periods = dayNumber(t) - dayNumber(r.dtstart)
+	case weekly:
+		periods = (dayNumber(t) - dayNumber(r.weekStart(0))) / 7
+	case monthly:
+		periods = (t.Year()-r.dtstart.Year())*12 + int(t.Month()-r.dtstart.Month())
+	case yearly:
+		periods = t.Year() - r.dtstart.Year()
+	}
+	return periods / r.interval
+}
+
+// expand returns the sorted occurrences of the k-th period after dtstart,
+// before the COUNT, UNTIL and dtstart bounds are applied.
+func (r *rrule) expand(k int) []time.Time {
+	var days []time.Time
+	start := r.dtstart
+	loc := start.Location()
+
+	switch r.freq {
+	case daily:
+		day := time.Date(start.Year(), start.Month(), start.Day()+k*r.interval, 0, 0, 0, 0, loc)
+		if r.matchesMonth(day) && r.matchesMonthDay(day) && r.matchesWeekday(day) {
+			days = append(days, day)
+		}
+	case weekly:
+		weekStart := r.weekStart(k)
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			if !r.matchesMonth(day) {
+				continue
+			}
+			if len(r.byDay) == 0 && day.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+	case monthly:
+		month := time.Date(start.Year(), start.Month()+time.Month(k*r.interval), 1, 0, 0, 0, 0, loc)
+		if r.matchesMonth(month) {
+			days = r.monthDays(month.Year(), month.Month())
+		}
+	case yearly:
+		year := start.Year() + k*r.interval
+		if len(r.byMonth) == 0 && len(r.byMonthDay) == 0 && len(r.byDay) > 0 {
+			days = r.yearWeekdays(year)
+			break
+		}
+		months := r.byMonth
+		if len(months) == 0 && len(r.byMonthDay) > 0 {
+			months = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+		}
+		if len(months) == 0 {
+			months = []int{int(start.Month())}
+		}
+		sort.Ints(months)
+		for _, month := range months {
+			days = append(days, r.monthDays(year, time.Month(month))...)
+		}
+	}
+
+	occurrences := r.withTimes(days)
+	if len(r.bySetPos) > 0 {
+		occurrences = setPositions(occurrences, r.bySetPos)
+	}
+	return occurrences
+}
+
+func (r *rrule) weekStart(k int) time.Time {
+	start := r.dtstart
+	offset := (int(start.Weekday()) - int(r.wkst) + 7) % 7
+	return time.Date(start.Year(), start.Month(), start.Day()-offset+7*k*r.interval, 0, 0, 0, 0, start.Location())
+}
+
+// monthDays expands BYMONTHDAY and BYDAY inside one month. Without either it
+// falls back to the day of month of dtstart, skipping months that lack it.
+func (r *rrule) monthDays(year int, month time.Month) []time.Time {
+	loc := r.dtstart.Location()
+	last := daysIn(year, month)
+
+	if len(r.byMonthDay) == 0 && len(r.byDay) == 0 {
+		if r.dtstart.Day() > last {
+			return nil
+		}
+		return []time.Time{time.Date(year, month, r.dtstart.Day(), 0, 0, 0, 0, loc)}
+	}
+
+	var days []time.Time
+	for day := 1; day <= last; day++ {
+		t := time.Date(year, month, day, 0, 0, 0, 0, loc)
+		if len(r.byMonthDay) > 0 && !r.matchesMonthDay(t) {
+			continue
+		}
+		if len(r.byDay) > 0 && !matchesNthWeekday(t, r.byDay, day, last) {
+			continue
+		}
+		days = append(days, t)
+	}
+	return days
+}
+
+func (r *rrule) yearWeekdays(year int) []time.Time {
+	loc := r.dtstart.Location()
+	first := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	total := time.Date(year, time.December, 31, 0, 0, 0, 0, loc).YearDay()
+
+	var days []time.Time
+	for i := 0; i < total; i++ {
+		t := first.AddDate(0, 0, i)
+		if matchesNthWeekday(t, r.byDay, i+1, total) {
+			days = append(days, t)
+		}
+	}
+	return days
+}
+
+// matchesNthWeekday reports whether t is selected by BYDAY where index and
+// total position t inside the enclosing month or year.
+func matchesNthWeekday(t time.Time, byDay []weekdayNum, index, total int) bool {
+	for _, wd := range byDay {
+		if wd.day != t.Weekday() {
+			continue
+		}
+		nth := (index-1)/7 + 1
+		nthFromEnd := -((total-index)/7 + 1)
+		if wd.n == 0 || wd.n == nth || wd.n == nthFromEnd {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesMonth(t time.Time) bool {
+	if len(r.byMonth) == 0 {
+		return true
+	}
+	for _, month := range r.byMonth {
+		if time.Month(month) == t.Month() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesMonthDay(t time.Time) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+	last := daysIn(t.Year(), t.Month())
+	for _, day := range r.byMonthDay {
+		if day == t.Day() || (day < 0 && last+day+1 == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesWeekday(t time.Time) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	for _, wd := range r.byDay {
+		if wd.day == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) withTimes(days []time.Time) []time.Time {
+	hours, minutes := r.byHour, r.byMinute
+	if len(hours) == 0 {
+		hours = []int{r.dtstart.Hour()}
+	}
+	if len(minutes) == 0 {
+		minutes = []int{r.dtstart.Minute()}
+	}
+	sort.Ints(hours)
+	sort.Ints(minutes)
+
+	occurrences := make([]time.Time, 0, len(days)*len(hours)*len(minutes))
+	for _, day := range days {
+		for _, hour := range hours {
+			for _, minute := range minutes {
+				occurrences = append(occurrences, instant(time.Date(day.Year(), day.Month(), day.Day(),
+					hour, minute, r.dtstart.Second(), 0, time.UTC), day.Location()))
+			}
+		}
+	}
+	return occurrences
+}
+
+func setPositions(occurrences []time.Time, positions []int) []time.Time {
+	var selected []time.Time
+	for _, pos := range positions {
+		i := pos - 1
+		if pos < 0 {
+			i = len(occurrences) + pos
+		}
+		if i >= 0 && i < len(occurrences) {
+			selected = append(selected, occurrences[i])
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Before(selected[j]) })
+
+	unique := selected[:0]
+	for i, t := range selected {
+		if i == 0 || !t.Equal(selected[i-1]) {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+func dayNumber(t time.Time) int {
+	return int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
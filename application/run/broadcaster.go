@@ -0,0 +1,181 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"newdemo1/resource/jaeger/common/telemetry"
+	"sync"
+	"time"
+)
+
+// resubscribeDelay is how long Run waits before subscribing again after the relay failed.
+const resubscribeDelay = time.Second
+
+const (
+	EventTriggered = "triggered"
+	EventSucceeded = "succeeded"
+	EventFailed    = "failed"
+	EventFinished  = "finished"
+	EventRetried   = "retried"
+	EventSkipped   = "skipped"
+	EventReplaced  = "replaced"
+	// EventRepublished and EventTimedOut come from the reconciler of stuck runs.
+	EventRepublished = "republished"
+	EventTimedOut    = "timed_out"
+)
+
+type (
+	// Event describes a step in the life of one occurrence of a subscription.
+	Event struct {
+		SubscriptionID uint64    `json:"subscriptionId"`
+		OwnerID        string    `json:"ownerId"`
+		ScheduledAt    time.Time `json:"scheduledAt"`
+		Type           string    `json:"type"`
+		ErrorCode      string    `json:"errorCode"`
+		ErrorMessage   string    `json:"errorMessage"`
+		OccurredAt     time.Time `json:"occurredAt"`
+	}
+
+	// Filter selects the events a watcher receives; zero fields match everything.
+	Filter struct {
+		SubscriptionID uint64
+		OwnerID        string
+	}
+
+	// Relay carries events between replicas; infrastructure/fanout implements it.
+	Relay interface {
+		Publish(ctx context.Context, channel string, payload []byte) error
+		Subscribe(ctx context.Context, channel string, fn func(payload []byte)) error
+	}
+
+	// Broadcaster fans run events out to in-process watchers. Without a relay
+	// it only sees the events of this replica: the scheduler tick it won and the
+	// results it consumed. With one, events go through the relay channel and
+	// every replica running the broadcaster delivers them to its watchers.
+	Broadcaster struct {
+		mu       sync.RWMutex
+		watchers map[*watcher]struct{}
+		relay    Relay
+		channel  string
+		logger   telemetry.Logger
+	}
+
+	watcher struct {
+		filter Filter
+		events chan Event
+	}
+)
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{watchers: make(map[*watcher]struct{})}
+}
+
+// NewRelayedBroadcaster builds a Broadcaster sharing events with the other
+// replicas through channel of relay. Its watchers receive events once Run subscribed.
+func NewRelayedBroadcaster(relay Relay, channel string, logger telemetry.Logger) *Broadcaster {
+	b := NewBroadcaster()
+	b.relay, b.channel, b.logger = relay, channel, logger
+	return b
+}
+
+// Run delivers the events relayed by every replica to the watchers of this
+// one until ctx is cancelled, subscribing again when the relay fails. Without
+// a relay it only waits for ctx.
+func (b *Broadcaster) Run(ctx context.Context) {
+	if b.relay == nil {
+		<-ctx.Done()
+		return
+	}
+	for {
+		err := b.relay.Subscribe(ctx, b.channel, b.receive)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			b.logger.Error(ctx, "run event relay failed", err, zap.String("channel", b.channel))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// Watch returns a channel of the events matching filter and a function that
+// stops the watch and closes the channel. A watcher more than buffer events
+// behind misses the events that do not fit.
+func (b *Broadcaster) Watch(filter Filter, buffer int) (<-chan Event, func()) {
+	w := &watcher{filter: filter, events: make(chan Event, buffer)}
+	b.mu.Lock()
+	b.watchers[w] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return w.events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.watchers, w)
+			b.mu.Unlock()
+			close(w.events)
+		})
+	}
+}
+
+// Publish delivers event to every matching watcher without blocking, through
+// the relay when there is one. An event the relay refuses reaches the watchers
+// of this replica only.
+func (b *Broadcaster) Publish(event Event) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	if b.relay != nil {
+		payload, err := json.Marshal(event)
+		if err == nil {
+			err = b.relay.Publish(context.Background(), b.channel, payload)
+		}
+		if err == nil {
+			return
+		}
+		b.logger.Error(context.Background(), "failed to relay run event", err,
+			zap.String("channel", b.channel),
+			zap.Uint64("subscriptionId", event.SubscriptionID),
+			zap.String("type", event.Type))
+	}
+	b.deliver(event)
+}
+
+// receive delivers an event relayed by any replica.
+func (b *Broadcaster) receive(payload []byte) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		b.logger.Error(context.Background(), "malformed run event", err, zap.String("channel", b.channel))
+		return
+	}
+	b.deliver(event)
+}
+
+func (b *Broadcaster) deliver(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for w := range b.watchers {
+		if !w.filter.match(event) {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+		}
+	}
+}
+
+func (f Filter) match(event Event) bool {
+	if f.SubscriptionID != 0 && f.SubscriptionID != event.SubscriptionID {
+		return false
+	}
+	if f.OwnerID != "" && f.OwnerID != event.OwnerID {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package run
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster()
+	all, stopAll := b.Watch(Filter{}, 4)
+	one, stopOne := b.Watch(Filter{SubscriptionID: 1}, 4)
+	owner, stopOwner := b.Watch(Filter{OwnerID: "u2"}, 1)
+	defer stopAll()
+	defer stopOwner()
+
+	b.Publish(Event{SubscriptionID: 1, OwnerID: "u1", Type: EventTriggered})
+	b.Publish(Event{SubscriptionID: 2, OwnerID: "u2", Type: EventTriggered})
+	b.Publish(Event{SubscriptionID: 2, OwnerID: "u2", Type: EventSucceeded})
+
+	assert.Len(t, all, 3)
+	assert.Len(t, one, 1)
+	// The owner watcher's buffer holds one event; the second is dropped.
+	assert.Len(t, owner, 1)
+	e := <-one
+	assert.Equal(t, uint64(1), e.SubscriptionID)
+	assert.False(t, e.OccurredAt.IsZero())
+
+	stopOne()
+	stopOne()
+	_, open := <-one
+	assert.False(t, open)
+	b.Publish(Event{SubscriptionID: 1})
+	assert.Len(t, all, 4)
+}
+
+// memoryRelay hands every published payload to its subscribers, as the
+// replicas sharing a Redis channel see it.
+type memoryRelay struct {
+	mu          sync.Mutex
+	subscribers []func(payload []byte)
+	subscribed  chan struct{}
+}
+
+func (r *memoryRelay) Publish(_ context.Context, _ string, payload []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, fn := range r.subscribers {
+		fn(payload)
+	}
+	return nil
+}
+
+func (r *memoryRelay) Subscribe(ctx context.Context, _ string, fn func(payload []byte)) error {
+	r.mu.Lock()
+	r.subscribers = append(r.subscribers, fn)
+	r.mu.Unlock()
+	r.subscribed <- struct{}{}
+	<-ctx.Done()
+	return nil
+}
+
+func TestRelayedBroadcaster(t *testing.T) {
+	relay := &memoryRelay{subscribed: make(chan struct{}, 2)}
+	one := NewRelayedBroadcaster(relay, "runs", nil)
+	other := NewRelayedBroadcaster(relay, "runs", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go one.Run(ctx)
+	go other.Run(ctx)
+	<-relay.subscribed
+	<-relay.subscribed
+
+	events, stop := other.Watch(Filter{SubscriptionID: 1}, 4)
+	defer stop()
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	one.Publish(Event{SubscriptionID: 1, OwnerID: "u1", ScheduledAt: at, Type: EventTriggered})
+	one.Publish(Event{SubscriptionID: 2, Type: EventTriggered})
+
+	// The event published on one replica reaches the watcher of the other.
+	assert.Len(t, events, 1)
+	e := <-events
+	assert.Equal(t, EventTriggered, e.Type)
+	assert.Equal(t, "u1", e.OwnerID)
+	assert.True(t, at.Equal(e.ScheduledAt))
+}
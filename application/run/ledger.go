@@ -0,0 +1,85 @@
+package run
+
+import (
+	"context"
+	"newdemo1/constant"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/resource"
+	commonErr "newdemo1/resource/jaeger/common/error"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+type (
+	// Service answers questions about past occurrences from the run ledger.
+	Service interface {
+		List(ctx context.Context, req ListRequest) ([]repository.SubscriptionRun, int64, error)
+		Get(ctx context.Context, id uint64) (repository.SubscriptionRun, error)
+	}
+	service struct {
+		resource *resource.Resource
+		repo     *repository.Repository
+	}
+
+	// ListRequest filters runs; From and To bound the scheduled time.
+	ListRequest struct {
+		SubscriptionID uint64     `form:"subscriptionId"`
+		OwnerID        string     `form:"ownerId" validate:"max=64"`
+		Status         string     `form:"status" validate:"omitempty,oneof=triggered succeeded failed skipped timed_out"`
+		From           *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+		To             *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+		Page           int        `form:"page" validate:"gte=0"`
+		Size           int        `form:"size" validate:"gte=0,lte=100"`
+	}
+)
+
+const defaultPageSize = 20
+
+func NewService(resource *resource.Resource, infrastructure *infrastructure.Infrastructure) Service {
+	return &service{
+		resource: resource,
+		repo:     infrastructure.Store.Repository,
+	}
+}
+
+func (s *service) List(ctx context.Context, req ListRequest) ([]repository.SubscriptionRun, int64, error) {
+	tr := tracer.StartTrace(ctx, "application.run.List")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.resource.Validator.Struct(req); err != nil {
+		return nil, 0, commonErr.ServiceError{
+			Code:    constant.InvalidRequest.Code,
+			Message: err.Error(),
+		}
+	}
+	if req.From != nil && req.To != nil && req.To.Before(*req.From) {
+		return nil, 0, commonErr.ServiceError{
+			Code:    constant.InvalidRequest.Code,
+			Message: "to must not be before from",
+		}
+	}
+	size := req.Size
+	if size == 0 {
+		size = defaultPageSize
+	}
+
+	return s.repo.ListSubscriptionRuns(ctx, repository.SubscriptionRunFilter{
+		SubscriptionID: req.SubscriptionID,
+		OwnerID:        req.OwnerID,
+		Status:         req.Status,
+		From:           req.From,
+		To:             req.To,
+		Offset:         req.Page * size,
+		Limit:          size,
+	})
+}
+
+func (s *service) Get(ctx context.Context, id uint64) (repository.SubscriptionRun, error) {
+	tr := tracer.StartTrace(ctx, "application.run.Get")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return s.repo.GetSubscriptionRun(ctx, id)
+}
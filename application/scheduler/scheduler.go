@@ -0,0 +1,595 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redsync/redsync/v4"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"newdemo1/application/calendar"
+	"newdemo1/application/outbox"
+	"newdemo1/application/run"
+	"newdemo1/application/subscription"
+	"newdemo1/constant"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/mq/pubsub1"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/infrastructure/sync"
+	"newdemo1/resource"
+	"newdemo1/resource/jaeger/common/telemetry"
+	"newdemo1/resource/jaeger/common/tracer"
+	"strconv"
+	"time"
+)
+
+const (
+	lockKey                 = "recurring:scheduler"
+	occurrenceLockPrefix    = "recurring:occurrence:"
+	subscriptionLockPrefix  = "recurring:subscription:"
+	occurrenceLockExpiry    = time.Minute
+	concurrencyMetric       = "recurring.scheduler.concurrency"
+	defaultInterval         = 10 * time.Second
+	defaultBatchSize        = 100
+	defaultMisfireThreshold = time.Minute
+	defaultMisfirePolicy    = subscription.MisfireOnce
+	defaultMisfireMaxRuns   = 10
+)
+
+// errLocked aborts firing an occurrence, or a subscription, another trigger is recording.
+var errLocked = errors.New("locked by another trigger")
+
+var terminalReasons = map[string]string{
+	repository.SubscriptionStatusCompleted: "schedule has no further occurrence",
+	repository.SubscriptionStatusExpired:   "end date reached",
+}
+
+type (
+	Scheduler interface {
+		// Run ticks until ctx is cancelled.
+		Run(ctx context.Context)
+		// Tick publishes every occurrence due within the lookahead window.
+		Tick(ctx context.Context) error
+	}
+	scheduler struct {
+		resource  *resource.Resource
+		repo      *repository.Repository
+		sync      sync.Sync
+		interval  time.Duration
+		batchSize int
+		lookahead time.Duration
+		lifecycle subscription.Lifecycle
+		runs      *run.Broadcaster
+		calendars calendar.Service
+		metrics   telemetry.Metrics
+
+		misfireThreshold time.Duration
+		misfirePolicy    string
+		misfireMaxRuns   int
+	}
+
+	// runFinder looks a run up by its occurrence, as the repository of a transaction does.
+	runFinder interface {
+		FindSubscriptionRunForUpdate(ctx context.Context, key repository.RunKey) (repository.SubscriptionRun, error)
+	}
+
+	// HappenEvent is published on the recurring-happen topic for every occurrence.
+	HappenEvent struct {
+		SubscriptionID uint64    `json:"subscriptionId"`
+		OwnerID        string    `json:"ownerId"`
+		Amount         int64     `json:"amount"`
+		Currency       string    `json:"currency"`
+		ScheduledAt    time.Time `json:"scheduledAt"`
+		// CorrelationID identifies the run; results should echo it back.
+		CorrelationID string `json:"correlationId"`
+		// Attempt is 1 for the first publication and grows with every retry.
+		Attempt int `json:"attempt"`
+	}
+	// CancelEvent is published on the recurring-cancel topic for every run
+	// replaced by the occurrence at ReplacedBy.
+	CancelEvent struct {
+		SubscriptionID uint64    `json:"subscriptionId"`
+		OwnerID        string    `json:"ownerId"`
+		ScheduledAt    time.Time `json:"scheduledAt"`
+		CorrelationID  string    `json:"correlationId"`
+		ReplacedBy     time.Time `json:"replacedBy"`
+	}
+)
+
+func NewScheduler(resource *resource.Resource, infrastructure *infrastructure.Infrastructure, runs *run.Broadcaster, calendars calendar.Service) Scheduler {
+	cfg := resource.Config.Scheduler
+	s := &scheduler{
+		resource:  resource,
+		repo:      infrastructure.Store.Repository,
+		sync:      infrastructure.Sync,
+		interval:  cfg.Interval,
+		batchSize: cfg.BatchSize,
+		lookahead: cfg.Lookahead,
+		lifecycle: subscription.NewLifecycle(resource),
+		runs:      runs,
+		calendars: calendars,
+		metrics:   resource.Datadog.Metrics(),
+
+		misfireThreshold: cfg.MisfireThreshold,
+		misfirePolicy:    cfg.MisfirePolicy,
+		misfireMaxRuns:   cfg.MisfireMaxRuns,
+	}
+	if s.interval <= 0 {
+		s.interval = defaultInterval
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = defaultBatchSize
+	}
+	if s.misfireThreshold <= 0 {
+		s.misfireThreshold = defaultMisfireThreshold
+	}
+	if s.misfirePolicy == "" {
+		s.misfirePolicy = defaultMisfirePolicy
+	}
+	if s.misfireMaxRuns <= 0 {
+		s.misfireMaxRuns = defaultMisfireMaxRuns
+	}
+	return s
+}
+
+func (s *scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Tick(ctx); err != nil {
+			s.resource.Log.Error(ctx, "scheduler tick failed", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *scheduler) Tick(ctx context.Context) error {
+	// Only the replica holding the lock schedules; the others skip this tick.
+	unlock, err := s.sync.Lock(ctx, lockKey, redsync.WithTries(1), redsync.WithExpiry(s.interval))
+	if errors.Is(err, redsync.ErrFailed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = unlock.Unlock(context.Background())
+	}()
+
+	tr := tracer.StartTrace(ctx, "application.scheduler.Tick")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	due, err := s.repo.ListDueSubscriptions(ctx, time.Now().Add(s.lookahead), s.batchSize)
+	if err != nil {
+		return err
+	}
+	for _, sub := range due {
+		if err := s.fire(ctx, sub); err != nil {
+			s.resource.Log.Error(ctx, "failed to fire subscription", err,
+				zap.Uint64("subscriptionId", sub.ID))
+		}
+	}
+
+	retries, err := s.repo.ListDueRetries(ctx, time.Now(), s.batchSize)
+	if err != nil {
+		return err
+	}
+	for _, ledger := range retries {
+		if err := s.retry(ctx, ledger); err != nil {
+			s.resource.Log.Error(ctx, "failed to retry run", err,
+				zap.Uint64("runId", ledger.ID),
+				zap.Uint64("subscriptionId", ledger.SubscriptionID))
+		}
+	}
+	return nil
+}
+
+// fire records the occurrence of a subscription in the run ledger, advances its
+// next run and queues the happen event in the outbox. An occurrence later than
+// the misfire threshold was missed, after downtime or a failover, and takes the
+// ones missed after it through the misfire policy. Watchers are told once it commits.
+//
+// Every occurrence is locked while its run is recorded, and one the ledger
+// already holds, from a duplicate trigger, is not published again. One due
+// while an earlier run is unfinished goes through the concurrency policy of
+// the subscription.
+func (s *scheduler) fire(ctx context.Context, due repository.Subscription) error {
+	var (
+		triggered []run.Event
+		unlocks   []sync.Unlock
+		overlaps  = map[string]int64{}
+		policy    string
+	)
+	defer func() {
+		for _, unlock := range unlocks {
+			_ = unlock.Unlock(context.Background())
+		}
+	}()
+	err := s.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		triggered = nil
+		sub, err := repo.GetSubscriptionForUpdate(ctx, due.ID)
+		if err != nil {
+			return err
+		}
+		// It was paused, cancelled or fired elsewhere since it was listed.
+		if sub.Status != repository.SubscriptionStatusActive || sub.NextRunAt == nil || !sub.NextRunAt.Equal(*due.NextRunAt) {
+			return nil
+		}
+
+		cal, err := s.calendars.Get(ctx, sub.Calendar)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		after := *sub.NextRunAt
+		plan := subscription.Catchup{Fire: []time.Time{after}}
+		misfire := ""
+		if cutoff := now.Add(-s.misfireThreshold); after.Before(cutoff) {
+			misfire, after = s.misfirePolicy, cutoff
+			maxRuns := s.misfireMaxRuns
+			if sub.MisfirePolicy != "" {
+				misfire = sub.MisfirePolicy
+			}
+			if sub.MisfireMaxRuns > 0 {
+				maxRuns = sub.MisfireMaxRuns
+			}
+			if plan, err = subscription.PlanCatchup(sub, cal, misfire, maxRuns, cutoff); err != nil {
+				return err
+			}
+			s.resource.Log.Warn(ctx, "catching up missed occurrences",
+				zap.Uint64("subscriptionId", sub.ID),
+				zap.String("misfire", misfire),
+				zap.Int("fire", len(plan.Fire)),
+				zap.Int("skip", len(plan.Skip)),
+				zap.Int("capped", plan.Capped.Count))
+		}
+		if err := s.recordCapped(ctx, repo, sub, plan.Capped, misfire, now); err != nil {
+			return err
+		}
+
+		for _, scheduledAt := range plan.Skip {
+			if recorded, err := s.recorded(ctx, repo, sub.ID, scheduledAt); recorded || err != nil {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err := repo.CreateSubscriptionRun(ctx, &repository.SubscriptionRun{
+				SubscriptionID: sub.ID,
+				OwnerID:        sub.OwnerID,
+				ScheduledAt:    scheduledAt,
+				TriggeredAt:    now,
+				CorrelationID:  uuid.NewString(),
+				Status:         repository.RunStatusSkipped,
+				Misfire:        misfire,
+			}); err != nil {
+				return err
+			}
+		}
+		// Only a policy other than allow needs the unfinished runs, and holds the
+		// subscription so no retry publishes alongside.
+		policy = sub.ConcurrencyPolicy
+		var active []repository.SubscriptionRun
+		if policy == subscription.ConcurrencyForbid || policy == subscription.ConcurrencyReplace {
+			unlock, err := s.lock(ctx, subscriptionKey(sub.ID))
+			if err != nil {
+				return err
+			}
+			unlocks = append(unlocks, unlock)
+			if active, err = repo.ListActiveSubscriptionRunsForUpdate(ctx, sub.ID); err != nil {
+				return err
+			}
+		}
+
+		for _, scheduledAt := range plan.Fire {
+			unlock, err := s.lock(ctx, occurrenceKey(sub.ID, scheduledAt))
+			if err != nil {
+				return err
+			}
+			unlocks = append(unlocks, unlock)
+			if recorded, err := s.recorded(ctx, repo, sub.ID, scheduledAt); recorded || err != nil {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			ledger := repository.SubscriptionRun{
+				SubscriptionID: sub.ID,
+				OwnerID:        sub.OwnerID,
+				ScheduledAt:    scheduledAt,
+				TriggeredAt:    now,
+				CorrelationID:  uuid.NewString(),
+				Status:         repository.RunStatusTriggered,
+				Attempts:       1,
+				Misfire:        misfire,
+			}
+
+			fire, replace := subscription.Overlap(policy, len(active))
+			if !fire {
+				ledger.Status = repository.RunStatusSkipped
+				ledger.Attempts = 0
+				ledger.Concurrency = policy
+				if err := repo.CreateSubscriptionRun(ctx, &ledger); err != nil {
+					return err
+				}
+				s.resource.Log.Warn(ctx, "occurrence skipped, previous run unfinished",
+					zap.Uint64("subscriptionId", sub.ID),
+					zap.Time("scheduledAt", scheduledAt),
+					zap.Uint64("activeRunId", active[len(active)-1].ID))
+				overlaps[run.EventSkipped]++
+				triggered = append(triggered, run.Event{
+					SubscriptionID: sub.ID,
+					OwnerID:        sub.OwnerID,
+					ScheduledAt:    scheduledAt,
+					Type:           run.EventSkipped,
+					OccurredAt:     now,
+				})
+				continue
+			}
+			if replace {
+				for i := range active {
+					if err := s.replace(ctx, repo, &active[i], scheduledAt); err != nil {
+						return err
+					}
+					overlaps[run.EventReplaced]++
+					triggered = append(triggered, run.Event{
+						SubscriptionID: sub.ID,
+						OwnerID:        sub.OwnerID,
+						ScheduledAt:    active[i].ScheduledAt,
+						Type:           run.EventReplaced,
+						OccurredAt:     now,
+					})
+				}
+				active = nil
+				ledger.Concurrency = policy
+			}
+			if err := repo.CreateSubscriptionRun(ctx, &ledger); err != nil {
+				return err
+			}
+			if err := s.publish(ctx, repo, sub, ledger); err != nil {
+				return err
+			}
+			if policy == subscription.ConcurrencyForbid || policy == subscription.ConcurrencyReplace {
+				active = append(active, ledger)
+			}
+			sub.LastRunAt = &now
+			sub.RunCount++
+			triggered = append(triggered, run.Event{
+				SubscriptionID: sub.ID,
+				OwnerID:        sub.OwnerID,
+				ScheduledAt:    scheduledAt,
+				Type:           run.EventTriggered,
+				OccurredAt:     now,
+			})
+		}
+
+		terminal, err := subscription.Advance(&sub, cal, after)
+		if err != nil {
+			return err
+		}
+		if terminal != "" {
+			return s.lifecycle.Transition(ctx, repo, &sub, terminal, terminalReasons[terminal])
+		}
+		return repo.UpdateSubscription(ctx, &sub)
+	})
+	if errors.Is(err, errLocked) {
+		s.resource.Log.Info(ctx, "occurrence is being fired elsewhere",
+			zap.Uint64("subscriptionId", due.ID))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, event := range triggered {
+		s.runs.Publish(event)
+	}
+	for action, count := range overlaps {
+		s.metrics.Count(concurrencyMetric, count, []string{
+			"policy:" + policy,
+			"action:" + action,
+			"src_env:" + s.resource.Config.Telemetry.Tracer.SourceEnv,
+		})
+	}
+	return nil
+}
+
+// replace marks an unfinished run replaced by the occurrence at replacedBy,
+// dropping its pending retry, and queues the request to cancel its job. Its
+// status is kept so the ledger still tells whether the happen went through.
+func (s *scheduler) replace(ctx context.Context, repo *repository.Repository, ledger *repository.SubscriptionRun, replacedBy time.Time) error {
+	ledger.ReplacedBy = &replacedBy
+	ledger.NextRetryAt = nil
+	if err := repo.UpdateSubscriptionRun(ctx, ledger); err != nil {
+		return err
+	}
+	topic := s.resource.Config.Pubsub.PublishTopic.RecurringCancel
+	if topic == "" {
+		return nil
+	}
+	data, err := json.Marshal(CancelEvent{
+		SubscriptionID: ledger.SubscriptionID,
+		OwnerID:        ledger.OwnerID,
+		ScheduledAt:    ledger.ScheduledAt,
+		CorrelationID:  ledger.CorrelationID,
+		ReplacedBy:     replacedBy,
+	})
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, repo, topic, pubsub1.NewMessage(data, map[string]string{
+		"subscriptionId": strconv.FormatUint(ledger.SubscriptionID, 10),
+		"correlationId":  ledger.CorrelationID,
+	}))
+}
+
+// recordCapped records the missed occurrences past the catch-up cap as one
+// skipped run at the last of them, counting them in its error message.
+func (s *scheduler) recordCapped(ctx context.Context, repo *repository.Repository, sub repository.Subscription,
+	capped subscription.Capped, misfire string, now time.Time) error {
+	if capped.Count == 0 {
+		return nil
+	}
+	if recorded, err := s.recorded(ctx, repo, sub.ID, capped.Last); recorded || err != nil {
+		return err
+	}
+	return repo.CreateSubscriptionRun(ctx, &repository.SubscriptionRun{
+		SubscriptionID: sub.ID,
+		OwnerID:        sub.OwnerID,
+		ScheduledAt:    capped.Last,
+		TriggeredAt:    now,
+		CorrelationID:  uuid.NewString(),
+		Status:         repository.RunStatusSkipped,
+		Misfire:        misfire,
+		ErrorCode:      repository.RunErrorMisfireCapped,
+		ErrorMessage: fmt.Sprintf("%d missed occurrences from %s to %s skipped past the catch-up cap",
+			capped.Count, capped.First.UTC().Format(time.RFC3339), capped.Last.UTC().Format(time.RFC3339)),
+	})
+}
+
+// lock takes key without waiting, failing with errLocked when another trigger holds it.
+func (s *scheduler) lock(ctx context.Context, key string) (sync.Unlock, error) {
+	unlock, err := s.sync.Lock(ctx, key, redsync.WithTries(1), redsync.WithExpiry(occurrenceLockExpiry))
+	if errors.Is(err, redsync.ErrFailed) {
+		return nil, errLocked
+	}
+	return unlock, err
+}
+
+// recorded reports whether the ledger already has a run of the occurrence,
+// logging it as a duplicate trigger.
+func (s *scheduler) recorded(ctx context.Context, repo runFinder, subscriptionID uint64, scheduledAt time.Time) (bool, error) {
+	ledger, err := repo.FindSubscriptionRunForUpdate(ctx, repository.RunKey{
+		SubscriptionID: subscriptionID,
+		ScheduledAt:    scheduledAt,
+	})
+	if errors.Is(err, constant.RunNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	s.resource.Log.Warn(ctx, "duplicate trigger ignored",
+		zap.Uint64("subscriptionId", subscriptionID),
+		zap.Time("scheduledAt", scheduledAt),
+		zap.Uint64("runId", ledger.ID),
+		zap.String("status", ledger.Status))
+	return true, nil
+}
+
+// occurrenceKey is the lock key of the occurrence of a subscription at scheduledAt.
+func occurrenceKey(subscriptionID uint64, scheduledAt time.Time) string {
+	return occurrenceLockPrefix + strconv.FormatUint(subscriptionID, 10) + ":" + strconv.FormatInt(scheduledAt.UnixMilli(), 10)
+}
+
+// subscriptionKey is the lock key of the runs of a subscription whose concurrency is limited.
+func subscriptionKey(subscriptionID uint64) string {
+	return subscriptionLockPrefix + strconv.FormatUint(subscriptionID, 10)
+}
+
+// retry publishes a failed run again once its backoff has passed. The retries
+// of a paused or cancelled subscription are dropped instead.
+func (s *scheduler) retry(ctx context.Context, due repository.SubscriptionRun) error {
+	unlock, err := s.lock(ctx, occurrenceKey(due.SubscriptionID, due.ScheduledAt))
+	if errors.Is(err, errLocked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = unlock.Unlock(context.Background())
+	}()
+
+	var (
+		retried   *run.Event
+		subUnlock sync.Unlock
+	)
+	defer func() {
+		if subUnlock != nil {
+			_ = subUnlock.Unlock(context.Background())
+		}
+	}()
+	err = s.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		// Lock the subscription before the run, in the order results do.
+		sub, err := repo.GetSubscriptionForUpdate(ctx, due.SubscriptionID)
+		if err != nil && !errors.Is(err, constant.SubscriptionNotFound) {
+			return err
+		}
+		if sub.ConcurrencyPolicy == subscription.ConcurrencyForbid || sub.ConcurrencyPolicy == subscription.ConcurrencyReplace {
+			if subUnlock, err = s.lock(ctx, subscriptionKey(sub.ID)); err != nil {
+				return err
+			}
+		}
+		ledger, err := repo.GetSubscriptionRunForUpdate(ctx, due.ID)
+		if err != nil {
+			return err
+		}
+		// It was retried elsewhere since it was listed.
+		if ledger.NextRetryAt == nil || !ledger.NextRetryAt.Equal(*due.NextRetryAt) {
+			return nil
+		}
+
+		ledger.NextRetryAt = nil
+		if sub.ID == 0 || sub.Status == repository.SubscriptionStatusPaused || sub.Status == repository.SubscriptionStatusCancelled {
+			return repo.UpdateSubscriptionRun(ctx, &ledger)
+		}
+		ledger.Attempts++
+		ledger.Status = repository.RunStatusTriggered
+		if err := s.publish(ctx, repo, sub, ledger); err != nil {
+			return err
+		}
+		if err := repo.UpdateSubscriptionRun(ctx, &ledger); err != nil {
+			return err
+		}
+		retried = &run.Event{
+			SubscriptionID: sub.ID,
+			OwnerID:        sub.OwnerID,
+			ScheduledAt:    ledger.ScheduledAt,
+			Type:           run.EventRetried,
+			OccurredAt:     time.Now(),
+		}
+		return nil
+	})
+	if errors.Is(err, errLocked) {
+		return nil
+	}
+	if err == nil && retried != nil {
+		s.runs.Publish(*retried)
+	}
+	return err
+}
+
+// publish queues the happen event of an attempt of ledger in the outbox of repo.
+func (s *scheduler) publish(ctx context.Context, repo *repository.Repository, sub repository.Subscription, ledger repository.SubscriptionRun) error {
+	return EnqueueHappen(ctx, repo, s.resource.Config.Pubsub.PublishTopic.RecurringHappen, sub, ledger)
+}
+
+// EnqueueHappen queues the happen event of the last attempt of ledger for
+// topic in the outbox of repo.
+func EnqueueHappen(ctx context.Context, repo *repository.Repository, topic string, sub repository.Subscription, ledger repository.SubscriptionRun) error {
+	data, err := json.Marshal(HappenEvent{
+		SubscriptionID: sub.ID,
+		OwnerID:        sub.OwnerID,
+		Amount:         sub.Amount,
+		Currency:       sub.Currency,
+		ScheduledAt:    ledger.ScheduledAt,
+		CorrelationID:  ledger.CorrelationID,
+		Attempt:        ledger.Attempts,
+	})
+	if err != nil {
+		return err
+	}
+	message := pubsub1.NewMessage(data, map[string]string{
+		"subscriptionId": strconv.FormatUint(sub.ID, 10),
+		"correlationId":  ledger.CorrelationID,
+		"attempt":        strconv.Itoa(ledger.Attempts),
+	})
+	return outbox.Enqueue(ctx, repo, topic, message)
+}
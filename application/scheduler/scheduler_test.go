@@ -0,0 +1,242 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"newdemo1/application/calendar"
+	"newdemo1/application/run"
+	"newdemo1/application/subscription"
+	"newdemo1/constant"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/infrastructure/repository/repositorytest"
+	"newdemo1/infrastructure/store"
+	"newdemo1/infrastructure/sync"
+	"newdemo1/resource"
+	"newdemo1/resource/jaeger/common/telemetry"
+	"newdemo1/resource/logger"
+	"testing"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(context.Context, string, ...zap.Field)         {}
+func (nopLogger) Warn(context.Context, string, ...zap.Field)         {}
+func (nopLogger) Error(context.Context, string, error, ...zap.Field) {}
+
+// ledger is a run ledger keyed by occurrence.
+type ledger map[repository.RunKey]repository.SubscriptionRun
+
+func (l ledger) FindSubscriptionRunForUpdate(_ context.Context, key repository.RunKey) (repository.SubscriptionRun, error) {
+	run, ok := l[key]
+	if !ok {
+		return repository.SubscriptionRun{}, constant.RunNotFound
+	}
+	return run, nil
+}
+
+type brokenLedger struct{}
+
+// locks grants every lock but the held ones, which another trigger holds.
+type locks map[string]bool
+
+func (l locks) Lock(_ context.Context, key string, _ ...redsync.Option) (sync.Unlock, error) {
+	if l[key] {
+		return nil, redsync.ErrFailed
+	}
+	return unlocked{}, nil
+}
+
+type unlocked struct{}
+
+func (unlocked) Unlock(context.Context) error { return nil }
+func (unlocked) Extend(context.Context) error { return nil }
+
+type nopMetrics struct {
+	telemetry.Metrics
+}
+
+func (nopMetrics) Count(string, int64, []string) {}
+
+// newScheduler returns a scheduler on an empty ledger, taking every lock but
+// the held ones, and a watch of the run events it publishes.
+func newScheduler(t *testing.T, held locks) (*scheduler, <-chan run.Event) {
+	res := &resource.Resource{Log: logger.Logger{Logger: nopLogger{}}}
+	res.Config.Pubsub.PublishTopic.RecurringHappen = "recurring-happen"
+	repo := repositorytest.New(t)
+	calendars, err := calendar.NewService(res, &infrastructure.Infrastructure{Store: &store.Store{Repository: repo}}, nil)
+	require.NoError(t, err)
+	runs := run.NewBroadcaster()
+	events, stop := runs.Watch(run.Filter{}, 10)
+	t.Cleanup(stop)
+	return &scheduler{resource: res, repo: repo, sync: held, batchSize: 10, lifecycle: subscription.NewLifecycle(res),
+		runs: runs, calendars: calendars, metrics: nopMetrics{}, misfireThreshold: time.Minute,
+		misfirePolicy: subscription.MisfireOnce, misfireMaxRuns: 10}, events
+}
+
+// newDue records a subscription firing every minute whose next run, the
+// current minute, is due.
+func newDue(t *testing.T, repo *repository.Repository) repository.Subscription {
+	next := time.Now().UTC().Truncate(time.Minute)
+	sub := repository.Subscription{OwnerID: "owner-1", Schedule: "* * * * *", Timezone: "UTC", Amount: 1500,
+		Currency: "IDR", Status: repository.SubscriptionStatusActive, StartAt: next.Add(-time.Hour), NextRunAt: &next}
+	require.NoError(t, repo.CreateSubscription(context.Background(), &sub))
+	return sub
+}
+
+// drain returns the types of the events published so far.
+func drain(events <-chan run.Event) []string {
+	var types []string
+	for len(events) > 0 {
+		types = append(types, (<-events).Type)
+	}
+	return types
+}
+
+func (brokenLedger) FindSubscriptionRunForUpdate(context.Context, repository.RunKey) (repository.SubscriptionRun, error) {
+	return repository.SubscriptionRun{}, errors.New("connection lost")
+}
+
+func TestOccurrenceKey(t *testing.T) {
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	jakarta := at.In(time.FixedZone("WIB", 7*60*60))
+
+	assert.Equal(t, "recurring:occurrence:42:1709283600000", occurrenceKey(42, at))
+	// The same instant in another zone is the same occurrence.
+	assert.Equal(t, occurrenceKey(42, at), occurrenceKey(42, jakarta))
+	assert.NotEqual(t, occurrenceKey(42, at), occurrenceKey(43, at))
+	assert.NotEqual(t, occurrenceKey(42, at), occurrenceKey(42, at.Add(time.Millisecond)))
+}
+
+func TestRecorded(t *testing.T) {
+	s := &scheduler{resource: &resource.Resource{Log: logger.Logger{Logger: nopLogger{}}}}
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	runs := ledger{{SubscriptionID: 42, ScheduledAt: at}: {ID: 7, SubscriptionID: 42, ScheduledAt: at}}
+
+	// A duplicate trigger of a recorded occurrence is ignored.
+	recorded, err := s.recorded(context.Background(), runs, 42, at)
+	assert.NoError(t, err)
+	assert.True(t, recorded)
+
+	recorded, err = s.recorded(context.Background(), runs, 42, at.AddDate(0, 0, 1))
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+	recorded, err = s.recorded(context.Background(), runs, 43, at)
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+
+	_, err = s.recorded(context.Background(), brokenLedger{}, 42, at)
+	assert.EqualError(t, err, "connection lost")
+}
+
+func TestTick(t *testing.T) {
+	ctx := context.Background()
+	s, events := newScheduler(t, locks{})
+	sub := newDue(t, s.repo)
+	due := *sub.NextRunAt
+
+	require.NoError(t, s.Tick(ctx))
+	fired, err := s.repo.FindSubscriptionRunForUpdate(ctx, repository.RunKey{SubscriptionID: sub.ID, ScheduledAt: due})
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusTriggered, fired.Status)
+	assert.Equal(t, 1, fired.Attempts)
+	assert.Empty(t, fired.Misfire)
+	advanced, err := s.repo.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, due.Add(time.Minute), *advanced.NextRunAt)
+	assert.EqualValues(t, 1, advanced.RunCount)
+	pending, err := s.repo.ListPendingOutboxMessages(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "recurring-happen", pending[0].Topic)
+	assert.Equal(t, fired.CorrelationID, pending[0].Attributes["correlationId"])
+	assert.Equal(t, []string{run.EventTriggered}, drain(events))
+
+}
+
+func TestTickRetry(t *testing.T) {
+	ctx := context.Background()
+	s, events := newScheduler(t, locks{})
+	sub := newDue(t, s.repo)
+	next := sub.NextRunAt.Add(time.Hour)
+	sub.NextRunAt = &next
+	require.NoError(t, s.repo.UpdateSubscription(ctx, &sub))
+	retryAt := time.Now().UTC().Add(-time.Second)
+	failed := repository.SubscriptionRun{SubscriptionID: sub.ID, OwnerID: sub.OwnerID, ScheduledAt: sub.StartAt,
+		TriggeredAt: sub.StartAt, CorrelationID: "failed", Status: repository.RunStatusFailed, Attempts: 1,
+		ErrorCode: "insufficient_funds", NextRetryAt: &retryAt}
+	require.NoError(t, s.repo.CreateSubscriptionRun(ctx, &failed))
+
+	// A failed run whose backoff passed is published again.
+	require.NoError(t, s.Tick(ctx))
+	retried, err := s.repo.GetSubscriptionRun(ctx, failed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.RunStatusTriggered, retried.Status)
+	assert.Equal(t, 2, retried.Attempts)
+	assert.Nil(t, retried.NextRetryAt)
+	pending, err := s.repo.ListPendingOutboxMessages(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "failed", pending[0].Attributes["correlationId"])
+	assert.Equal(t, "2", pending[0].Attributes["attempt"])
+	assert.Equal(t, []string{run.EventRetried}, drain(events))
+
+	// Once published it waits for its result.
+	require.NoError(t, s.Tick(ctx))
+	assert.Empty(t, drain(events))
+}
+
+func TestTickDuplicateTrigger(t *testing.T) {
+	ctx := context.Background()
+	s, events := newScheduler(t, locks{})
+	sub := newDue(t, s.repo)
+	due := *sub.NextRunAt
+	earlier := repository.SubscriptionRun{SubscriptionID: sub.ID, OwnerID: sub.OwnerID, ScheduledAt: due,
+		TriggeredAt: due, CorrelationID: "earlier", Status: repository.RunStatusTriggered, Attempts: 1}
+	require.NoError(t, s.repo.CreateSubscriptionRun(ctx, &earlier))
+
+	// An occurrence another trigger already recorded is not published again,
+	// but the subscription moves on.
+	require.NoError(t, s.Tick(ctx))
+	recorded, err := s.repo.FindSubscriptionRunForUpdate(ctx, repository.RunKey{SubscriptionID: sub.ID, ScheduledAt: due})
+	require.NoError(t, err)
+	assert.Equal(t, earlier.ID, recorded.ID)
+	assert.Equal(t, "earlier", recorded.CorrelationID)
+	pending, err := s.repo.ListPendingOutboxMessages(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	advanced, err := s.repo.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, due.Add(time.Minute), *advanced.NextRunAt)
+	assert.Empty(t, drain(events))
+}
+
+func TestTickOccurrenceLocked(t *testing.T) {
+	ctx := context.Background()
+	held := locks{}
+	s, events := newScheduler(t, held)
+	sub := newDue(t, s.repo)
+	due := *sub.NextRunAt
+	held[occurrenceKey(sub.ID, due)] = true
+
+	// An occurrence another trigger is recording is left to it.
+	require.NoError(t, s.Tick(ctx))
+	_, err := s.repo.FindSubscriptionRunForUpdate(ctx, repository.RunKey{SubscriptionID: sub.ID, ScheduledAt: due})
+	assert.ErrorIs(t, err, constant.RunNotFound)
+	untouched, err := s.repo.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, due, *untouched.NextRunAt)
+	assert.Empty(t, drain(events))
+
+	// The scheduler lock held by another replica skips the whole tick.
+	delete(held, occurrenceKey(sub.ID, due))
+	held[lockKey] = true
+	require.NoError(t, s.Tick(ctx))
+	assert.Empty(t, drain(events))
+}
@@ -0,0 +1,28 @@
+package subscription
+
+// Concurrency policies decide what happens to an occurrence that is due while
+// an earlier run of its subscription has not finished its job yet.
+const (
+	// ConcurrencyAllow fires the occurrence alongside the unfinished runs.
+	ConcurrencyAllow = "allow"
+	// ConcurrencyForbid skips the occurrence.
+	ConcurrencyForbid = "forbid"
+	// ConcurrencyReplace cancels the unfinished runs and fires the occurrence.
+	ConcurrencyReplace = "replace"
+)
+
+// Overlap applies a concurrency policy to an occurrence due while active runs
+// are unfinished, and reports whether to fire it and whether to replace them.
+func Overlap(policy string, active int) (fire bool, replace bool) {
+	if active == 0 {
+		return true, false
+	}
+	switch policy {
+	case ConcurrencyForbid:
+		return false, false
+	case ConcurrencyReplace:
+		return true, true
+	default:
+		return true, false
+	}
+}
@@ -0,0 +1,29 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverlap(t *testing.T) {
+	tests := []struct {
+		policy  string
+		active  int
+		fire    bool
+		replace bool
+	}{
+		{policy: ConcurrencyAllow, active: 0, fire: true},
+		{policy: ConcurrencyAllow, active: 2, fire: true},
+		{policy: "", active: 1, fire: true},
+		{policy: ConcurrencyForbid, active: 0, fire: true},
+		{policy: ConcurrencyForbid, active: 1, fire: false},
+		{policy: ConcurrencyReplace, active: 0, fire: true},
+		{policy: ConcurrencyReplace, active: 1, fire: true, replace: true},
+	}
+	for _, tt := range tests {
+		fire, replace := Overlap(tt.policy, tt.active)
+		assert.Equal(t, tt.fire, fire, "%s with %d active", tt.policy, tt.active)
+		assert.Equal(t, tt.replace, replace, "%s with %d active", tt.policy, tt.active)
+	}
+}
@@ -0,0 +1,71 @@
+package subscription
+
+import (
+	"bytes"
+	"fmt"
+	"newdemo1/infrastructure/repository"
+	"strings"
+	"time"
+)
+
+const (
+	icsTimeLayout = "20060102T150405Z"
+	// defaultICSDomain qualifies event UIDs when no domain is configured.
+	defaultICSDomain = "recurring.invalid"
+)
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// ICS renders the occurrences of sub as an iCalendar (RFC 5545) document with
+// one event per occurrence. Times are written in UTC; the amount is in the
+// minor unit of the currency. domain makes the event UIDs globally unique.
+func ICS(sub repository.Subscription, occurrences []time.Time, stamp time.Time, domain string) []byte {
+	summary := sub.Description
+	if summary == "" {
+		summary = fmt.Sprintf("Subscription %d", sub.ID)
+	}
+	if domain == "" {
+		domain = defaultICSDomain
+	}
+
+	var buf bytes.Buffer
+	line := func(format string, args ...interface{}) {
+		writeICSLine(&buf, fmt.Sprintf(format, args...))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//%s//recurring//EN", domain)
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:%s", icsEscaper.Replace(summary))
+	for _, at := range occurrences {
+		line("BEGIN:VEVENT")
+		line("UID:subscription-%d-%d@%s", sub.ID, at.Unix(), domain)
+		line("DTSTAMP:%s", stamp.UTC().Format(icsTimeLayout))
+		line("DTSTART:%s", at.UTC().Format(icsTimeLayout))
+		line("SUMMARY:%s", icsEscaper.Replace(summary))
+		line("DESCRIPTION:%s", icsEscaper.Replace(fmt.Sprintf("Amount %d %s", sub.Amount, sub.Currency)))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// writeICSLine ends a content line with CRLF, folding it after 75 octets
+// without splitting a UTF-8 sequence.
+func writeICSLine(buf *bytes.Buffer, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		buf.WriteString(s[:cut])
+		buf.WriteString("\r\n ")
+		s = s[cut:]
+		// A continuation line starts with the folding space.
+		limit = 74
+	}
+	buf.WriteString(s)
+	buf.WriteString("\r\n")
+}
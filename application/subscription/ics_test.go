@@ -0,0 +1,32 @@
+package subscription
+
+import (
+	"newdemo1/infrastructure/repository"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICS(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*3600)
+	sub := repository.Subscription{ID: 7, Amount: 150000, Currency: "IDR", Description: "Rent, flat; " + strings.Repeat("x", 80)}
+	stamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ics := string(ICS(sub, []time.Time{time.Date(2024, 2, 1, 9, 0, 0, 0, jakarta)}, stamp, "recurring.example"))
+
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+	assert.Contains(t, ics, "UID:subscription-7-1706752800@recurring.example\r\n")
+	assert.Contains(t, ics, "DTSTAMP:20240101T000000Z\r\n")
+	assert.Contains(t, ics, "DTSTART:20240201T020000Z\r\n")
+	assert.Contains(t, ics, "DESCRIPTION:Amount 150000 IDR\r\n")
+	assert.Contains(t, ics, `SUMMARY:Rent\, flat\; xxx`)
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+	assert.Contains(t, ics, "\r\n x")
+
+	ics = string(ICS(sub, []time.Time{time.Date(2024, 2, 1, 9, 0, 0, 0, jakarta)}, stamp, ""))
+	assert.Contains(t, ics, "UID:subscription-7-1706752800@recurring.invalid\r\n")
+}
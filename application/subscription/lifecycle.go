@@ -0,0 +1,154 @@
+package subscription
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"newdemo1/application/calendar"
+	"newdemo1/application/outbox"
+	"newdemo1/constant"
+	"newdemo1/infrastructure/mq/pubsub1"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/resource"
+	commonErr "newdemo1/resource/jaeger/common/error"
+	"strconv"
+	"time"
+)
+
+// EventStatusChanged is the eventType attribute of status-changed events.
+const EventStatusChanged = "subscription.status-changed"
+
+// transitions lists the statuses each status may move to. Cancelled, completed
+// and expired are terminal.
+var transitions = map[string][]string{
+	repository.SubscriptionStatusActive: {
+		repository.SubscriptionStatusPaused,
+		repository.SubscriptionStatusCancelled,
+		repository.SubscriptionStatusCompleted,
+		repository.SubscriptionStatusExpired,
+	},
+	repository.SubscriptionStatusPaused: {
+		repository.SubscriptionStatusActive,
+		repository.SubscriptionStatusCancelled,
+		repository.SubscriptionStatusCompleted,
+		repository.SubscriptionStatusExpired,
+	},
+}
+
+type (
+	// Lifecycle moves subscriptions between statuses, keeping their history
+	// and announcing every change.
+	Lifecycle struct {
+		topic string
+	}
+
+	// StatusChangedEvent is published for every status transition.
+	StatusChangedEvent struct {
+		SubscriptionID uint64    `json:"subscriptionId"`
+		OwnerID        string    `json:"ownerId"`
+		From           string    `json:"from"`
+		To             string    `json:"to"`
+		Reason         string    `json:"reason"`
+		ChangedAt      time.Time `json:"changedAt"`
+	}
+)
+
+func NewLifecycle(resource *resource.Resource) Lifecycle {
+	return Lifecycle{topic: resource.Config.Pubsub.PublishTopic.SubscriptionStatusChanged}
+}
+
+// CanTransition reports whether a subscription in status from may move to status to.
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves sub to status to and saves it through repo together with the
+// history entry and the status-changed event, so repo should be the repository
+// of a transaction. Leaving active clears the next run.
+func (l Lifecycle) Transition(ctx context.Context, repo *repository.Repository, sub *repository.Subscription, to, reason string) error {
+	from := sub.Status
+	if !CanTransition(from, to) {
+		return commonErr.ServiceError{
+			Code:    constant.IllegalTransition.Code,
+			Message: fmt.Sprintf("subscription %d cannot move from %s to %s", sub.ID, from, to),
+		}
+	}
+
+	now := time.Now()
+	sub.Status = to
+	sub.StatusReason = reason
+	sub.StatusChangedAt = &now
+	if to != repository.SubscriptionStatusActive {
+		sub.NextRunAt = nil
+	}
+	if err := repo.UpdateSubscription(ctx, sub); err != nil {
+		return err
+	}
+	if err := repo.CreateSubscriptionTransition(ctx, &repository.SubscriptionTransition{
+		SubscriptionID: sub.ID,
+		From:           from,
+		To:             to,
+		Reason:         reason,
+	}); err != nil {
+		return err
+	}
+
+	if l.topic == "" {
+		return nil
+	}
+	data, err := json.Marshal(StatusChangedEvent{
+		SubscriptionID: sub.ID,
+		OwnerID:        sub.OwnerID,
+		From:           from,
+		To:             to,
+		Reason:         reason,
+		ChangedAt:      now,
+	})
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, repo, l.topic, pubsub1.NewMessage(data, map[string]string{
+		"subscriptionId": strconv.FormatUint(sub.ID, 10),
+		"eventType":      EventStatusChanged,
+	}))
+}
+
+// Advance sets the next run of sub to the first occurrence after the given
+// time, adjusted on cal. It returns the terminal status the subscription must move to instead
+// when the schedule is exhausted or the occurrence falls after EndAt, and ""
+// otherwise.
+func Advance(sub *repository.Subscription, cal calendar.Calendar, after time.Time) (string, error) {
+	rule, err := Schedule(*sub, cal)
+	if err != nil {
+		return "", err
+	}
+	sub.NextRunAt = nil
+	next, ok := rule.Next(after)
+	if !ok {
+		return repository.SubscriptionStatusCompleted, nil
+	}
+	if sub.EndAt != nil && next.After(*sub.EndAt) {
+		return repository.SubscriptionStatusExpired, nil
+	}
+	sub.NextRunAt = &next
+	return "", nil
+}
+
+// FirstRunAfter returns the time a new subscription starting at start takes
+// its first occurrence after: just before start, after lastRun when it ran
+// elsewhere until then, and not before now when its missed occurrences are skipped.
+func FirstRunAfter(start time.Time, lastRun *time.Time, skipMissed bool, now time.Time) time.Time {
+	after := start.Add(-time.Nanosecond)
+	if lastRun != nil && lastRun.After(after) {
+		after = *lastRun
+	}
+	if skipMissed && now.After(after) {
+		after = now
+	}
+	return after
+}
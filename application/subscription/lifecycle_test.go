@@ -0,0 +1,85 @@
+package subscription
+
+import (
+	"newdemo1/application/calendar"
+	"newdemo1/infrastructure/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{repository.SubscriptionStatusActive, repository.SubscriptionStatusPaused, true},
+		{repository.SubscriptionStatusActive, repository.SubscriptionStatusActive, false},
+		{repository.SubscriptionStatusPaused, repository.SubscriptionStatusActive, true},
+		{repository.SubscriptionStatusPaused, repository.SubscriptionStatusPaused, false},
+		{repository.SubscriptionStatusPaused, repository.SubscriptionStatusCancelled, true},
+		{repository.SubscriptionStatusCancelled, repository.SubscriptionStatusActive, false},
+		{repository.SubscriptionStatusCompleted, repository.SubscriptionStatusPaused, false},
+		{repository.SubscriptionStatusExpired, repository.SubscriptionStatusActive, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CanTransition(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
+
+func TestFirstRunAfter(t *testing.T) {
+	start := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+	lastRun := time.Date(2023, 6, 1, 9, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, start.Add(-time.Nanosecond), FirstRunAfter(start, nil, false, now))
+	assert.Equal(t, lastRun, FirstRunAfter(start, &lastRun, false, now))
+	assert.Equal(t, now, FirstRunAfter(start, nil, true, now))
+	assert.Equal(t, now, FirstRunAfter(start, &lastRun, true, now))
+	// A future start is kept, skipped or not.
+	future := now.AddDate(0, 1, 0)
+	assert.Equal(t, future.Add(-time.Nanosecond), FirstRunAfter(future, nil, true, now))
+}
+
+func TestAdvance(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	sub := repository.Subscription{Schedule: "FREQ=DAILY;COUNT=3", Timezone: "UTC", StartAt: start}
+
+	terminal, err := Advance(&sub, calendar.Calendar{}, start)
+	require.NoError(t, err)
+	assert.Equal(t, "", terminal)
+	assert.Equal(t, start.AddDate(0, 0, 1), *sub.NextRunAt)
+
+	terminal, err = Advance(&sub, calendar.Calendar{}, start.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, repository.SubscriptionStatusCompleted, terminal)
+	assert.Nil(t, sub.NextRunAt)
+
+	end := start.AddDate(0, 0, 1)
+	sub = repository.Subscription{Schedule: "0 9 * * *", Timezone: "UTC", StartAt: start, EndAt: &end}
+	terminal, err = Advance(&sub, calendar.Calendar{}, end)
+	require.NoError(t, err)
+	assert.Equal(t, repository.SubscriptionStatusExpired, terminal)
+	assert.Nil(t, sub.NextRunAt)
+}
+
+func TestAdvanceTimezone(t *testing.T) {
+	// 09:00 in New York is 14:00 UTC in winter and 13:00 UTC once DST starts.
+	start := time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+	sub := repository.Subscription{Schedule: "0 9 * * *", Timezone: "America/New_York", StartAt: start}
+
+	terminal, err := Advance(&sub, calendar.Calendar{}, start)
+	require.NoError(t, err)
+	assert.Empty(t, terminal)
+	assert.Equal(t, time.Date(2024, 3, 8, 14, 0, 0, 0, time.UTC), sub.NextRunAt.UTC())
+
+	_, err = Advance(&sub, calendar.Calendar{}, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC), sub.NextRunAt.UTC())
+
+	sub.Timezone = "Mars/Olympus_Mons"
+	_, err = Advance(&sub, calendar.Calendar{}, start)
+	assert.Error(t, err)
+}
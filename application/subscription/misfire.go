@@ -0,0 +1,103 @@
+package subscription
+
+import (
+	"newdemo1/application/calendar"
+	"newdemo1/infrastructure/repository"
+	"time"
+)
+
+// Misfire policies decide what happens to the occurrences a subscription
+// missed while no scheduler was running.
+const (
+	// MisfireSkip drops every missed occurrence.
+	MisfireSkip = "skip"
+	// MisfireOnce fires the latest missed occurrence, at or before the cutoff,
+	// and drops the others.
+	MisfireOnce = "once"
+	// MisfireAll fires the missed occurrences in order, up to a cap.
+	MisfireAll = "all"
+)
+
+// maxMissed bounds the missed occurrences one catch-up lists one by one, the
+// earliest ones. The newer ones past it are only counted in Catchup.Capped,
+// except the latest, which MisfireOnce fires.
+const maxMissed = 1000
+
+type (
+	// Catchup lists the missed occurrences to fire and to skip, earliest first.
+	// Capped summarises the skipped occurrences past maxMissed.
+	Catchup struct {
+		Fire   []time.Time
+		Skip   []time.Time
+		Capped Capped
+	}
+
+	// Capped counts the missed occurrences from First to Last that are skipped
+	// without being listed.
+	Capped struct {
+		Count       int
+		First, Last time.Time
+	}
+)
+
+// PlanCatchup applies a misfire policy to the occurrences of sub from its next
+// run up to and including cutoff, adjusted on cal. maxRuns caps MisfireAll.
+func PlanCatchup(sub repository.Subscription, cal calendar.Calendar, policy string, maxRuns int, cutoff time.Time) (Catchup, error) {
+	if sub.NextRunAt == nil {
+		return Catchup{}, nil
+	}
+	rule, err := Schedule(sub, cal)
+	if err != nil {
+		return Catchup{}, err
+	}
+
+	var (
+		missed []time.Time
+		capped Capped
+		// beforeLast is the occurrence capped.Last follows.
+		beforeLast time.Time
+	)
+	for next, ok := *sub.NextRunAt, true; ok && !next.After(cutoff); next, ok = rule.Next(next) {
+		if sub.EndAt != nil && next.After(*sub.EndAt) {
+			break
+		}
+		if len(missed) < maxMissed {
+			missed = append(missed, next)
+			continue
+		}
+		if capped.Count == 0 {
+			capped.First = next
+		}
+		capped.Count++
+		beforeLast, capped.Last = capped.Last, next
+	}
+	if len(missed) == 0 {
+		return Catchup{}, nil
+	}
+
+	switch policy {
+	case MisfireSkip:
+		return Catchup{Skip: missed, Capped: capped}, nil
+	case MisfireOnce:
+		if capped.Count == 0 {
+			last := len(missed) - 1
+			return Catchup{Fire: missed[last:], Skip: missed[:last]}, nil
+		}
+		// The latest missed occurrence is past the cap: fire it, not the last listed.
+		latest := capped.Last
+		if capped.Count--; capped.Count == 0 {
+			capped = Capped{}
+		} else {
+			capped.Last = beforeLast
+		}
+		return Catchup{Fire: []time.Time{latest}, Skip: missed, Capped: capped}, nil
+	default:
+		if maxRuns < 0 {
+			maxRuns = 0
+		}
+		if maxRuns > len(missed) {
+			maxRuns = len(missed)
+		}
+		return Catchup{Fire: missed[:maxRuns], Skip: missed[maxRuns:], Capped: capped}, nil
+	}
+}
@@ -0,0 +1,81 @@
+package subscription
+
+import (
+	"newdemo1/application/calendar"
+	"newdemo1/infrastructure/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanCatchup(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hour := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+	sub := repository.Subscription{Schedule: "0 * * * *", Timezone: "UTC", StartAt: start}
+	next := hour(1)
+	sub.NextRunAt = &next
+	cutoff := hour(4).Add(30 * time.Minute)
+
+	plan, err := PlanCatchup(sub, calendar.Calendar{}, MisfireSkip, 0, cutoff)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Fire)
+	assert.Equal(t, []time.Time{hour(1), hour(2), hour(3), hour(4)}, plan.Skip)
+
+	plan, err = PlanCatchup(sub, calendar.Calendar{}, MisfireOnce, 0, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{hour(4)}, plan.Fire)
+	assert.Equal(t, []time.Time{hour(1), hour(2), hour(3)}, plan.Skip)
+
+	plan, err = PlanCatchup(sub, calendar.Calendar{}, MisfireAll, 3, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{hour(1), hour(2), hour(3)}, plan.Fire)
+	assert.Equal(t, []time.Time{hour(4)}, plan.Skip)
+
+	// Occurrences after EndAt are not missed, they never happen.
+	end := hour(2)
+	sub.EndAt = &end
+	plan, err = PlanCatchup(sub, calendar.Calendar{}, MisfireAll, 10, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{hour(1), hour(2)}, plan.Fire)
+	assert.Empty(t, plan.Skip)
+}
+
+func TestPlanCatchupPastCap(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	minute := func(m int) time.Time { return start.Add(time.Duration(m) * time.Minute) }
+	sub := repository.Subscription{Schedule: "* * * * *", Timezone: "UTC", StartAt: start}
+	next := minute(0)
+	sub.NextRunAt = &next
+	// 1500 occurrences were missed, minute(0) to minute(1499).
+	cutoff := minute(1499).Add(30 * time.Second)
+
+	plan, err := PlanCatchup(sub, calendar.Calendar{}, MisfireOnce, 0, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{minute(1499)}, plan.Fire)
+	assert.Len(t, plan.Skip, maxMissed)
+	assert.Equal(t, minute(0), plan.Skip[0])
+	assert.Equal(t, minute(maxMissed-1), plan.Skip[maxMissed-1])
+	assert.Equal(t, Capped{Count: 499, First: minute(1000), Last: minute(1498)}, plan.Capped)
+
+	plan, err = PlanCatchup(sub, calendar.Calendar{}, MisfireSkip, 0, cutoff)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Fire)
+	assert.Len(t, plan.Skip, maxMissed)
+	assert.Equal(t, Capped{Count: 500, First: minute(1000), Last: minute(1499)}, plan.Capped)
+
+	plan, err = PlanCatchup(sub, calendar.Calendar{}, MisfireAll, 10, cutoff)
+	require.NoError(t, err)
+	assert.Len(t, plan.Fire, 10)
+	assert.Len(t, plan.Skip, maxMissed-10)
+	assert.Equal(t, Capped{Count: 500, First: minute(1000), Last: minute(1499)}, plan.Capped)
+
+	// One past the cap: the latest fires and nothing is left to summarise.
+	cutoff = minute(maxMissed)
+	plan, err = PlanCatchup(sub, calendar.Calendar{}, MisfireOnce, 0, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{minute(maxMissed)}, plan.Fire)
+	assert.Len(t, plan.Skip, maxMissed)
+	assert.Zero(t, plan.Capped)
+}
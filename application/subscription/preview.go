@@ -0,0 +1,161 @@
+package subscription
+
+import (
+	"context"
+	"newdemo1/application/recurrence"
+	"newdemo1/constant"
+	"newdemo1/infrastructure/repository"
+	commonErr "newdemo1/resource/jaeger/common/error"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+const (
+	defaultPreviewCount = 10
+	defaultExportCount  = 50
+)
+
+type (
+	// PreviewRequest is a draft schedule described the way CreateRequest does.
+	// StartAt defaults to now.
+	PreviewRequest struct {
+		Schedule   string     `json:"schedule" validate:"required,max=512"`
+		Timezone   string     `json:"timezone" validate:"max=64"`
+		Calendar   string     `json:"calendar" validate:"max=64"`
+		Adjustment string     `json:"adjustment" validate:"omitempty,oneof=none following modified-following preceding"`
+		StartAt    *time.Time `json:"startAt"`
+		EndAt      *time.Time `json:"endAt"`
+		Count      int        `json:"count" validate:"gte=0,lte=366"`
+	}
+	// UpcomingRequest bounds the occurrences listed for a subscription.
+	UpcomingRequest struct {
+		Count int `form:"count" validate:"gte=0,lte=366"`
+	}
+
+	// Preview lists occurrences in Timezone, adjusted for business days.
+	Preview struct {
+		Timezone    string      `json:"timezone"`
+		Occurrences []time.Time `json:"occurrences"`
+	}
+)
+
+func (s *service) Preview(ctx context.Context, req PreviewRequest) (Preview, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.Preview")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return Preview{}, err
+	}
+	draft := repository.Subscription{
+		Schedule:   req.Schedule,
+		Timezone:   req.Timezone,
+		Calendar:   req.Calendar,
+		Adjustment: req.Adjustment,
+		StartAt:    time.Now(),
+		EndAt:      req.EndAt,
+	}
+	if draft.Timezone == "" {
+		draft.Timezone = s.defaultTimezone()
+	}
+	if req.StartAt != nil {
+		draft.StartAt = *req.StartAt
+	}
+	if draft.EndAt != nil && !draft.EndAt.After(draft.StartAt) {
+		return Preview{}, commonErr.ServiceError{
+			Code:    constant.InvalidRequest.Code,
+			Message: "endAt must be after startAt",
+		}
+	}
+	cal, err := s.calendar(ctx, draft)
+	if err != nil {
+		return Preview{}, err
+	}
+	rule, err := Schedule(draft, cal)
+	if err != nil {
+		return Preview{}, err
+	}
+	return Preview{
+		Timezone:    draft.Timezone,
+		Occurrences: occurrences(rule, draft.EndAt, draft.StartAt.Add(-time.Nanosecond), countOrDefault(req.Count, defaultPreviewCount)),
+	}, nil
+}
+
+func (s *service) Upcoming(ctx context.Context, id uint64, req UpcomingRequest) (Preview, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.Upcoming")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return Preview{}, err
+	}
+	sub, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return Preview{}, err
+	}
+	return s.upcoming(ctx, sub, countOrDefault(req.Count, defaultPreviewCount))
+}
+
+func (s *service) ExportICS(ctx context.Context, id uint64, req UpcomingRequest) ([]byte, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.ExportICS")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return nil, err
+	}
+	sub, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	preview, err := s.upcoming(ctx, sub, countOrDefault(req.Count, defaultExportCount))
+	if err != nil {
+		return nil, err
+	}
+	return ICS(sub, preview.Occurrences, time.Now(), s.resource.Config.Calendar.Domain), nil
+}
+
+// upcoming lists the occurrences of sub from its next run, or from now when it
+// is paused since resuming skips the ones missed meanwhile. A subscription
+// that ended has none.
+func (s *service) upcoming(ctx context.Context, sub repository.Subscription, n int) (Preview, error) {
+	preview := Preview{Timezone: sub.Timezone, Occurrences: []time.Time{}}
+	after := time.Now()
+	switch {
+	case sub.Status == repository.SubscriptionStatusActive && sub.NextRunAt != nil:
+		after = sub.NextRunAt.Add(-time.Nanosecond)
+	case sub.Status != repository.SubscriptionStatusPaused:
+		return preview, nil
+	}
+	cal, err := s.calendars.Get(ctx, sub.Calendar)
+	if err != nil {
+		return Preview{}, err
+	}
+	rule, err := Schedule(sub, cal)
+	if err != nil {
+		return Preview{}, err
+	}
+	preview.Occurrences = occurrences(rule, sub.EndAt, after, n)
+	return preview, nil
+}
+
+// occurrences returns up to n occurrences of rule after the given time and not after end.
+func occurrences(rule recurrence.Rule, end *time.Time, after time.Time, n int) []time.Time {
+	list := make([]time.Time, 0, n)
+	for len(list) < n {
+		next, ok := rule.Next(after)
+		if !ok || (end != nil && next.After(*end)) {
+			break
+		}
+		list = append(list, next)
+		after = next
+	}
+	return list
+}
+
+func countOrDefault(n, fallback int) int {
+	if n == 0 {
+		return fallback
+	}
+	return n
+}
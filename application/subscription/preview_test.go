@@ -0,0 +1,22 @@
+package subscription
+
+import (
+	"newdemo1/application/recurrence"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOccurrences(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	rule, err := recurrence.Parse("FREQ=DAILY", start)
+	require.NoError(t, err)
+
+	assert.Equal(t, []time.Time{start, start.AddDate(0, 0, 1)}, occurrences(rule, nil, start.Add(-time.Nanosecond), 2))
+
+	end := start.AddDate(0, 0, 2)
+	assert.Len(t, occurrences(rule, &end, start.Add(-time.Nanosecond), 10), 3)
+	assert.Empty(t, occurrences(rule, &end, end, 10))
+}
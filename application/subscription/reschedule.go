@@ -0,0 +1,63 @@
+package subscription
+
+import (
+	"context"
+	"newdemo1/application/calendar"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/resource"
+	"time"
+)
+
+// Rescheduler moves the next run of the active subscriptions a calendar adjusts
+// when its holidays change, so a stored next run never falls on a day the
+// calendar no longer treats as a business day.
+type Rescheduler struct {
+	lifecycle Lifecycle
+}
+
+func NewRescheduler(resource *resource.Resource) Rescheduler {
+	return Rescheduler{lifecycle: NewLifecycle(resource)}
+}
+
+// Reschedule recomputes through repo, the repository of the transaction that
+// changed cal, the next run of every active subscription cal adjusts. A next
+// run already due is left to the scheduler, which may be firing it.
+func (r Rescheduler) Reschedule(ctx context.Context, repo *repository.Repository, cal calendar.Calendar) error {
+	now := time.Now()
+	subs, err := repo.ListActiveSubscriptionsByCalendarForUpdate(ctx, cal.Name, now)
+	if err != nil {
+		return err
+	}
+	for i := range subs {
+		sub := &subs[i]
+		terminal, changed, err := reschedule(sub, cal, now)
+		if err != nil {
+			return err
+		}
+		if terminal != "" {
+			if err := r.lifecycle.Transition(ctx, repo, sub, terminal, "calendar "+cal.Name+" moved the next run past the end date"); err != nil {
+				return err
+			}
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := repo.UpdateSubscription(ctx, sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reschedule sets the next run of sub to its first occurrence after now on
+// cal, reporting whether it moved and the terminal status sub must move to
+// instead, as Advance does.
+func reschedule(sub *repository.Subscription, cal calendar.Calendar, now time.Time) (string, bool, error) {
+	previous := sub.NextRunAt
+	terminal, err := Advance(sub, cal, now)
+	if err != nil || terminal != "" {
+		return terminal, true, err
+	}
+	return "", previous == nil || !previous.Equal(*sub.NextRunAt), nil
+}
@@ -0,0 +1,48 @@
+package subscription
+
+import (
+	"newdemo1/application/calendar"
+	"newdemo1/infrastructure/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReschedule(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 3, 11, 12, 0, 0, 0, time.UTC)
+	tuesday := time.Date(2024, 3, 12, 9, 0, 0, 0, time.UTC)
+	sub := repository.Subscription{Schedule: "0 9 * * *", Timezone: "UTC", StartAt: start,
+		Adjustment: calendar.AdjustFollowing, NextRunAt: &tuesday}
+
+	plain, err := calendar.New("desk", "", calendar.SourceDatabase, calendar.DefaultWeekend, nil)
+	require.NoError(t, err)
+	terminal, changed, err := reschedule(&sub, plain, now)
+	require.NoError(t, err)
+	assert.Empty(t, terminal)
+	assert.False(t, changed)
+
+	// A holiday on the next run moves it to the following business day.
+	holiday, err := calendar.New("desk", "", calendar.SourceDatabase, calendar.DefaultWeekend,
+		[]calendar.Holiday{{Date: "2024-03-12"}})
+	require.NoError(t, err)
+	terminal, changed, err = reschedule(&sub, holiday, now)
+	require.NoError(t, err)
+	assert.Empty(t, terminal)
+	assert.True(t, changed)
+	assert.Equal(t, tuesday.AddDate(0, 0, 1), *sub.NextRunAt)
+
+	// Removing it brings the next run back.
+	_, changed, err = reschedule(&sub, plain, now)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, tuesday, *sub.NextRunAt)
+
+	end := tuesday.Add(time.Hour)
+	sub.EndAt = &end
+	terminal, _, err = reschedule(&sub, holiday, now)
+	require.NoError(t, err)
+	assert.Equal(t, repository.SubscriptionStatusExpired, terminal)
+}
@@ -0,0 +1,71 @@
+package subscription
+
+import (
+	"math"
+	"math/rand"
+	"newdemo1/infrastructure/repository"
+	"sync"
+	"time"
+)
+
+// defaultExhaustedStatus is where a subscription goes when its retries run out
+// and its policy names no status.
+const defaultExhaustedStatus = repository.SubscriptionStatusPaused
+
+var (
+	jitterMu     sync.Mutex
+	jitterSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// ShouldRetry reports whether a run that failed with code on the given attempt
+// is published again.
+func ShouldRetry(policy repository.RetryPolicy, attempt int, code string) bool {
+	if attempt >= policy.MaxAttempts {
+		return false
+	}
+	if len(policy.RetryableCodes) == 0 {
+		return true
+	}
+	for _, retryable := range policy.RetryableCodes {
+		if retryable == code {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryDelay returns the wait after a failed attempt: the initial backoff grown
+// by Multiplier for every earlier attempt, spread by up to Jitter of itself in
+// either direction. random must be in [0, 1).
+func RetryDelay(policy repository.RetryPolicy, attempt int, random float64) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(policy.InitialBackoffMs) * math.Pow(multiplier, float64(attempt-1))
+	delay *= 1 + policy.Jitter*(2*random-1)
+	if delay >= float64(math.MaxInt64/int64(time.Millisecond)) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// NextRetry returns when a run that failed on the given attempt at now is published again.
+func NextRetry(policy repository.RetryPolicy, attempt int, now time.Time) time.Time {
+	jitterMu.Lock()
+	random := jitterSource.Float64()
+	jitterMu.Unlock()
+	return now.Add(RetryDelay(policy, attempt, random))
+}
+
+// ExhaustedStatus returns the status a subscription moves to once a run used
+// up its retries, or "" when the policy does not retry at all.
+func ExhaustedStatus(policy repository.RetryPolicy) string {
+	if policy.MaxAttempts <= 1 {
+		return ""
+	}
+	if policy.ExhaustedStatus == "" {
+		return defaultExhaustedStatus
+	}
+	return policy.ExhaustedStatus
+}
@@ -0,0 +1,45 @@
+package subscription
+
+import (
+	"newdemo1/infrastructure/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRetry(t *testing.T) {
+	policy := repository.RetryPolicy{MaxAttempts: 3}
+	assert.True(t, ShouldRetry(policy, 1, "E1"))
+	assert.True(t, ShouldRetry(policy, 2, "E1"))
+	assert.False(t, ShouldRetry(policy, 3, "E1"))
+
+	policy.RetryableCodes = []string{"E1"}
+	assert.True(t, ShouldRetry(policy, 1, "E1"))
+	assert.False(t, ShouldRetry(policy, 1, "E2"))
+
+	assert.False(t, ShouldRetry(repository.RetryPolicy{}, 1, "E1"))
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := repository.RetryPolicy{InitialBackoffMs: 1000, Multiplier: 2}
+	assert.Equal(t, time.Second, RetryDelay(policy, 1, 0.5))
+	assert.Equal(t, 2*time.Second, RetryDelay(policy, 2, 0.5))
+	assert.Equal(t, 4*time.Second, RetryDelay(policy, 3, 0.5))
+
+	policy.Jitter = 0.5
+	assert.Equal(t, 500*time.Millisecond, RetryDelay(policy, 1, 0))
+	assert.Equal(t, 1250*time.Millisecond, RetryDelay(policy, 1, 0.75))
+
+	// A multiplier below one keeps the backoff constant.
+	assert.Equal(t, time.Second, RetryDelay(repository.RetryPolicy{InitialBackoffMs: 1000}, 5, 0.5))
+}
+
+func TestExhaustedStatus(t *testing.T) {
+	assert.Equal(t, "", ExhaustedStatus(repository.RetryPolicy{MaxAttempts: 1}))
+	assert.Equal(t, repository.SubscriptionStatusPaused, ExhaustedStatus(repository.RetryPolicy{MaxAttempts: 3}))
+	assert.Equal(t, repository.SubscriptionStatusCancelled, ExhaustedStatus(repository.RetryPolicy{
+		MaxAttempts:     3,
+		ExhaustedStatus: repository.SubscriptionStatusCancelled,
+	}))
+}
@@ -0,0 +1,475 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"newdemo1/application/calendar"
+	"newdemo1/application/recurrence"
+	"newdemo1/constant"
+	"newdemo1/infrastructure"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/resource"
+	commonErr "newdemo1/resource/jaeger/common/error"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+type (
+	Service interface {
+		Create(ctx context.Context, req CreateRequest) (repository.Subscription, error)
+		Get(ctx context.Context, id uint64) (repository.Subscription, error)
+		Update(ctx context.Context, id uint64, req UpdateRequest) (repository.Subscription, error)
+		List(ctx context.Context, req ListRequest) ([]repository.Subscription, int64, error)
+		Pause(ctx context.Context, id uint64, req TransitionRequest) (repository.Subscription, error)
+		// Resume reactivates a paused subscription from its first occurrence after now.
+		Resume(ctx context.Context, id uint64, req TransitionRequest) (repository.Subscription, error)
+		Cancel(ctx context.Context, id uint64, req TransitionRequest) (repository.Subscription, error)
+		Transitions(ctx context.Context, id uint64) ([]repository.SubscriptionTransition, error)
+		// Preview lists the next occurrences of a draft schedule without saving it.
+		Preview(ctx context.Context, req PreviewRequest) (Preview, error)
+		// Upcoming lists the next occurrences of a subscription.
+		Upcoming(ctx context.Context, id uint64, req UpcomingRequest) (Preview, error)
+		// ExportICS renders the next occurrences of a subscription as an iCalendar file.
+		ExportICS(ctx context.Context, id uint64, req UpcomingRequest) ([]byte, error)
+	}
+	service struct {
+		resource  *resource.Resource
+		repo      *repository.Repository
+		lifecycle Lifecycle
+		calendars calendar.Service
+	}
+
+	// CreateRequest registers a subscription; Timezone is an IANA zone and
+	// defaults to the configured process zone. Adjustment moves occurrences off
+	// the non-business days of Calendar, a Saturday-Sunday weekend when empty.
+	// ExternalRef, when given, must be unique. ConcurrencyPolicy defaults to
+	// allowing overlapping runs. A subscription moved from another system gives
+	// the LastRunAt it ran there, or SkipMissed, so the occurrences already
+	// charged there are not run again.
+	CreateRequest struct {
+		ExternalRef string       `json:"externalRef" validate:"max=128"`
+		OwnerID     string       `json:"ownerId" validate:"required,max=64"`
+		Schedule    string       `json:"schedule" validate:"required,max=512"`
+		Timezone    string       `json:"timezone" validate:"max=64"`
+		Calendar    string       `json:"calendar" validate:"max=64"`
+		Adjustment  string       `json:"adjustment" validate:"omitempty,oneof=none following modified-following preceding"`
+		Amount      int64        `json:"amount" validate:"gt=0"`
+		Currency    string       `json:"currency" validate:"required,len=3"`
+		Description string       `json:"description" validate:"max=255"`
+		StartAt     *time.Time   `json:"startAt"`
+		EndAt       *time.Time   `json:"endAt"`
+		RetryPolicy *RetryPolicy `json:"retryPolicy"`
+		// MisfirePolicy and MisfireMaxRuns default to the scheduler configuration.
+		MisfirePolicy     string `json:"misfirePolicy" validate:"omitempty,oneof=skip once all"`
+		MisfireMaxRuns    int    `json:"misfireMaxRuns" validate:"gte=0,lte=100"`
+		ConcurrencyPolicy string `json:"concurrencyPolicy" validate:"omitempty,oneof=allow forbid replace"`
+		// LastRunAt and SkipMissed are only set by a bulk import, never decoded
+		// from an API request. SkipMissed starts at the first occurrence after
+		// now when StartAt is past.
+		LastRunAt  *time.Time `json:"-"`
+		SkipMissed bool       `json:"-"`
+	}
+	// UpdateRequest changes the given fields; a RetryPolicy replaces the whole policy.
+	UpdateRequest struct {
+		Schedule    *string      `json:"schedule" validate:"omitempty,max=512"`
+		Timezone    *string      `json:"timezone" validate:"omitempty,max=64"`
+		Calendar    *string      `json:"calendar" validate:"omitempty,max=64"`
+		Adjustment  *string      `json:"adjustment" validate:"omitempty,oneof=none following modified-following preceding"`
+		Amount      *int64       `json:"amount" validate:"omitempty,gt=0"`
+		Currency    *string      `json:"currency" validate:"omitempty,len=3"`
+		Description *string      `json:"description" validate:"omitempty,max=255"`
+		RetryPolicy *RetryPolicy `json:"retryPolicy"`
+		// A zero MisfireMaxRuns restores the scheduler default.
+		MisfirePolicy     *string `json:"misfirePolicy" validate:"omitempty,oneof=skip once all"`
+		MisfireMaxRuns    *int    `json:"misfireMaxRuns" validate:"omitempty,gte=0,lte=100"`
+		ConcurrencyPolicy *string `json:"concurrencyPolicy" validate:"omitempty,oneof=allow forbid replace"`
+	}
+	RetryPolicy struct {
+		MaxAttempts      int      `json:"maxAttempts" validate:"gte=0,lte=20"`
+		InitialBackoffMs int64    `json:"initialBackoffMs" validate:"gte=0,lte=86400000"`
+		Multiplier       float64  `json:"multiplier" validate:"gte=0,lte=10"`
+		Jitter           float64  `json:"jitter" validate:"gte=0,lte=1"`
+		RetryableCodes   []string `json:"retryableCodes" validate:"max=50,dive,max=64"`
+		ExhaustedStatus  string   `json:"exhaustedStatus" validate:"omitempty,oneof=paused cancelled"`
+	}
+	ListRequest struct {
+		OwnerID string `form:"ownerId" validate:"max=64"`
+		Status  string `form:"status" validate:"omitempty,oneof=active paused cancelled completed expired"`
+		Page    int    `form:"page" validate:"gte=0"`
+		Size    int    `form:"size" validate:"gte=0,lte=100"`
+	}
+	TransitionRequest struct {
+		Reason string `json:"reason" validate:"max=255"`
+	}
+)
+
+const defaultPageSize = 20
+
+func NewService(resource *resource.Resource, infrastructure *infrastructure.Infrastructure, calendars calendar.Service) Service {
+	return &service{
+		resource:  resource,
+		repo:      infrastructure.Store.Repository,
+		lifecycle: NewLifecycle(resource),
+		calendars: calendars,
+	}
+}
+
+func (s *service) Create(ctx context.Context, req CreateRequest) (repository.Subscription, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.Create")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return repository.Subscription{}, err
+	}
+
+	subscription := repository.Subscription{
+		OwnerID:     req.OwnerID,
+		Schedule:    req.Schedule,
+		Timezone:    req.Timezone,
+		Calendar:    req.Calendar,
+		Adjustment:  req.Adjustment,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Description: req.Description,
+		Status:      repository.SubscriptionStatusActive,
+		StartAt:     time.Now(),
+
+		MisfirePolicy:     req.MisfirePolicy,
+		MisfireMaxRuns:    req.MisfireMaxRuns,
+		ConcurrencyPolicy: req.ConcurrencyPolicy,
+	}
+	if req.ExternalRef != "" {
+		subscription.ExternalRef = &req.ExternalRef
+	}
+	if subscription.Timezone == "" {
+		subscription.Timezone = s.defaultTimezone()
+	}
+	if subscription.Adjustment == "" {
+		subscription.Adjustment = calendar.AdjustNone
+	}
+	if subscription.ConcurrencyPolicy == "" {
+		subscription.ConcurrencyPolicy = ConcurrencyAllow
+	}
+	if req.RetryPolicy != nil {
+		subscription.RetryPolicy = req.RetryPolicy.policy()
+	}
+	if req.StartAt != nil {
+		subscription.StartAt = *req.StartAt
+	}
+	if req.EndAt != nil {
+		if !req.EndAt.After(subscription.StartAt) {
+			return repository.Subscription{}, commonErr.ServiceError{
+				Code:    constant.InvalidRequest.Code,
+				Message: "endAt must be after startAt",
+			}
+		}
+		subscription.EndAt = req.EndAt
+	}
+	cal, err := s.calendar(ctx, subscription)
+	if err != nil {
+		return repository.Subscription{}, err
+	}
+	subscription.LastRunAt = req.LastRunAt
+	terminal, err := Advance(&subscription, cal, FirstRunAfter(subscription.StartAt, req.LastRunAt, req.SkipMissed, time.Now()))
+	if err != nil {
+		return repository.Subscription{}, err
+	}
+	if terminal != "" {
+		return repository.Subscription{}, commonErr.ServiceError{
+			Code:    constant.InvalidSchedule.Code,
+			Message: "schedule has no occurrence between startAt and endAt",
+		}
+	}
+	if req.ExternalRef != "" {
+		if _, err := s.repo.GetSubscriptionByExternalRef(ctx, req.ExternalRef); err == nil {
+			return repository.Subscription{}, constant.SubscriptionExists
+		} else if !errors.Is(err, constant.SubscriptionNotFound) {
+			return repository.Subscription{}, err
+		}
+	}
+	if err := s.repo.CreateSubscription(ctx, &subscription); err != nil {
+		return repository.Subscription{}, err
+	}
+	return subscription, nil
+}
+
+func (s *service) Get(ctx context.Context, id uint64) (repository.Subscription, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.Get")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return s.repo.GetSubscription(ctx, id)
+}
+
+func (s *service) Update(ctx context.Context, id uint64, req UpdateRequest) (repository.Subscription, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.Update")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return repository.Subscription{}, err
+	}
+
+	// The row stays locked until the change commits, so a concurrent transition
+	// or scheduler tick cannot be overwritten with what it replaced.
+	var subscription repository.Subscription
+	err := s.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		var err error
+		subscription, err = repo.GetSubscriptionForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.apply(ctx, &subscription, req); err != nil {
+			return err
+		}
+		return repo.UpdateSubscription(ctx, &subscription)
+	})
+	if err != nil {
+		return repository.Subscription{}, err
+	}
+	return subscription, nil
+}
+
+// apply sets the fields of req on subscription, computing its next run again
+// when its schedule changed.
+func (s *service) apply(ctx context.Context, subscription *repository.Subscription, req UpdateRequest) error {
+	rescheduled := false
+	if req.Schedule != nil && *req.Schedule != subscription.Schedule {
+		subscription.Schedule = *req.Schedule
+		rescheduled = true
+	}
+	if req.Timezone != nil && *req.Timezone != subscription.Timezone {
+		subscription.Timezone = *req.Timezone
+		rescheduled = true
+	}
+	if req.Calendar != nil && *req.Calendar != subscription.Calendar {
+		subscription.Calendar = *req.Calendar
+		rescheduled = true
+	}
+	if req.Adjustment != nil && *req.Adjustment != subscription.Adjustment {
+		subscription.Adjustment = *req.Adjustment
+		rescheduled = true
+	}
+	if rescheduled {
+		cal, err := s.calendar(ctx, *subscription)
+		if err != nil {
+			return err
+		}
+		if _, err := Schedule(*subscription, cal); err != nil {
+			return err
+		}
+		// Only an active subscription has a next run; resuming computes it for a paused one.
+		if subscription.Status == repository.SubscriptionStatusActive {
+			terminal, err := Advance(subscription, cal, time.Now())
+			if err != nil {
+				return err
+			}
+			if terminal != "" {
+				return commonErr.ServiceError{
+					Code:    constant.InvalidSchedule.Code,
+					Message: "schedule has no further occurrence",
+				}
+			}
+		}
+	}
+	if req.Amount != nil {
+		subscription.Amount = *req.Amount
+	}
+	if req.Currency != nil {
+		subscription.Currency = *req.Currency
+	}
+	if req.Description != nil {
+		subscription.Description = *req.Description
+	}
+	if req.RetryPolicy != nil {
+		subscription.RetryPolicy = req.RetryPolicy.policy()
+	}
+	if req.MisfirePolicy != nil {
+		subscription.MisfirePolicy = *req.MisfirePolicy
+	}
+	if req.MisfireMaxRuns != nil {
+		subscription.MisfireMaxRuns = *req.MisfireMaxRuns
+	}
+	if req.ConcurrencyPolicy != nil {
+		subscription.ConcurrencyPolicy = *req.ConcurrencyPolicy
+	}
+	return nil
+}
+
+func (s *service) List(ctx context.Context, req ListRequest) ([]repository.Subscription, int64, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.List")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := s.validate(req); err != nil {
+		return nil, 0, err
+	}
+	size := req.Size
+	if size == 0 {
+		size = defaultPageSize
+	}
+
+	return s.repo.ListSubscriptions(ctx, repository.SubscriptionFilter{
+		OwnerID: req.OwnerID,
+		Status:  req.Status,
+		Offset:  req.Page * size,
+		Limit:   size,
+	})
+}
+
+func (s *service) Pause(ctx context.Context, id uint64, req TransitionRequest) (repository.Subscription, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.Pause")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return s.transition(ctx, id, req, func(sub *repository.Subscription) (string, error) {
+		return repository.SubscriptionStatusPaused, nil
+	})
+}
+
+func (s *service) Resume(ctx context.Context, id uint64, req TransitionRequest) (repository.Subscription, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.Resume")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return s.transition(ctx, id, req, func(sub *repository.Subscription) (string, error) {
+		if sub.Status != repository.SubscriptionStatusPaused {
+			return repository.SubscriptionStatusActive, nil
+		}
+		// Occurrences missed while paused are skipped. A schedule that ran out
+		// meanwhile ends the subscription instead of resuming it.
+		cal, err := s.calendars.Get(ctx, sub.Calendar)
+		if err != nil {
+			return "", err
+		}
+		terminal, err := Advance(sub, cal, time.Now().Add(-time.Nanosecond))
+		if err != nil || terminal != "" {
+			return terminal, err
+		}
+		return repository.SubscriptionStatusActive, nil
+	})
+}
+
+func (s *service) Cancel(ctx context.Context, id uint64, req TransitionRequest) (repository.Subscription, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.Cancel")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return s.transition(ctx, id, req, func(sub *repository.Subscription) (string, error) {
+		return repository.SubscriptionStatusCancelled, nil
+	})
+}
+
+func (s *service) Transitions(ctx context.Context, id uint64) ([]repository.SubscriptionTransition, error) {
+	tr := tracer.StartTrace(ctx, "application.subscription.Transitions")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if _, err := s.repo.GetSubscription(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListSubscriptionTransitions(ctx, id)
+}
+
+// transition loads a subscription and moves it to the status chosen by target in one transaction.
+func (s *service) transition(ctx context.Context, id uint64, req TransitionRequest,
+	target func(sub *repository.Subscription) (string, error)) (repository.Subscription, error) {
+	if err := s.validate(req); err != nil {
+		return repository.Subscription{}, err
+	}
+
+	var subscription repository.Subscription
+	err := s.repo.Transaction(ctx, func(repo *repository.Repository) error {
+		var err error
+		subscription, err = repo.GetSubscriptionForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		to, err := target(&subscription)
+		if err != nil {
+			return err
+		}
+		return s.lifecycle.Transition(ctx, repo, &subscription, to, req.Reason)
+	})
+	if err != nil {
+		return repository.Subscription{}, err
+	}
+	return subscription, nil
+}
+
+func (p RetryPolicy) policy() repository.RetryPolicy {
+	return repository.RetryPolicy{
+		MaxAttempts:      p.MaxAttempts,
+		InitialBackoffMs: p.InitialBackoffMs,
+		Multiplier:       p.Multiplier,
+		Jitter:           p.Jitter,
+		RetryableCodes:   p.RetryableCodes,
+		ExhaustedStatus:  p.ExhaustedStatus,
+	}
+}
+
+// Schedule returns the recurrence rule of a subscription anchored at its start
+// time in its timezone, with its occurrences moved off the non-business days of
+// cal by its adjustment.
+func Schedule(subscription repository.Subscription, cal calendar.Calendar) (recurrence.Rule, error) {
+	location, err := Location(subscription.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := recurrence.Parse(subscription.Schedule, subscription.StartAt.In(location))
+	if err != nil {
+		return nil, commonErr.ServiceError{
+			Code:    constant.InvalidSchedule.Code,
+			Message: err.Error(),
+		}
+	}
+	return calendar.Rule(rule, cal, subscription.Adjustment, location), nil
+}
+
+// calendar returns the calendar a subscription names, rejecting an unknown one
+// as an invalid request.
+func (s *service) calendar(ctx context.Context, subscription repository.Subscription) (calendar.Calendar, error) {
+	cal, err := s.calendars.Get(ctx, subscription.Calendar)
+	if errors.Is(err, constant.CalendarNotFound) {
+		return calendar.Calendar{}, commonErr.ServiceError{
+			Code:    constant.InvalidRequest.Code,
+			Message: fmt.Sprintf("unknown calendar %q", subscription.Calendar),
+		}
+	}
+	return cal, err
+}
+
+// defaultTimezone is the timezone of subscriptions created without one.
+func (s *service) defaultTimezone() string {
+	if s.resource.Config.Time.Zone == "" {
+		return "UTC"
+	}
+	return s.resource.Config.Time.Zone
+}
+
+// Location loads an IANA timezone; the empty one is the process zone.
+func Location(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, commonErr.ServiceError{
+			Code:    constant.InvalidRequest.Code,
+			Message: fmt.Sprintf("unknown timezone %q", timezone),
+		}
+	}
+	return location, nil
+}
+
+func (s *service) validate(req interface{}) error {
+	if err := s.resource.Validator.Struct(req); err != nil {
+		return commonErr.ServiceError{
+			Code:    constant.InvalidRequest.Code,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
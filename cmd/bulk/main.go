@@ -0,0 +1,175 @@
+// Command bulk imports subscriptions from, or exports them to, a CSV or JSON
+// Lines file using the service configuration.
+//
+//	bulk import -format csv [-dry-run] [-upsert] file
+//	bulk export -format jsonl [-owner id] [-status active] [-out file]
+//
+// A file or out of "-" is standard input or output. Import prints a JSON line
+// per row and the summary on standard error, and exits with 1 when a row failed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"newdemo1/application"
+	"newdemo1/application/bulk"
+	"newdemo1/infrastructure"
+	"newdemo1/resource"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(ctx, os.Args[2:])
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bulk:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bulk import|export [flags]; bulk <command> -h lists the flags")
+	os.Exit(2)
+}
+
+func runImport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	config := configFlags(flags)
+	format := flags.String("format", bulk.FormatCSV, "csv or jsonl")
+	dryRun := flags.Bool("dry-run", false, "validate the rows without saving them")
+	upsert := flags.Bool("upsert", false, "update the subscription with the same external reference")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("import takes one file")
+	}
+
+	in, err := open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	app, done, err := config.application()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	encoder := json.NewEncoder(os.Stdout)
+	summary, err := app.Bulk.Import(ctx, in, bulk.ImportRequest{
+		Format: *format,
+		DryRun: *dryRun,
+		Upsert: *upsert,
+	}, func(result bulk.RowResult) error {
+		return encoder.Encode(result)
+	})
+	_ = json.NewEncoder(os.Stderr).Encode(summary)
+	if err != nil {
+		return err
+	}
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", summary.Failed, summary.Rows)
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	config := configFlags(flags)
+	format := flags.String("format", bulk.FormatCSV, "csv or jsonl")
+	owner := flags.String("owner", "", "only export the subscriptions of this owner")
+	status := flags.String("status", "", "only export the subscriptions in this status")
+	path := flags.String("out", "-", "file to write")
+	_ = flags.Parse(args)
+
+	out := io.WriteCloser(os.Stdout)
+	if *path != "-" {
+		file, err := os.Create(*path)
+		if err != nil {
+			return err
+		}
+		out = file
+	}
+	app, done, err := config.application()
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	defer done()
+
+	written, err := app.Bulk.Export(ctx, out, bulk.ExportRequest{
+		Format:  *format,
+		OwnerID: *owner,
+		Status:  *status,
+	})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	fmt.Fprintf(os.Stderr, "exported %d subscriptions\n", written)
+	return err
+}
+
+type configPaths struct {
+	config     *string
+	credential *string
+}
+
+func configFlags(flags *flag.FlagSet) configPaths {
+	return configPaths{
+		config:     flags.String("config", "config.yaml", "service configuration"),
+		credential: flags.String("credential", "credential.yaml", "service credentials"),
+	}
+}
+
+// application builds the application the way the service does, without
+// starting any transport. done flushes the resources.
+func (c configPaths) application() (*application.Application, func(), error) {
+	res, err := resource.NewResource(*c.config, *c.credential)
+	if err != nil {
+		return nil, nil, err
+	}
+	zone, err := time.LoadLocation(res.Config.Time.Zone)
+	if err != nil {
+		res.Flush()
+		return nil, nil, err
+	}
+	time.Local = zone
+
+	infra, err := infrastructure.NewInfrastructure(res)
+	if err != nil {
+		res.Flush()
+		return nil, nil, err
+	}
+	app, err := application.NewApplication(res, infra)
+	if err != nil {
+		res.Flush()
+		return nil, nil, err
+	}
+	return app, res.Flush, nil
+}
+
+func open(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
@@ -7,12 +7,52 @@ import (
 )
 
 var (
-	Success                          = commonErr.ServiceError{Code: "000", Message: "Success"}
+	Success              = commonErr.ServiceError{Code: "000", Message: "Success"}
+	InvalidRequest       = commonErr.ServiceError{Code: "001", Message: "Invalid request"}
+	SubscriptionNotFound = commonErr.ServiceError{Code: "002", Message: "Subscription not found"}
+	InvalidSchedule      = commonErr.ServiceError{Code: "003", Message: "Invalid schedule"}
+	DeadLetterNotFound   = commonErr.ServiceError{Code: "004", Message: "Dead letter not found"}
+	DeadLetterNoTopic    = commonErr.ServiceError{Code: "005", Message: "Dead letter has no topic to redrive to"}
+	IllegalTransition    = commonErr.ServiceError{Code: "006", Message: "Subscription status does not allow this action"}
+	RunNotFound          = commonErr.ServiceError{Code: "007", Message: "Run not found"}
+	CalendarNotFound     = commonErr.ServiceError{Code: "008", Message: "Calendar not found"}
+	CalendarConflict     = commonErr.ServiceError{Code: "009", Message: "Calendar conflicts with its current state"}
+	SubscriptionExists   = commonErr.ServiceError{Code: "010", Message: "Subscription with this external reference already exists"}
+	RunExists            = commonErr.ServiceError{Code: "011", Message: "Run of this occurrence already exists"}
+	DeadLetterRedriven   = commonErr.ServiceError{Code: "012", Message: "Dead letter was already redriven"}
+	InternalError        = commonErr.ServiceError{Code: "999", Message: "Internal server error"}
+
 	ServiceErrorCodeToHttpStatusCode = map[string]int{
-		Success.Code: http.StatusOK,
+		Success.Code:              http.StatusOK,
+		InvalidRequest.Code:       http.StatusBadRequest,
+		SubscriptionNotFound.Code: http.StatusNotFound,
+		InvalidSchedule.Code:      http.StatusBadRequest,
+		DeadLetterNotFound.Code:   http.StatusNotFound,
+		DeadLetterNoTopic.Code:    http.StatusConflict,
+		IllegalTransition.Code:    http.StatusConflict,
+		RunNotFound.Code:          http.StatusNotFound,
+		CalendarNotFound.Code:     http.StatusNotFound,
+		CalendarConflict.Code:     http.StatusConflict,
+		SubscriptionExists.Code:   http.StatusConflict,
+		RunExists.Code:            http.StatusConflict,
+		DeadLetterRedriven.Code:   http.StatusConflict,
+		InternalError.Code:        http.StatusInternalServerError,
 	}
 
 	ServiceErrorCodeToGRPCErrorCode = map[string]codes.Code{
-		Success.Code: codes.OK,
+		Success.Code:              codes.OK,
+		InvalidRequest.Code:       codes.InvalidArgument,
+		SubscriptionNotFound.Code: codes.NotFound,
+		InvalidSchedule.Code:      codes.InvalidArgument,
+		DeadLetterNotFound.Code:   codes.NotFound,
+		DeadLetterNoTopic.Code:    codes.FailedPrecondition,
+		IllegalTransition.Code:    codes.FailedPrecondition,
+		RunNotFound.Code:          codes.NotFound,
+		CalendarNotFound.Code:     codes.NotFound,
+		CalendarConflict.Code:     codes.FailedPrecondition,
+		SubscriptionExists.Code:   codes.AlreadyExists,
+		RunExists.Code:            codes.AlreadyExists,
+		DeadLetterRedriven.Code:   codes.FailedPrecondition,
+		InternalError.Code:        codes.Internal,
 	}
 )
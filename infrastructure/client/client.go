@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	gormMysql "gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -27,7 +28,7 @@ func NewClient(resource *resource.Resource) (*Client, error) {
 		MaxLifetime: int(resource.Credential.Database.MaxLifetime.Minutes()),
 		MaxIdleTime: int(resource.Credential.Database.MaxIdleTime.Minutes()),
 		ParseTime:   true,
-		Location:    "Asia/Jakarta",
+		Location:    databaseZone(resource.Config.Time.DatabaseZone),
 	})
 	if err != nil {
 		return &Client{}, err
@@ -37,6 +38,9 @@ func NewClient(resource *resource.Resource) (*Client, error) {
 		Conn: db,
 	}), &gorm.Config{
 		SkipDefaultTransaction: true,
+		NowFunc: func() time.Time {
+			return time.Now().UTC()
+		},
 		Logger: logger.New(
 			log.New(os.Stdout, "\r\n", log.LstdFlags),
 			logger.Config{
@@ -49,3 +53,20 @@ func NewClient(resource *resource.Resource) (*Client, error) {
 	)
 	return &Client{db: gormDB}, err
 }
+
+// NewClientFromDB wraps an opened database, such as the in-memory one of a test.
+func NewClientFromDB(db *gorm.DB) *Client {
+	return &Client{db: db}
+}
+
+// databaseZone returns the zone DATETIME columns are kept in, UTC unless configured.
+func databaseZone(zone string) string {
+	if zone == "" {
+		return "UTC"
+	}
+	return zone
+}
+
+func (c *Client) DB(ctx context.Context) *gorm.DB {
+	return c.db.WithContext(ctx)
+}
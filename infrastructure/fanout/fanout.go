@@ -0,0 +1,58 @@
+package fanout
+
+import (
+	"context"
+	goredislib "github.com/go-redis/redis/v8"
+	"newdemo1/resource"
+)
+
+type (
+	// Fanout delivers every payload published on a channel to each replica
+	// subscribed to it at that moment. Payloads are not stored: a replica that
+	// is not subscribed misses them.
+	Fanout interface {
+		Publish(ctx context.Context, channel string, payload []byte) error
+		// Subscribe calls fn with every payload published on channel until ctx
+		// is cancelled.
+		Subscribe(ctx context.Context, channel string, fn func(payload []byte)) error
+	}
+	fanout struct {
+		client *goredislib.Client
+	}
+)
+
+// New builds a Fanout over Redis publish/subscribe.
+func New(resource *resource.Resource) Fanout {
+	return &fanout{
+		client: goredislib.NewClient(&goredislib.Options{
+			Addr:     resource.Credential.Redis.Host,
+			Password: resource.Credential.Redis.Password,
+		}),
+	}
+}
+
+func (f *fanout) Publish(ctx context.Context, channel string, payload []byte) error {
+	return f.client.Publish(ctx, channel, payload).Err()
+}
+
+func (f *fanout) Subscribe(ctx context.Context, channel string, fn func(payload []byte)) error {
+	pubsub := f.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	// Wait for the subscription to be confirmed so a broken connection fails here.
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			fn([]byte(message.Payload))
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package infrastructure
 
 import (
+	"newdemo1/infrastructure/fanout"
 	"newdemo1/infrastructure/mq"
 	"newdemo1/infrastructure/store"
 	"newdemo1/infrastructure/sync"
@@ -8,9 +9,10 @@ import (
 )
 
 type Infrastructure struct {
-	Store *store.Store
-	Sync  sync.Sync
-	MQ    mq.PubSub
+	Store  *store.Store
+	Sync   sync.Sync
+	MQ     mq.PubSub
+	Fanout fanout.Fanout
 }
 
 func NewInfrastructure(resource *resource.Resource) (*Infrastructure, error) {
@@ -26,8 +28,9 @@ func NewInfrastructure(resource *resource.Resource) (*Infrastructure, error) {
 	sc := sync.New(resource)
 
 	return &Infrastructure{
-		Store: infras,
-		MQ:    mq,
-		Sync:  sc,
+		Store:  infras,
+		MQ:     mq,
+		Sync:   sc,
+		Fanout: fanout.New(resource),
 	}, nil
 }
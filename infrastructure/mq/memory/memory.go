@@ -0,0 +1,221 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"newdemo1/infrastructure/mq/pubsub1"
+	"newdemo1/resource/jaeger/common/tracer"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxOutstanding = 1000
+	defaultConcurrency    = 10
+	defaultAckDeadline    = 10 * time.Second
+	pollInterval          = 50 * time.Millisecond
+)
+
+type (
+	// Broker is an in-process pubsub1.Client. Every subscription attached to a
+	// topic receives its own copy of each message published after it was
+	// created; a message is redelivered when it is nacked or its ack deadline
+	// passes without a settle, the same at-least-once contract as Pub/Sub.
+	Broker struct {
+		mu            sync.Mutex
+		seq           uint64
+		topics        map[string][]*subscription
+		subscriptions map[string]*subscription
+	}
+
+	subscription struct {
+		name     string
+		queue    []*envelope
+		inflight map[string]*envelope
+		notify   chan struct{}
+	}
+
+	envelope struct {
+		id          string
+		data        []byte
+		attributes  map[string]string
+		publishTime time.Time
+		attempt     int
+		lease       int
+		deadline    time.Time
+	}
+)
+
+func New() *Broker {
+	return &Broker{
+		topics:        make(map[string][]*subscription),
+		subscriptions: make(map[string]*subscription),
+	}
+}
+
+// CreateTopic declares a topic; declaring an existing one is a no-op.
+func (b *Broker) CreateTopic(topic string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.topics[topic]; !ok {
+		b.topics[topic] = nil
+	}
+}
+
+// CreateSubscription attaches a subscription to a topic, declaring the topic if needed.
+func (b *Broker) CreateSubscription(name, topic string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscriptions[name]; ok {
+		return fmt.Errorf("memory: subscription %q already exists", name)
+	}
+	sub := &subscription{
+		name:     name,
+		inflight: make(map[string]*envelope),
+		notify:   make(chan struct{}, 1),
+	}
+	b.subscriptions[name] = sub
+	b.topics[topic] = append(b.topics[topic], sub)
+	return nil
+}
+
+func (b *Broker) Publish(ctx context.Context, topic string, message *pubsub1.Message) error {
+	tr := tracer.StartTrace(ctx, "messageQueue.memory.Publish")
+	ctx = tr.Context()
+	defer tr.Finish()
+	pubsub1.InjectTrace(ctx, message)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs, ok := b.topics[topic]
+	if !ok {
+		return fmt.Errorf("memory: topic %q not found", topic)
+	}
+
+	b.seq++
+	message.ID = strconv.FormatUint(b.seq, 10)
+	now := time.Now()
+	for _, sub := range subs {
+		attributes := make(map[string]string, len(message.Attributes))
+		for k, v := range message.Attributes {
+			attributes[k] = v
+		}
+		sub.queue = append(sub.queue, &envelope{
+			id:          message.ID,
+			data:        append([]byte(nil), message.Data...),
+			attributes:  attributes,
+			publishTime: now,
+		})
+		sub.wake()
+	}
+	return nil
+}
+
+func (b *Broker) Subscribe(ctx context.Context, name string, handler pubsub1.Handler, options ...pubsub1.SubscribeOption) error {
+	b.mu.Lock()
+	sub, ok := b.subscriptions[name]
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("memory: subscription %q not found", name)
+	}
+
+	opts := pubsub1.NewSubscribeOptions(options...)
+	if opts.MaxOutstandingMessages <= 0 {
+		opts.MaxOutstandingMessages = defaultMaxOutstanding
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.AckDeadline <= 0 {
+		opts.AckDeadline = defaultAckDeadline
+	}
+
+	slots := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case slots <- struct{}{}:
+			}
+			message := b.lease(sub, opts.MaxOutstandingMessages, opts.AckDeadline)
+			if message == nil {
+				<-slots
+				break
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				tr := pubsub1.StartReceiveTrace(ctx, "messageQueue.memory.Receive", message)
+				defer tr.Finish()
+				handler(tr.Context(), message)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// lease hands out the next pending message, first returning expired leases to the queue.
+func (b *Broker) lease(sub *subscription, maxOutstanding int, ackDeadline time.Duration) *pubsub1.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for id, e := range sub.inflight {
+		if now.After(e.deadline) {
+			delete(sub.inflight, id)
+			sub.queue = append(sub.queue, e)
+		}
+	}
+	if len(sub.queue) == 0 || len(sub.inflight) >= maxOutstanding {
+		return nil
+	}
+
+	e := sub.queue[0]
+	sub.queue = sub.queue[1:]
+	e.attempt++
+	e.lease++
+	e.deadline = now.Add(ackDeadline)
+	sub.inflight[e.id] = e
+
+	lease := e.lease
+	return pubsub1.NewReceivedMessage(e.id, e.data, e.attributes, e.publishTime, e.attempt,
+		func() { b.settle(sub, e, lease, false) },
+		func() { b.settle(sub, e, lease, true) })
+}
+
+// settle acks or nacks a lease. Settling a lease that already expired is ignored
+// because the message has been handed out again.
+func (b *Broker) settle(sub *subscription, e *envelope, lease int, redeliver bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if current, ok := sub.inflight[e.id]; !ok || current != e || e.lease != lease {
+		return
+	}
+	delete(sub.inflight, e.id)
+	if redeliver {
+		sub.queue = append(sub.queue, e)
+		sub.wake()
+	}
+}
+
+func (s *subscription) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
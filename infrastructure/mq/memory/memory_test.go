@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"context"
+	"newdemo1/infrastructure/mq/pubsub1"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, broker *Broker, subscription string, options ...pubsub1.SubscribeOption) (<-chan *pubsub1.Message, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := make(chan *pubsub1.Message, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := broker.Subscribe(ctx, subscription, func(ctx context.Context, message *pubsub1.Message) {
+			messages <- message
+		}, options...)
+		assert.NoError(t, err)
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return messages, stop
+}
+
+func next(t *testing.T, messages <-chan *pubsub1.Message) *pubsub1.Message {
+	select {
+	case m := <-messages:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+		return nil
+	}
+}
+
+func assertEmpty(t *testing.T, messages <-chan *pubsub1.Message, wait time.Duration) {
+	select {
+	case m := <-messages:
+		t.Fatalf("unexpected delivery of message %s", m.ID)
+	case <-time.After(wait):
+	}
+}
+
+func TestBrokerFanOut(t *testing.T) {
+	broker := New()
+	require.NoError(t, broker.CreateSubscription("a", "topic"))
+	require.NoError(t, broker.CreateSubscription("b", "topic"))
+
+	message := pubsub1.NewMessage([]byte("hello"), map[string]string{"k": "v"})
+	require.NoError(t, broker.Publish(context.Background(), "topic", message))
+	assert.NotEmpty(t, message.ID)
+
+	for _, name := range []string{"a", "b"} {
+		messages, _ := receive(t, broker, name)
+		m := next(t, messages)
+		assert.Equal(t, message.ID, m.ID)
+		assert.Equal(t, []byte("hello"), m.Data)
+		assert.Equal(t, "v", m.Attributes["k"])
+		assert.Equal(t, 1, m.DeliveryAttempt)
+		m.Ack()
+	}
+}
+
+func TestBrokerAckAndNack(t *testing.T) {
+	broker := New()
+	require.NoError(t, broker.CreateSubscription("sub", "topic"))
+	messages, _ := receive(t, broker, "sub")
+
+	require.NoError(t, broker.Publish(context.Background(), "topic", pubsub1.NewMessage([]byte("1"), nil)))
+	m := next(t, messages)
+	m.Nack()
+
+	m = next(t, messages)
+	assert.Equal(t, 2, m.DeliveryAttempt)
+	m.Ack()
+	m.Nack()
+	assertEmpty(t, messages, 200*time.Millisecond)
+}
+
+func TestBrokerAckDeadline(t *testing.T) {
+	broker := New()
+	require.NoError(t, broker.CreateSubscription("sub", "topic"))
+	messages, _ := receive(t, broker, "sub", pubsub1.WithAckDeadline(100*time.Millisecond))
+
+	require.NoError(t, broker.Publish(context.Background(), "topic", pubsub1.NewMessage([]byte("1"), nil)))
+	first := next(t, messages)
+
+	second := next(t, messages)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, 2, second.DeliveryAttempt)
+
+	// The expired lease no longer settles the message.
+	first.Ack()
+	second.Ack()
+	assertEmpty(t, messages, 300*time.Millisecond)
+}
+
+func TestBrokerMaxOutstanding(t *testing.T) {
+	broker := New()
+	require.NoError(t, broker.CreateSubscription("sub", "topic"))
+	messages, _ := receive(t, broker, "sub", pubsub1.WithMaxOutstandingMessages(1))
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, broker.Publish(context.Background(), "topic", pubsub1.NewMessage([]byte("m"), nil)))
+	}
+	first := next(t, messages)
+	assertEmpty(t, messages, 200*time.Millisecond)
+
+	first.Ack()
+	second := next(t, messages)
+	assert.NotEqual(t, first.ID, second.ID)
+	second.Ack()
+}
+
+func TestBrokerUnknown(t *testing.T) {
+	broker := New()
+	assert.Error(t, broker.Publish(context.Background(), "missing", pubsub1.NewMessage(nil, nil)))
+	assert.Error(t, broker.Subscribe(context.Background(), "missing", func(context.Context, *pubsub1.Message) {}))
+
+	require.NoError(t, broker.CreateSubscription("sub", "topic"))
+	assert.Error(t, broker.CreateSubscription("sub", "other"))
+}
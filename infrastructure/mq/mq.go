@@ -1,10 +1,17 @@
 package mq
 
 import (
+	"fmt"
+	"newdemo1/infrastructure/mq/memory"
 	"newdemo1/infrastructure/mq/pubsub1"
 	"newdemo1/resource"
 )
 
+const (
+	DriverGoogle = "google"
+	DriverMemory = "memory"
+)
+
 type (
 	PubSub interface {
 		PubSub() pubsub1.Client
@@ -16,7 +23,18 @@ type (
 )
 
 func NewMQ(resource *resource.Resource) (PubSub, error) {
-	pubsub, err := pubsub1.New(resource)
+	var (
+		pubsub pubsub1.Client
+		err    error
+	)
+	switch resource.Config.Pubsub.Driver {
+	case "", DriverGoogle:
+		pubsub, err = pubsub1.New(resource)
+	case DriverMemory:
+		pubsub, err = newMemory(resource)
+	default:
+		err = fmt.Errorf("mq: unknown pubSub driver %q", resource.Config.Pubsub.Driver)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -29,3 +47,21 @@ func NewMQ(resource *resource.Resource) (PubSub, error) {
 func (m *MQ) PubSub() pubsub1.Client {
 	return m.pubsub
 }
+
+// newMemory builds an in-process broker holding the topics and subscriptions declared in the configuration.
+func newMemory(resource *resource.Resource) (pubsub1.Client, error) {
+	topology, err := pubsub1.Declared(resource.Config)
+	if err != nil {
+		return nil, err
+	}
+	broker := memory.New()
+	for _, topic := range topology.Topics {
+		broker.CreateTopic(topic)
+	}
+	for _, spec := range topology.Subscriptions {
+		if err := broker.CreateSubscription(spec.Name, spec.Topic); err != nil {
+			return nil, err
+		}
+	}
+	return broker, nil
+}
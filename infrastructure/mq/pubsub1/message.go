@@ -0,0 +1,100 @@
+package pubsub1
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// Message is a broker-independent message. Received messages must be
+	// settled with exactly one of Ack or Nack; later calls are ignored.
+	Message struct {
+		ID              string
+		Data            []byte
+		Attributes      map[string]string
+		PublishTime     time.Time
+		DeliveryAttempt int
+
+		once sync.Once
+		ack  func()
+		nack func()
+	}
+
+	// Handler is called for every message delivered on a subscription.
+	Handler func(ctx context.Context, message *Message)
+
+	SubscribeOptions struct {
+		// MaxOutstandingMessages caps messages received but not yet settled.
+		MaxOutstandingMessages int
+		// Concurrency caps handlers running at the same time.
+		Concurrency int
+		// AckDeadline is how long a message is leased before it is redelivered.
+		AckDeadline time.Duration
+	}
+	SubscribeOption func(*SubscribeOptions)
+)
+
+// NewMessage builds an outgoing message.
+func NewMessage(data []byte, attributes map[string]string) *Message {
+	if attributes == nil {
+		attributes = make(map[string]string)
+	}
+	return &Message{Data: data, Attributes: attributes}
+}
+
+// NewReceivedMessage builds a delivered message for broker implementations.
+func NewReceivedMessage(id string, data []byte, attributes map[string]string, publishTime time.Time,
+	deliveryAttempt int, ack, nack func()) *Message {
+	return &Message{
+		ID:              id,
+		Data:            data,
+		Attributes:      attributes,
+		PublishTime:     publishTime,
+		DeliveryAttempt: deliveryAttempt,
+		ack:             ack,
+		nack:            nack,
+	}
+}
+
+func (m *Message) Ack() {
+	m.once.Do(func() {
+		if m.ack != nil {
+			m.ack()
+		}
+	})
+}
+
+func (m *Message) Nack() {
+	m.once.Do(func() {
+		if m.nack != nil {
+			m.nack()
+		}
+	})
+}
+
+func WithMaxOutstandingMessages(n int) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.MaxOutstandingMessages = n
+	}
+}
+
+func WithConcurrency(n int) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.Concurrency = n
+	}
+}
+
+func WithAckDeadline(d time.Duration) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.AckDeadline = d
+	}
+}
+
+func NewSubscribeOptions(options ...SubscribeOption) SubscribeOptions {
+	var o SubscribeOptions
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
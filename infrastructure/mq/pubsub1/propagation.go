@@ -0,0 +1,44 @@
+package pubsub1
+
+import (
+	"context"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagators"
+	"newdemo1/resource/jaeger/common/tracer"
+)
+
+// propagator matches the one used by the HTTP and gRPC instrumentation so a
+// trace continues across services whatever transport carries it.
+var propagator = otel.NewCompositeTextMapPropagator(propagators.TraceContext{},
+	b3.B3{InjectEncoding: b3.B3MultipleHeader | b3.B3SingleHeader})
+
+// attributeCarrier adapts message attributes to otel.TextMapCarrier.
+type attributeCarrier map[string]string
+
+func (c attributeCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c attributeCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+// InjectTrace writes the trace context of ctx into the message attributes.
+func InjectTrace(ctx context.Context, message *Message) {
+	if message.Attributes == nil {
+		message.Attributes = make(map[string]string)
+	}
+	propagator.Inject(ctx, attributeCarrier(message.Attributes))
+}
+
+// ExtractTrace returns ctx carrying the remote span context found in the message attributes.
+func ExtractTrace(ctx context.Context, message *Message) context.Context {
+	return propagator.Extract(ctx, attributeCarrier(message.Attributes))
+}
+
+// StartReceiveTrace starts the span of a delivered message as a child of the
+// publisher's span. Brokers call it before handing the message to the handler.
+func StartReceiveTrace(ctx context.Context, opsName string, message *Message) tracer.Tracer {
+	return tracer.StartTrace(ExtractTrace(ctx, message), opsName)
+}
@@ -0,0 +1,183 @@
+package pubsub1
+
+import (
+	"cloud.google.com/go/pubsub"
+	"context"
+	"fmt"
+	"log"
+	"newdemo1/resource/config"
+	"sort"
+	"time"
+)
+
+// Pub/Sub accepts ack deadlines and dead-letter delivery attempts between these bounds.
+const (
+	minAckDeadline = 10 * time.Second
+	maxAckDeadline = 600 * time.Second
+
+	minDeadLetterAttempts = 5
+	maxDeadLetterAttempts = 100
+)
+
+type (
+	// Topology is the set of topics and subscriptions the configuration refers to.
+	Topology struct {
+		Topics        []string
+		Subscriptions []SubscriptionSpec
+	}
+	SubscriptionSpec struct {
+		Name        string
+		Topic       string
+		AckDeadline time.Duration
+		// DeadLetterTopic and DeadLetterAttempts make up the dead-letter policy
+		// of the subscription, none when DeadLetterTopic is empty.
+		DeadLetterTopic    string
+		DeadLetterAttempts int
+	}
+)
+
+// Declared collects the topology from Configuration.Pubsub. Every subscription
+// the service consumes must name its topic in subscriber.settings.
+func Declared(cfg config.Configuration) (Topology, error) {
+	pubsubCfg := cfg.Pubsub
+	topics := make(map[string]bool)
+	for _, topic := range []string{
+		pubsubCfg.PublishTopic.RecurringHappen,
+		pubsubCfg.PublishTopic.SubscriptionStatusChanged,
+		pubsubCfg.PublishTopic.RecurringCancel,
+	} {
+		if topic != "" {
+			topics[topic] = true
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, name := range []string{pubsubCfg.Subscriber.SubscriptionHappenResult, pubsubCfg.Subscriber.SubscriptionJobFinish} {
+		if name != "" {
+			names[name] = true
+		}
+	}
+	for name := range pubsubCfg.Subscriber.Settings {
+		names[name] = true
+	}
+
+	var topology Topology
+	for name := range names {
+		settings := pubsubCfg.Subscriber.Settings[name]
+		if settings.Topic == "" {
+			return Topology{}, fmt.Errorf("pubsub: subscription %q declares no topic", name)
+		}
+		topics[settings.Topic] = true
+		spec := SubscriptionSpec{
+			Name:        name,
+			Topic:       settings.Topic,
+			AckDeadline: settings.AckDeadline,
+		}
+		if settings.DeadLetterTopic != "" && settings.MaxDeliveryAttempts > 0 {
+			topics[settings.DeadLetterTopic] = true
+			spec.DeadLetterTopic = settings.DeadLetterTopic
+			spec.DeadLetterAttempts = deadLetterAttempts(settings.MaxDeliveryAttempts)
+		}
+		topology.Subscriptions = append(topology.Subscriptions, spec)
+	}
+	for topic := range topics {
+		topology.Topics = append(topology.Topics, topic)
+	}
+	sort.Strings(topology.Topics)
+	sort.Slice(topology.Subscriptions, func(i, j int) bool {
+		return topology.Subscriptions[i].Name < topology.Subscriptions[j].Name
+	})
+	return topology, nil
+}
+
+// provision creates the topics and subscriptions of the topology that do not exist yet.
+func (c *client) provision(ctx context.Context, topology Topology) error {
+	for _, name := range topology.Topics {
+		topic := c.client.Topic(name)
+		exists, err := topic.Exists(ctx)
+		if err != nil {
+			return fmt.Errorf("pubsub: check topic %q: %w", name, err)
+		}
+		if exists {
+			continue
+		}
+		if _, err := c.client.CreateTopic(ctx, name); err != nil {
+			return fmt.Errorf("pubsub: create topic %q: %w", name, err)
+		}
+		log.Println("[Recurring Service PubSub] created topic", name)
+	}
+
+	for _, spec := range topology.Subscriptions {
+		exists, err := c.client.Subscription(spec.Name).Exists(ctx)
+		if err != nil {
+			return fmt.Errorf("pubsub: check subscription %q: %w", spec.Name, err)
+		}
+		if exists {
+			if err := c.ensureDeadLetterPolicy(ctx, spec); err != nil {
+				return err
+			}
+			continue
+		}
+		subscriptionConfig := pubsub.SubscriptionConfig{
+			Topic:            c.client.Topic(spec.Topic),
+			DeadLetterPolicy: c.deadLetterPolicy(spec),
+		}
+		if spec.AckDeadline >= minAckDeadline && spec.AckDeadline <= maxAckDeadline {
+			subscriptionConfig.AckDeadline = spec.AckDeadline
+		}
+		if _, err := c.client.CreateSubscription(ctx, spec.Name, subscriptionConfig); err != nil {
+			return fmt.Errorf("pubsub: create subscription %q: %w", spec.Name, err)
+		}
+		log.Println("[Recurring Service PubSub] created subscription", spec.Name, "on", spec.Topic)
+	}
+	return nil
+}
+
+// ensureDeadLetterPolicy adds the dead-letter policy of spec to a subscription
+// created without one.
+func (c *client) ensureDeadLetterPolicy(ctx context.Context, spec SubscriptionSpec) error {
+	policy := c.deadLetterPolicy(spec)
+	if policy == nil {
+		return nil
+	}
+	subscription := c.client.Subscription(spec.Name)
+	current, err := subscription.Config(ctx)
+	if err != nil {
+		return fmt.Errorf("pubsub: read subscription %q: %w", spec.Name, err)
+	}
+	if current.DeadLetterPolicy != nil {
+		return nil
+	}
+	if _, err := subscription.Update(ctx, pubsub.SubscriptionConfigToUpdate{DeadLetterPolicy: policy}); err != nil {
+		return fmt.Errorf("pubsub: set dead-letter policy of subscription %q: %w", spec.Name, err)
+	}
+	log.Println("[Recurring Service PubSub] set dead-letter policy of subscription", spec.Name)
+	return nil
+}
+
+// deadLetterPolicy makes Pub/Sub count the delivery attempts of every message
+// of the subscription. The Pub/Sub service account needs to publish to the
+// dead-letter topic and to subscribe to the subscription.
+func (c *client) deadLetterPolicy(spec SubscriptionSpec) *pubsub.DeadLetterPolicy {
+	if spec.DeadLetterTopic == "" {
+		return nil
+	}
+	return &pubsub.DeadLetterPolicy{
+		DeadLetterTopic:     c.client.Topic(spec.DeadLetterTopic).String(),
+		MaxDeliveryAttempts: spec.DeadLetterAttempts,
+	}
+}
+
+// deadLetterAttempts returns the delivery attempts of the dead-letter policy
+// backing maxAttempts: one more, so the consumer records the message in the
+// dead-letter store before Pub/Sub forwards it, within the bounds Pub/Sub accepts.
+func deadLetterAttempts(maxAttempts int) int {
+	attempts := maxAttempts + 1
+	if attempts < minDeadLetterAttempts {
+		attempts = minDeadLetterAttempts
+	}
+	if attempts > maxDeadLetterAttempts {
+		attempts = maxDeadLetterAttempts
+	}
+	return attempts
+}
@@ -0,0 +1,33 @@
+package pubsub1
+
+import (
+	"newdemo1/resource/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeclaredDeadLetterPolicy(t *testing.T) {
+	var cfg config.Configuration
+	cfg.Pubsub.Subscriber.SubscriptionHappenResult = "result-sub"
+	cfg.Pubsub.Subscriber.SubscriptionJobFinish = "finish-sub"
+	cfg.Pubsub.Subscriber.Settings = map[string]config.SubscriberSettings{
+		"result-sub": {Topic: "result", MaxDeliveryAttempts: 5, DeadLetterTopic: "result-dead"},
+		"finish-sub": {Topic: "finish", MaxDeliveryAttempts: 2},
+	}
+
+	topology, err := Declared(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"finish", "result", "result-dead"}, topology.Topics)
+	assert.Equal(t, []SubscriptionSpec{
+		{Name: "finish-sub", Topic: "finish"},
+		{Name: "result-sub", Topic: "result", DeadLetterTopic: "result-dead", DeadLetterAttempts: 6},
+	}, topology.Subscriptions)
+}
+
+func TestDeadLetterAttempts(t *testing.T) {
+	assert.Equal(t, 5, deadLetterAttempts(1))
+	assert.Equal(t, 6, deadLetterAttempts(5))
+	assert.Equal(t, 100, deadLetterAttempts(100))
+}
@@ -5,13 +5,18 @@ import (
 	"context"
 	"encoding/base64"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"newdemo1/resource"
 	"newdemo1/resource/jaeger/common/tracer"
+	"os"
 )
 
 type (
 	Client interface {
-		Publish(ctx context.Context, topic string, message *pubsub.Message) error
+		Publish(ctx context.Context, topic string, message *Message) error
+		// Subscribe blocks delivering messages of the subscription to handler until ctx is done.
+		Subscribe(ctx context.Context, subscription string, handler Handler, options ...SubscribeOption) error
 	}
 	client struct {
 		resource *resource.Resource
@@ -19,34 +24,106 @@ type (
 	}
 )
 
-func (c *client) Publish(ctx context.Context, topic string, message *pubsub.Message) error {
+func (c *client) Publish(ctx context.Context, topic string, message *Message) error {
 	tr := tracer.StartTrace(ctx, "messageQueue.pubSub.Publish")
 	ctx = tr.Context()
 	defer tr.Finish()
 
+	InjectTrace(ctx, message)
 	topicData := c.client.Topic(topic)
-	result := topicData.Publish(ctx, message)
+	result := topicData.Publish(ctx, &pubsub.Message{
+		Data:       message.Data,
+		Attributes: message.Attributes,
+	})
 
-	if _, err := result.Get(ctx); err != nil {
+	id, err := result.Get(ctx)
+	if err != nil {
 		return err
 	}
+	message.ID = id
 
 	return nil
 }
+
+func (c *client) Subscribe(ctx context.Context, subscription string, handler Handler, options ...SubscribeOption) error {
+	opts := NewSubscribeOptions(options...)
+	sub := c.client.Subscription(subscription)
+	if opts.MaxOutstandingMessages > 0 {
+		sub.ReceiveSettings.MaxOutstandingMessages = opts.MaxOutstandingMessages
+	}
+	if opts.AckDeadline > 0 {
+		sub.ReceiveSettings.MinExtensionPeriod = opts.AckDeadline
+		sub.ReceiveSettings.MaxExtensionPeriod = opts.AckDeadline
+	}
+
+	var slots chan struct{}
+	if opts.Concurrency > 0 {
+		slots = make(chan struct{}, opts.Concurrency)
+	}
+
+	return sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		if slots != nil {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+		}
+
+		deliveryAttempt := 0
+		if m.DeliveryAttempt != nil {
+			deliveryAttempt = *m.DeliveryAttempt
+		}
+		message := NewReceivedMessage(m.ID, m.Data, m.Attributes, m.PublishTime, deliveryAttempt, m.Ack, m.Nack)
+
+		tr := StartReceiveTrace(ctx, "messageQueue.pubSub.Receive", message)
+		defer tr.Finish()
+		handler(tr.Context(), message)
+	})
+}
+
 func New(resource *resource.Resource) (Client, error) {
-	creadentialJSON, err := base64.RawStdEncoding.DecodeString(resource.Credential.PubSub.CredentialBase64)
+	options, err := clientOptions(resource)
 	if err != nil {
 		return nil, err
 	}
 
-	clientPubSub, err := pubsub.NewClient(context.Background(),
-		resource.Credential.PubSub.ProjectID, option.WithCredentialsJSON(creadentialJSON))
-
+	clientPubSub, err := pubsub.NewClient(context.Background(), resource.Credential.PubSub.ProjectID, options...)
 	if err != nil {
 		return nil, err
 	}
-	return &client{
+	c := &client{
 		resource: resource,
 		client:   clientPubSub,
-	}, nil
+	}
+
+	if resource.Config.Pubsub.AutoProvision {
+		topology, err := Declared(resource.Config)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.provision(context.Background(), topology); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// clientOptions dials the emulator without credentials when one is configured,
+// and otherwise authenticates with the base64 service-account key.
+func clientOptions(resource *resource.Resource) ([]option.ClientOption, error) {
+	emulatorHost := resource.Credential.PubSub.EmulatorHost
+	if emulatorHost == "" {
+		emulatorHost = os.Getenv("PUBSUB_EMULATOR_HOST")
+	}
+	if emulatorHost != "" {
+		conn, err := grpc.Dial(emulatorHost, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, err
+		}
+		return []option.ClientOption{option.WithGRPCConn(conn), option.WithTelemetryDisabled()}, nil
+	}
+
+	creadentialJSON, err := base64.RawStdEncoding.DecodeString(resource.Credential.PubSub.CredentialBase64)
+	if err != nil {
+		return nil, err
+	}
+	return []option.ClientOption{option.WithCredentialsJSON(creadentialJSON)}, nil
 }
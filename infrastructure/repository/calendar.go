@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"newdemo1/constant"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+type (
+	// Calendar is a business day calendar managed through the admin API.
+	// Weekend holds lowercase weekday names.
+	Calendar struct {
+		ID          uint64            `gorm:"primaryKey;autoIncrement" json:"id"`
+		Name        string            `gorm:"size:64;not null;uniqueIndex" json:"name"`
+		Description string            `gorm:"size:255" json:"description"`
+		Weekend     []string          `gorm:"type:text;serializer:json" json:"weekend"`
+		Holidays    []CalendarHoliday `json:"holidays"`
+		CreatedAt   time.Time         `json:"createdAt"`
+		UpdatedAt   time.Time         `json:"updatedAt"`
+	}
+
+	// CalendarHoliday is a day off of a calendar; Date is formatted 2006-01-02.
+	CalendarHoliday struct {
+		ID         uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+		CalendarID uint64    `gorm:"not null;uniqueIndex:idx_calendar_holiday_date" json:"calendarId"`
+		Date       string    `gorm:"size:10;not null;uniqueIndex:idx_calendar_holiday_date" json:"date"`
+		Name       string    `gorm:"size:255" json:"name"`
+		CreatedAt  time.Time `json:"createdAt"`
+		UpdatedAt  time.Time `json:"updatedAt"`
+	}
+)
+
+func (r *Repository) CreateCalendar(ctx context.Context, calendar *Calendar) error {
+	tr := tracer.StartTrace(ctx, "repository.CreateCalendar")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return r.db(ctx).Create(calendar).Error
+}
+
+// GetCalendar reads a calendar by name with its holidays in date order.
+func (r *Repository) GetCalendar(ctx context.Context, name string) (Calendar, error) {
+	tr := tracer.StartTrace(ctx, "repository.GetCalendar")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var calendar Calendar
+	err := r.db(ctx).Preload("Holidays", orderHolidays).Where("name = ?", name).First(&calendar).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Calendar{}, constant.CalendarNotFound
+	}
+	return calendar, err
+}
+
+func (r *Repository) ListCalendars(ctx context.Context) ([]Calendar, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListCalendars")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var calendars []Calendar
+	err := r.db(ctx).Preload("Holidays", orderHolidays).Order("name").Find(&calendars).Error
+	return calendars, err
+}
+
+// DeleteCalendar deletes a calendar together with its holidays.
+func (r *Repository) DeleteCalendar(ctx context.Context, id uint64) error {
+	tr := tracer.StartTrace(ctx, "repository.DeleteCalendar")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err := r.db(ctx).Where("calendar_id = ?", id).Delete(&CalendarHoliday{}).Error; err != nil {
+		return err
+	}
+	result := r.db(ctx).Delete(&Calendar{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return constant.CalendarNotFound
+	}
+	return nil
+}
+
+// SaveCalendarHoliday adds a holiday, renaming the one already on its date.
+func (r *Repository) SaveCalendarHoliday(ctx context.Context, holiday *CalendarHoliday) error {
+	tr := tracer.StartTrace(ctx, "repository.SaveCalendarHoliday")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return r.db(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "calendar_id"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "updated_at"}),
+	}).Create(holiday).Error
+}
+
+func (r *Repository) DeleteCalendarHoliday(ctx context.Context, calendarID uint64, date string) error {
+	tr := tracer.StartTrace(ctx, "repository.DeleteCalendarHoliday")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	result := r.db(ctx).Where("calendar_id = ? AND date = ?", calendarID, date).Delete(&CalendarHoliday{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return constant.CalendarNotFound
+	}
+	return nil
+}
+
+// CountSubscriptionsByCalendar counts the active and paused subscriptions adjusted by a calendar.
+func (r *Repository) CountSubscriptionsByCalendar(ctx context.Context, name string) (int64, error) {
+	tr := tracer.StartTrace(ctx, "repository.CountSubscriptionsByCalendar")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var count int64
+	err := r.db(ctx).Model(&Subscription{}).
+		Where("calendar = ? AND status IN ?", name, []string{SubscriptionStatusActive, SubscriptionStatusPaused}).
+		Count(&count).Error
+	return count, err
+}
+
+// ListActiveSubscriptionsByCalendarForUpdate reads the active subscriptions adjusted
+// by a calendar whose next run is after the given time, and locks their rows until
+// the transaction of the repository ends.
+func (r *Repository) ListActiveSubscriptionsByCalendarForUpdate(ctx context.Context, name string, after time.Time) ([]Subscription, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListActiveSubscriptionsByCalendarForUpdate")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var subscriptions []Subscription
+	err := r.db(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("calendar = ? AND status = ? AND next_run_at > ?", name, SubscriptionStatusActive, after).
+		Order("id").
+		Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func orderHolidays(db *gorm.DB) *gorm.DB {
+	return db.Order("date")
+}
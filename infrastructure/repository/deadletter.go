@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"newdemo1/constant"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+const (
+	DeadLetterStatusPending  = "pending"
+	DeadLetterStatusRedriven = "redriven"
+)
+
+type (
+	// DeadLetter is a message that kept failing on a subscription and was set aside.
+	DeadLetter struct {
+		ID           uint64            `gorm:"primaryKey;autoIncrement" json:"id"`
+		Subscription string            `gorm:"size:255;not null;index" json:"subscription"`
+		Topic        string            `gorm:"size:255" json:"topic"`
+		MessageID    string            `gorm:"size:128" json:"messageId"`
+		Data         []byte            `gorm:"not null" json:"data"`
+		Attributes   map[string]string `gorm:"type:text;serializer:json" json:"attributes"`
+		Attempts     int               `gorm:"not null" json:"attempts"`
+		Error        string            `gorm:"size:1024" json:"error"`
+		Status       string            `gorm:"size:16;not null;index" json:"status"`
+		RedrivenAt   *time.Time        `json:"redrivenAt"`
+		CreatedAt    time.Time         `json:"createdAt"`
+		UpdatedAt    time.Time         `json:"updatedAt"`
+	}
+
+	DeadLetterFilter struct {
+		Subscription string
+		Status       string
+		// All lets PurgeDeadLetters delete without a subscription or status.
+		All    bool
+		Offset int
+		Limit  int
+	}
+)
+
+func (r *Repository) CreateDeadLetter(ctx context.Context, deadLetter *DeadLetter) error {
+	tr := tracer.StartTrace(ctx, "repository.CreateDeadLetter")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	deadLetter.Error = truncate(deadLetter.Error, 1024)
+	return r.db(ctx).Create(deadLetter).Error
+}
+
+func (r *Repository) GetDeadLetter(ctx context.Context, id uint64) (DeadLetter, error) {
+	tr := tracer.StartTrace(ctx, "repository.GetDeadLetter")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var deadLetter DeadLetter
+	err := r.db(ctx).First(&deadLetter, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DeadLetter{}, constant.DeadLetterNotFound
+	}
+	return deadLetter, err
+}
+
+func (r *Repository) ListDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, int64, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListDeadLetters")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	query := r.deadLetterQuery(ctx, filter)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var deadLetters []DeadLetter
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	err := query.Offset(filter.Offset).Order("id DESC").Find(&deadLetters).Error
+	return deadLetters, total, err
+}
+
+// MarkDeadLetterRedriven marks a pending dead letter redriven. It returns
+// DeadLetterRedriven when the letter was redriven already.
+func (r *Repository) MarkDeadLetterRedriven(ctx context.Context, id uint64, redrivenAt time.Time) error {
+	tr := tracer.StartTrace(ctx, "repository.MarkDeadLetterRedriven")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	result := r.db(ctx).Model(&DeadLetter{ID: id}).
+		Where("status = ?", DeadLetterStatusPending).
+		Updates(map[string]interface{}{
+			"status":      DeadLetterStatusRedriven,
+			"redriven_at": redrivenAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return constant.DeadLetterRedriven
+	}
+	return nil
+}
+
+func (r *Repository) DeleteDeadLetter(ctx context.Context, id uint64) error {
+	tr := tracer.StartTrace(ctx, "repository.DeleteDeadLetter")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	result := r.db(ctx).Delete(&DeadLetter{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return constant.DeadLetterNotFound
+	}
+	return nil
+}
+
+// PurgeDeadLetters deletes every dead letter matching the subscription and status
+// of the filter. A filter without either deletes nothing unless All is set.
+func (r *Repository) PurgeDeadLetters(ctx context.Context, filter DeadLetterFilter) (int64, error) {
+	tr := tracer.StartTrace(ctx, "repository.PurgeDeadLetters")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	query := r.deadLetterQuery(ctx, filter)
+	if filter.All {
+		// GORM refuses a delete without conditions; "1 = 1" purges the whole table on request.
+		query = query.Where("1 = 1")
+	}
+	result := query.Delete(&DeadLetter{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *Repository) deadLetterQuery(ctx context.Context, filter DeadLetterFilter) *gorm.DB {
+	query := r.db(ctx).Model(&DeadLetter{})
+	if filter.Subscription != "" {
+		query = query.Where("subscription = ?", filter.Subscription)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	return query
+}
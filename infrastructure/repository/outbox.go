@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+)
+
+// OutboxMessage is a message waiting to be published, written in the same
+// transaction as the change it announces.
+type OutboxMessage struct {
+	ID            uint64            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Topic         string            `gorm:"size:255;not null" json:"topic"`
+	Data          []byte            `gorm:"not null" json:"data"`
+	Attributes    map[string]string `gorm:"type:text;serializer:json" json:"attributes"`
+	Status        string            `gorm:"size:16;not null;index:idx_outbox_pending,priority:1" json:"status"`
+	Attempts      int               `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time         `gorm:"not null;index:idx_outbox_pending,priority:2" json:"nextAttemptAt"`
+	LastError     string            `gorm:"size:1024" json:"lastError"`
+	SentAt        *time.Time        `gorm:"index" json:"sentAt"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+func (r *Repository) CreateOutboxMessage(ctx context.Context, message *OutboxMessage) error {
+	tr := tracer.StartTrace(ctx, "repository.CreateOutboxMessage")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return r.db(ctx).Create(message).Error
+}
+
+// ListPendingOutboxMessages returns pending messages due for an attempt at or before the given time, oldest first.
+func (r *Repository) ListPendingOutboxMessages(ctx context.Context, before time.Time, limit int) ([]OutboxMessage, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListPendingOutboxMessages")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var messages []OutboxMessage
+	err := r.db(ctx).
+		Where("status = ? AND next_attempt_at <= ?", OutboxStatusPending, before).
+		Order("id").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+func (r *Repository) MarkOutboxMessageSent(ctx context.Context, id uint64, sentAt time.Time) error {
+	tr := tracer.StartTrace(ctx, "repository.MarkOutboxMessageSent")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return r.db(ctx).Model(&OutboxMessage{ID: id}).Updates(map[string]interface{}{
+		"status":     OutboxStatusSent,
+		"sent_at":    sentAt,
+		"last_error": "",
+	}).Error
+}
+
+// DeleteSentOutboxMessages deletes up to limit messages sent before the given
+// time and returns how many it deleted.
+func (r *Repository) DeleteSentOutboxMessages(ctx context.Context, before time.Time, limit int) (int64, error) {
+	tr := tracer.StartTrace(ctx, "repository.DeleteSentOutboxMessages")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	result := r.db(ctx).
+		Where("status = ? AND sent_at < ?", OutboxStatusSent, before).
+		Limit(limit).
+		Delete(&OutboxMessage{})
+	return result.RowsAffected, result.Error
+}
+
+// MarkOutboxMessageFailed records a failed attempt and when the next one is due.
+func (r *Repository) MarkOutboxMessageFailed(ctx context.Context, id uint64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	tr := tracer.StartTrace(ctx, "repository.MarkOutboxMessageFailed")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	lastError = truncate(lastError, 1024)
+	return r.db(ctx).Model(&OutboxMessage{ID: id}).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}).Error
+}
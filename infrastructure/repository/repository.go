@@ -1,16 +1,109 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"newdemo1/infrastructure/client"
 	"newdemo1/resource"
 )
 
 type Repository struct {
 	c *client.Client
+	// tx is set on the repository handed to a Transaction callback.
+	tx *gorm.DB
 }
 
 func NewRepository(resource *resource.Resource, clt *client.Client) (*Repository, error) {
-	return &Repository{
+	repo := &Repository{
 		c: clt,
-	}, nil
+	}
+	// The run ledger keyed occurrences by a plain index before they became unique.
+	// A double fire may have left an occurrence with several runs, which would
+	// fail the unique index, so all but its first run are deleted beforehand.
+	migrator := repo.db(context.Background()).Migrator()
+	if migrator.HasTable(&SubscriptionRun{}) && !migrator.HasIndex(&SubscriptionRun{}, "idx_subscription_run_key") {
+		deleted, err := repo.deleteDuplicateSubscriptionRuns(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if deleted > 0 {
+			resource.Log.Warn(context.Background(), "deleted duplicate runs before keying occurrences",
+				zap.Int64("deleted", deleted))
+		}
+	}
+	if migrator.HasIndex(&SubscriptionRun{}, "idx_subscription_run_occurrence") {
+		if err := migrator.DropIndex(&SubscriptionRun{}, "idx_subscription_run_occurrence"); err != nil {
+			return nil, err
+		}
+	}
+	if err := repo.db(context.Background()).AutoMigrate(
+		&Subscription{},
+		&SubscriptionTransition{},
+		&OutboxMessage{},
+		&DeadLetter{},
+		&SubscriptionRun{},
+		&Calendar{},
+		&CalendarHoliday{},
+	); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Transaction runs fn with a repository whose every call joins one database
+// transaction, committed when fn returns nil and rolled back otherwise.
+func (r *Repository) Transaction(ctx context.Context, fn func(repo *Repository) error) error {
+	return r.db(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Repository{c: r.c, tx: tx})
+	})
+}
+
+func (r *Repository) db(ctx context.Context) *gorm.DB {
+	if r.tx != nil {
+		return r.tx.WithContext(ctx)
+	}
+	return r.c.DB(ctx)
+}
+
+// deleteDuplicateSubscriptionRuns deletes every run of an occurrence but the
+// first one recorded, returning how many it deleted.
+func (r *Repository) deleteDuplicateSubscriptionRuns(ctx context.Context) (int64, error) {
+	stmt := &gorm.Statement{DB: r.db(ctx)}
+	if err := stmt.Parse(&SubscriptionRun{}); err != nil {
+		return 0, err
+	}
+	table := clause.Table{Name: stmt.Schema.Table}
+	result := r.db(ctx).Exec("DELETE newer FROM ? AS newer JOIN ? AS older "+
+		"ON newer.subscription_id = older.subscription_id AND newer.scheduled_at = older.scheduled_at AND newer.id > older.id",
+		table, table)
+	return result.RowsAffected, result.Error
+}
+
+// truncate cuts s to at most size characters, the unit a VARCHAR column is
+// sized in, so a multi-byte character is never split.
+func truncate(s string, size int) string {
+	if len(s) <= size {
+		return s
+	}
+	chars := 0
+	for i := range s {
+		if chars == size {
+			return s[:i]
+		}
+		chars++
+	}
+	return s
+}
+
+// errDuplicateEntry is the MySQL error of a row violating a unique index.
+const errDuplicateEntry = 1062
+
+// isDuplicateEntry reports whether err is a write rejected by a unique index.
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry
 }
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 8))
+	assert.Equal(t, "exactly8", truncate("exactly8", 8))
+	assert.Equal(t, "trunc", truncate("truncated", 5))
+
+	// Multi-byte characters count once and are never split.
+	cut := truncate("gagal: 支付失败了", 9)
+	assert.Equal(t, "gagal: 支付", cut)
+	assert.True(t, utf8.ValidString(cut))
+	assert.Equal(t, "支付失败了", truncate("支付失败了", 5))
+}
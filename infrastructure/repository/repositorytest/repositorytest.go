@@ -0,0 +1,49 @@
+// Package repositorytest opens a repository on an in-memory database, for the
+// tests of the services driving one.
+package repositorytest
+
+import (
+	"newdemo1/infrastructure/client"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/resource"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// New returns a migrated repository on an empty in-memory database, closed
+// when t ends. SQLite ignores the row locks the repository takes, and compares
+// times as text, which only orders them within one zone, so the process runs
+// in UTC until t ends.
+func New(t *testing.T) *repository.Repository {
+	t.Helper()
+	local := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() {
+		time.Local = local
+	})
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		SkipDefaultTransaction: true,
+		NowFunc: func() time.Time {
+			return time.Now().UTC()
+		},
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	conn, err := db.DB()
+	require.NoError(t, err)
+	// Every connection to :memory: opens a database of its own.
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	repo, err := repository.NewRepository(&resource.Resource{}, client.NewClientFromDB(db))
+	require.NoError(t, err)
+	return repo
+}
@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"newdemo1/constant"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+const (
+	RunStatusTriggered = "triggered"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+	// RunStatusSkipped marks an occurrence its misfire or concurrency policy dropped.
+	RunStatusSkipped = "skipped"
+	// RunStatusTimedOut marks a run the reconciler gave up waiting on; its
+	// ErrorCode tells whether the happen result or the job finish never came.
+	RunStatusTimedOut = "timed_out"
+
+	RunErrorResultTimeout = "result_timeout"
+	RunErrorFinishTimeout = "finish_timeout"
+	// RunErrorMisfireCapped marks the skipped run standing for the missed
+	// occurrences past the catch-up cap, which get no entry of their own.
+	RunErrorMisfireCapped = "misfire_capped"
+)
+
+type (
+	// SubscriptionRun is the ledger entry of one occurrence of a subscription.
+	// CorrelationID travels with the happen event so results can be matched back.
+	// Attempts counts the times the occurrence was published; NextRetryAt is set
+	// while a failed run waits to be published again. Misfire is the policy
+	// applied when the occurrence was missed, Concurrency the one applied when
+	// it overlapped an unfinished run. Republished counts the times the
+	// reconciler published it again for want of a result. ReplacedBy is the
+	// occurrence a replace concurrency policy cancelled the run for; the run
+	// keeps the status of its last result. An occurrence, keyed by its
+	// subscription and scheduled time, has at most one run.
+	SubscriptionRun struct {
+		ID             uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+		SubscriptionID uint64     `gorm:"not null;uniqueIndex:idx_subscription_run_key,priority:1" json:"subscriptionId"`
+		OwnerID        string     `gorm:"size:64;not null;index" json:"ownerId"`
+		ScheduledAt    time.Time  `gorm:"not null;uniqueIndex:idx_subscription_run_key,priority:2" json:"scheduledAt"`
+		TriggeredAt    time.Time  `gorm:"not null" json:"triggeredAt"`
+		CorrelationID  string     `gorm:"size:64;not null;uniqueIndex" json:"correlationId"`
+		Status         string     `gorm:"size:16;not null;index" json:"status"`
+		Misfire        string     `gorm:"size:16" json:"misfire"`
+		Concurrency    string     `gorm:"size:16" json:"concurrency"`
+		Republished    int        `gorm:"not null;default:0" json:"republished"`
+		ReplacedBy     *time.Time `json:"replacedBy"`
+		Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+		ErrorCode      string     `gorm:"size:64" json:"errorCode"`
+		ErrorMessage   string     `gorm:"size:1024" json:"errorMessage"`
+		ResultAt       *time.Time `json:"resultAt"`
+		NextRetryAt    *time.Time `gorm:"index" json:"nextRetryAt"`
+		FinishedAt     *time.Time `json:"finishedAt"`
+		CreatedAt      time.Time  `json:"createdAt"`
+		UpdatedAt      time.Time  `json:"updatedAt"`
+	}
+
+	SubscriptionRunFilter struct {
+		SubscriptionID uint64
+		OwnerID        string
+		Status         string
+		// From and To bound ScheduledAt, inclusive.
+		From   *time.Time
+		To     *time.Time
+		Offset int
+		Limit  int
+	}
+
+	// RunKey identifies the run a result refers to: by CorrelationID when the
+	// sender echoed it, by subscription and scheduled time otherwise.
+	RunKey struct {
+		CorrelationID  string
+		SubscriptionID uint64
+		ScheduledAt    time.Time
+	}
+)
+
+// CreateSubscriptionRun records a run, failing with constant.RunExists when its
+// occurrence already has one.
+func (r *Repository) CreateSubscriptionRun(ctx context.Context, run *SubscriptionRun) error {
+	tr := tracer.StartTrace(ctx, "repository.CreateSubscriptionRun")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	err := r.db(ctx).Create(run).Error
+	if isDuplicateEntry(err) {
+		return constant.RunExists
+	}
+	return err
+}
+
+func (r *Repository) GetSubscriptionRun(ctx context.Context, id uint64) (SubscriptionRun, error) {
+	tr := tracer.StartTrace(ctx, "repository.GetSubscriptionRun")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var run SubscriptionRun
+	err := r.db(ctx).First(&run, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return SubscriptionRun{}, constant.RunNotFound
+	}
+	return run, err
+}
+
+// FindSubscriptionRunForUpdate reads the run matching key and locks its row
+// until the transaction of the repository ends.
+func (r *Repository) FindSubscriptionRunForUpdate(ctx context.Context, key RunKey) (SubscriptionRun, error) {
+	tr := tracer.StartTrace(ctx, "repository.FindSubscriptionRunForUpdate")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	query := r.db(ctx).Clauses(clause.Locking{Strength: "UPDATE"})
+	if key.CorrelationID != "" {
+		query = query.Where("correlation_id = ?", key.CorrelationID)
+	} else {
+		query = query.Where("subscription_id = ? AND scheduled_at = ?", key.SubscriptionID, key.ScheduledAt)
+	}
+	var run SubscriptionRun
+	err := query.Order("id DESC").First(&run).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return SubscriptionRun{}, constant.RunNotFound
+	}
+	return run, err
+}
+
+// GetSubscriptionRunForUpdate reads a run and locks its row until the
+// transaction of the repository ends.
+func (r *Repository) GetSubscriptionRunForUpdate(ctx context.Context, id uint64) (SubscriptionRun, error) {
+	tr := tracer.StartTrace(ctx, "repository.GetSubscriptionRunForUpdate")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var run SubscriptionRun
+	err := r.db(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&run, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return SubscriptionRun{}, constant.RunNotFound
+	}
+	return run, err
+}
+
+// ListActiveSubscriptionRunsForUpdate returns the runs of a subscription whose
+// job has not finished and that were not replaced, oldest first, and locks
+// their rows until the transaction of the repository ends. A failed run
+// waiting for a retry is still active.
+func (r *Repository) ListActiveSubscriptionRunsForUpdate(ctx context.Context, subscriptionID uint64) ([]SubscriptionRun, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListActiveSubscriptionRunsForUpdate")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var runs []SubscriptionRun
+	err := r.db(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("subscription_id = ? AND finished_at IS NULL AND replaced_by IS NULL", subscriptionID).
+		Where("status IN ? OR (status = ? AND next_retry_at IS NOT NULL)",
+			[]string{RunStatusTriggered, RunStatusSucceeded}, RunStatusFailed).
+		Order("scheduled_at, id").
+		Find(&runs).Error
+	return runs, err
+}
+
+// ListStuckSubscriptionRuns returns the runs still waiting, since before
+// resultBefore, for the result of their last publication, or since before
+// finishBefore for the finish of their job, oldest first.
+func (r *Repository) ListStuckSubscriptionRuns(ctx context.Context, resultBefore, finishBefore time.Time, limit int) ([]SubscriptionRun, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListStuckSubscriptionRuns")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var runs []SubscriptionRun
+	err := r.db(ctx).
+		Where(r.awaitingResult(ctx, resultBefore)).
+		Or(r.awaitingFinish(ctx, finishBefore)).
+		Order("id").
+		Limit(limit).
+		Find(&runs).Error
+	return runs, err
+}
+
+// CountStuckSubscriptionRuns counts the runs ListStuckSubscriptionRuns would
+// return, by what they wait for.
+func (r *Repository) CountStuckSubscriptionRuns(ctx context.Context, resultBefore, finishBefore time.Time) (awaitingResult, awaitingFinish int64, err error) {
+	tr := tracer.StartTrace(ctx, "repository.CountStuckSubscriptionRuns")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	if err = r.db(ctx).Model(&SubscriptionRun{}).Where(r.awaitingResult(ctx, resultBefore)).Count(&awaitingResult).Error; err != nil {
+		return 0, 0, err
+	}
+	err = r.db(ctx).Model(&SubscriptionRun{}).Where(r.awaitingFinish(ctx, finishBefore)).Count(&awaitingFinish).Error
+	return awaitingResult, awaitingFinish, err
+}
+
+// awaitingResult matches the triggered runs last published before before.
+func (r *Repository) awaitingResult(ctx context.Context, before time.Time) *gorm.DB {
+	return r.db(ctx).Where("status = ? AND updated_at < ?", RunStatusTriggered, before)
+}
+
+// awaitingFinish matches the succeeded runs whose result came before before
+// and whose job has not finished.
+func (r *Repository) awaitingFinish(ctx context.Context, before time.Time) *gorm.DB {
+	return r.db(ctx).Where("status = ? AND finished_at IS NULL AND result_at < ?", RunStatusSucceeded, before)
+}
+
+// ListDueRetries returns runs whose next retry is at or before the given time, earliest first.
+func (r *Repository) ListDueRetries(ctx context.Context, before time.Time, limit int) ([]SubscriptionRun, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListDueRetries")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var runs []SubscriptionRun
+	err := r.db(ctx).
+		Where("next_retry_at <= ?", before).
+		Order("next_retry_at").
+		Limit(limit).
+		Find(&runs).Error
+	return runs, err
+}
+
+func (r *Repository) UpdateSubscriptionRun(ctx context.Context, run *SubscriptionRun) error {
+	tr := tracer.StartTrace(ctx, "repository.UpdateSubscriptionRun")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	run.ErrorMessage = truncate(run.ErrorMessage, 1024)
+	return r.db(ctx).Model(run).Select("*").Omit("created_at").Updates(run).Error
+}
+
+func (r *Repository) ListSubscriptionRuns(ctx context.Context, filter SubscriptionRunFilter) ([]SubscriptionRun, int64, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListSubscriptionRuns")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	query := r.db(ctx).Model(&SubscriptionRun{})
+	if filter.SubscriptionID != 0 {
+		query = query.Where("subscription_id = ?", filter.SubscriptionID)
+	}
+	if filter.OwnerID != "" {
+		query = query.Where("owner_id = ?", filter.OwnerID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.From != nil {
+		query = query.Where("scheduled_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("scheduled_at <= ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var runs []SubscriptionRun
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	err := query.Offset(filter.Offset).Order("scheduled_at DESC, id DESC").Find(&runs).Error
+	return runs, total, err
+}
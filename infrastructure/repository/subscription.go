@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"newdemo1/constant"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusPaused    = "paused"
+	SubscriptionStatusCancelled = "cancelled"
+	SubscriptionStatusCompleted = "completed"
+	SubscriptionStatusExpired   = "expired"
+)
+
+type (
+	// Subscription is a recurring instruction owned by a user.
+	// Amount is kept in the minor unit of Currency. Schedule is evaluated in the
+	// IANA Timezone, or in the process zone when it is empty, and its
+	// occurrences are moved off the non-business days of Calendar by Adjustment.
+	// ExternalRef identifies a subscription imported from another system.
+	Subscription struct {
+		ID           uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+		OwnerID      string     `gorm:"size:64;not null;index" json:"ownerId"`
+		ExternalRef  *string    `gorm:"size:128;uniqueIndex" json:"externalRef"`
+		Schedule     string     `gorm:"size:512;not null" json:"schedule"`
+		Timezone     string     `gorm:"size:64" json:"timezone"`
+		Calendar     string     `gorm:"size:64;index" json:"calendar"`
+		Adjustment   string     `gorm:"size:32" json:"adjustment"`
+		Amount       int64      `gorm:"not null" json:"amount"`
+		Currency     string     `gorm:"size:3;not null" json:"currency"`
+		Description  string     `gorm:"size:255" json:"description"`
+		Status       string     `gorm:"size:16;not null;index" json:"status"`
+		StartAt      time.Time  `gorm:"not null" json:"startAt"`
+		EndAt        *time.Time `json:"endAt"`
+		NextRunAt    *time.Time `gorm:"index" json:"nextRunAt"`
+		LastRunAt    *time.Time `json:"lastRunAt"`
+		RunCount     int64      `gorm:"not null;default:0" json:"runCount"`
+		LastResult   string     `gorm:"size:16" json:"lastResult"`
+		LastResultAt *time.Time `json:"lastResultAt"`
+		// StatusReason and StatusChangedAt describe the latest status transition.
+		StatusReason    string      `gorm:"size:255" json:"statusReason"`
+		StatusChangedAt *time.Time  `json:"statusChangedAt"`
+		RetryPolicy     RetryPolicy `gorm:"embedded;embeddedPrefix:retry_" json:"retryPolicy"`
+		// MisfirePolicy and MisfireMaxRuns override the scheduler defaults for
+		// occurrences missed while no scheduler was running.
+		MisfirePolicy  string `gorm:"size:16" json:"misfirePolicy"`
+		MisfireMaxRuns int    `gorm:"not null;default:0" json:"misfireMaxRuns"`
+		// ConcurrencyPolicy decides what happens to an occurrence due while an
+		// earlier run has not finished; empty allows it.
+		ConcurrencyPolicy string    `gorm:"size:16" json:"concurrencyPolicy"`
+		CreatedAt         time.Time `json:"createdAt"`
+		UpdatedAt         time.Time `json:"updatedAt"`
+	}
+
+	// RetryPolicy decides how a failed occurrence is retried. MaxAttempts counts
+	// the first attempt, so zero or one disables retries. Empty RetryableCodes
+	// retries every error code. When retries are enabled and run out, the
+	// subscription moves to ExhaustedStatus.
+	RetryPolicy struct {
+		MaxAttempts      int      `gorm:"not null;default:0" json:"maxAttempts"`
+		InitialBackoffMs int64    `gorm:"not null;default:0" json:"initialBackoffMs"`
+		Multiplier       float64  `gorm:"not null;default:0" json:"multiplier"`
+		Jitter           float64  `gorm:"not null;default:0" json:"jitter"`
+		RetryableCodes   []string `gorm:"type:text;serializer:json" json:"retryableCodes"`
+		ExhaustedStatus  string   `gorm:"size:16" json:"exhaustedStatus"`
+	}
+
+	SubscriptionFilter struct {
+		OwnerID string
+		Status  string
+		Offset  int
+		Limit   int
+	}
+)
+
+func (r *Repository) CreateSubscription(ctx context.Context, subscription *Subscription) error {
+	tr := tracer.StartTrace(ctx, "repository.CreateSubscription")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	err := r.db(ctx).Create(subscription).Error
+	if isDuplicateEntry(err) {
+		return constant.SubscriptionExists
+	}
+	return err
+}
+
+func (r *Repository) GetSubscription(ctx context.Context, id uint64) (Subscription, error) {
+	tr := tracer.StartTrace(ctx, "repository.GetSubscription")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var subscription Subscription
+	err := r.db(ctx).First(&subscription, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Subscription{}, constant.SubscriptionNotFound
+	}
+	return subscription, err
+}
+
+// GetSubscriptionForUpdate reads a subscription and locks its row until the
+// transaction of the repository ends.
+func (r *Repository) GetSubscriptionForUpdate(ctx context.Context, id uint64) (Subscription, error) {
+	tr := tracer.StartTrace(ctx, "repository.GetSubscriptionForUpdate")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var subscription Subscription
+	err := r.db(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&subscription, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Subscription{}, constant.SubscriptionNotFound
+	}
+	return subscription, err
+}
+
+func (r *Repository) GetSubscriptionByExternalRef(ctx context.Context, ref string) (Subscription, error) {
+	tr := tracer.StartTrace(ctx, "repository.GetSubscriptionByExternalRef")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var subscription Subscription
+	err := r.db(ctx).Where("external_ref = ?", ref).First(&subscription).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Subscription{}, constant.SubscriptionNotFound
+	}
+	return subscription, err
+}
+
+func (r *Repository) UpdateSubscription(ctx context.Context, subscription *Subscription) error {
+	tr := tracer.StartTrace(ctx, "repository.UpdateSubscription")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	result := r.db(ctx).Model(subscription).Select("*").Omit("created_at").Updates(subscription)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return constant.SubscriptionNotFound
+	}
+	return nil
+}
+
+// UpdateSubscriptionResult records the latest occurrence result without
+// touching the rest of the subscription.
+func (r *Repository) UpdateSubscriptionResult(ctx context.Context, id uint64, result string, resultAt time.Time) error {
+	tr := tracer.StartTrace(ctx, "repository.UpdateSubscriptionResult")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return r.db(ctx).Model(&Subscription{ID: id}).Updates(map[string]interface{}{
+		"last_result":    result,
+		"last_result_at": resultAt,
+	}).Error
+}
+
+func (r *Repository) ListSubscriptions(ctx context.Context, filter SubscriptionFilter) ([]Subscription, int64, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListSubscriptions")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	query := r.subscriptionQuery(ctx, filter)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var subscriptions []Subscription
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	err := query.Offset(filter.Offset).Order("id").Find(&subscriptions).Error
+	return subscriptions, total, err
+}
+
+// EachSubscription calls fn with the subscriptions matching the filter in id
+// order, batchSize at a time, so a large result set is never held in memory.
+// Offset and Limit of the filter are ignored.
+func (r *Repository) EachSubscription(ctx context.Context, filter SubscriptionFilter, batchSize int, fn func(batch []Subscription) error) error {
+	tr := tracer.StartTrace(ctx, "repository.EachSubscription")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var batch []Subscription
+	return r.subscriptionQuery(ctx, filter).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
+
+func (r *Repository) subscriptionQuery(ctx context.Context, filter SubscriptionFilter) *gorm.DB {
+	query := r.db(ctx).Model(&Subscription{})
+	if filter.OwnerID != "" {
+		query = query.Where("owner_id = ?", filter.OwnerID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	return query
+}
+
+// ListDueSubscriptions returns active subscriptions whose next run is at or before the given time,
+// earliest first.
+func (r *Repository) ListDueSubscriptions(ctx context.Context, before time.Time, limit int) ([]Subscription, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListDueSubscriptions")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var subscriptions []Subscription
+	err := r.db(ctx).
+		Where("status = ? AND next_run_at <= ?", SubscriptionStatusActive, before).
+		Order("next_run_at").
+		Limit(limit).
+		Find(&subscriptions).Error
+	return subscriptions, err
+}
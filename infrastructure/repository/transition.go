@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"newdemo1/resource/jaeger/common/tracer"
+	"time"
+)
+
+// SubscriptionTransition is one entry of the status history of a subscription.
+type SubscriptionTransition struct {
+	ID             uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	SubscriptionID uint64    `gorm:"not null;index" json:"subscriptionId"`
+	From           string    `gorm:"size:16;not null" json:"from"`
+	To             string    `gorm:"size:16;not null" json:"to"`
+	Reason         string    `gorm:"size:255" json:"reason"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+func (r *Repository) CreateSubscriptionTransition(ctx context.Context, transition *SubscriptionTransition) error {
+	tr := tracer.StartTrace(ctx, "repository.CreateSubscriptionTransition")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	return r.db(ctx).Create(transition).Error
+}
+
+// ListSubscriptionTransitions returns the status history of a subscription, oldest first.
+func (r *Repository) ListSubscriptionTransitions(ctx context.Context, subscriptionID uint64) ([]SubscriptionTransition, error) {
+	tr := tracer.StartTrace(ctx, "repository.ListSubscriptionTransitions")
+	ctx = tr.Context()
+	defer tr.Finish()
+
+	var transitions []SubscriptionTransition
+	err := r.db(ctx).
+		Where("subscription_id = ?", subscriptionID).
+		Order("id").
+		Find(&transitions).Error
+	return transitions, err
+}
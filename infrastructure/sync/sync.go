@@ -19,6 +19,8 @@ type (
 
 	Unlock interface {
 		Unlock(ctx context.Context) error
+		// Extend resets the expiry of the lock, failing once it was lost.
+		Extend(ctx context.Context) error
 	}
 	unlock struct {
 		mutex *redsync.Mutex
@@ -40,6 +42,12 @@ func (u *unlock) Unlock(ctx context.Context) error {
 	_, err := u.mutex.UnlockContext(ctx)
 	return err
 }
+
+func (u *unlock) Extend(ctx context.Context) error {
+	_, err := u.mutex.ExtendContext(ctx)
+	return err
+}
+
 func New(resource *resource.Resource) Sync {
 	client := goredislib.NewClient(&goredislib.Options{
 		Addr:     resource.Credential.Redis.Host,
@@ -10,18 +10,23 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// Embed the IANA database so subscription timezones load on any image.
+	_ "time/tzdata"
 )
 
 func main() {
-	zone := time.FixedZone("CST", 7*3600)
-	time.Local = zone
-
 	resource, err := resource.NewResource("config.yaml", "credential.yaml")
 	if err != nil {
 		panic(err)
 	}
 	defer resource.Flush()
 
+	zone, err := time.LoadLocation(resource.Config.Time.Zone)
+	if err != nil {
+		panic(err)
+	}
+	time.Local = zone
+
 	infra, err := infrastructure.NewInfrastructure(resource)
 	if err != nil {
 		panic(err)
@@ -32,7 +37,7 @@ func main() {
 		panic(err)
 	}
 
-	tp, err := transport.NewTransport(resource, application)
+	tp, err := transport.NewTransport(resource, infra, application)
 	if err != nil {
 		panic(err)
 	}
@@ -40,15 +45,9 @@ func main() {
 
 	graceful := make(chan os.Signal, 1)
 	signal.Notify(graceful, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-graceful
-		tp.Stop()
-	}()
-
-	// DONE
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	<-done
+	// Wait for the consumers and background loops to drain before exiting.
+	<-graceful
+	tp.Stop()
 	log.Println("All server stopped!")
 }
@@ -9,6 +9,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"time"
 )
 
 type (
@@ -18,6 +19,13 @@ type (
 			HttpPort string `yaml:"httpPort"`
 			GrpcPort string `yaml:"grpcPort"`
 		} `yaml:"service"`
+		// Time sets the zone of the process and of the database session. Times
+		// are stored in DatabaseZone, UTC by default; Zone is what time.Local
+		// becomes and the timezone of subscriptions that name none.
+		Time struct {
+			Zone         string `yaml:"zone"`
+			DatabaseZone string `yaml:"databaseZone"`
+		} `yaml:"time"`
 		Telemetry struct {
 			Tracer struct {
 				CollectorEndpoint string `yaml:"collectorEndpoint"`
@@ -36,14 +44,86 @@ type (
 			}
 		} `yaml:"telemetry"`
 		Pubsub struct {
-			PublishTopic struct {
-				RecurringHappen string `yaml:"recurring-happen"`
+			// Driver selects the broker: "google" (default) or "memory".
+			Driver string `yaml:"driver"`
+			// AutoProvision creates missing topics and subscriptions at startup.
+			AutoProvision bool `yaml:"autoProvision"`
+			PublishTopic  struct {
+				RecurringHappen           string `yaml:"recurring-happen"`
+				SubscriptionStatusChanged string `yaml:"subscription-status-changed"`
+				// RecurringCancel asks to cancel the job of a replaced run; empty publishes nothing.
+				RecurringCancel string `yaml:"recurring-cancel"`
 			} `yaml:"publishTopic"`
 			Subscriber struct {
 				SubscriptionHappenResult string `yaml:"subscriptionHappenResult"`
 				SubscriptionJobFinish    string `yaml:"subscriptionJobFinish"`
+				// Settings tunes receiving per subscription name.
+				Settings map[string]SubscriberSettings `yaml:"settings"`
 			} `yaml:"subscriber"`
 		} `yaml:"pubSub"`
+		Scheduler struct {
+			Interval  time.Duration `yaml:"interval"`
+			BatchSize int           `yaml:"batchSize"`
+			Lookahead time.Duration `yaml:"lookahead"`
+			// An occurrence later than MisfireThreshold was missed and goes
+			// through the misfire policy of its subscription, MisfirePolicy
+			// and MisfireMaxRuns when it has none.
+			MisfireThreshold time.Duration `yaml:"misfireThreshold"`
+			MisfirePolicy    string        `yaml:"misfirePolicy"`
+			MisfireMaxRuns   int           `yaml:"misfireMaxRuns"`
+		} `yaml:"scheduler"`
+		// Calendar lists the YAML or JSON files of read-only business day
+		// calendars; more are managed through the admin API.
+		Calendar struct {
+			Files []string `yaml:"files"`
+			// Domain is a host name of the service; it makes the UIDs of
+			// exported iCalendar events globally unique.
+			Domain string `yaml:"domain"`
+		} `yaml:"calendar"`
+		// Reconciler looks for runs stuck in flight: triggered without a happen
+		// result for ResultTimeout, or succeeded without a job finish for
+		// FinishTimeout. Action "republish" publishes a run without result again,
+		// up to MaxRepublish times, before timing it out; "timeout" times it out
+		// at once. A run without job finish is always timed out.
+		Reconciler struct {
+			Interval      time.Duration `yaml:"interval"`
+			BatchSize     int           `yaml:"batchSize"`
+			ResultTimeout time.Duration `yaml:"resultTimeout"`
+			FinishTimeout time.Duration `yaml:"finishTimeout"`
+			Action        string        `yaml:"action"`
+			MaxRepublish  int           `yaml:"maxRepublish"`
+		} `yaml:"reconciler"`
+		// Runs.Channel is the Redis channel run events are relayed on, so
+		// WatchRuns on any replica sees the events of all of them. Empty keeps
+		// the events of a replica to its own watchers.
+		Runs struct {
+			Channel string `yaml:"channel"`
+		} `yaml:"runs"`
+		Outbox struct {
+			Interval    time.Duration `yaml:"interval"`
+			BatchSize   int           `yaml:"batchSize"`
+			BaseBackoff time.Duration `yaml:"baseBackoff"`
+			MaxBackoff  time.Duration `yaml:"maxBackoff"`
+			// Retention is how long sent messages are kept before they are deleted.
+			Retention time.Duration `yaml:"retention"`
+		} `yaml:"outbox"`
+	}
+
+	SubscriberSettings struct {
+		// Topic is the topic the subscription is attached to.
+		Topic                  string        `yaml:"topic"`
+		MaxOutstandingMessages int           `yaml:"maxOutstandingMessages"`
+		Concurrency            int           `yaml:"concurrency"`
+		AckDeadline            time.Duration `yaml:"ackDeadline"`
+		// Timeout bounds the handling of one message.
+		Timeout time.Duration `yaml:"timeout"`
+		// MaxDeliveryAttempts moves a message to the dead-letter store once it has
+		// failed that many times; zero keeps redelivering it.
+		MaxDeliveryAttempts int `yaml:"maxDeliveryAttempts"`
+		// DeadLetterTopic is provisioned, with MaxDeliveryAttempts, as the
+		// dead-letter policy of the subscription. Pub/Sub only counts delivery
+		// attempts under such a policy; without one they are counted per replica.
+		DeadLetterTopic string `yaml:"deadLetterTopic"`
 	}
 )
 
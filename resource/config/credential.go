@@ -37,12 +37,17 @@ type (
 		PubSub struct {
 			ProjectID        string `yaml:"projectID"`
 			CredentialBase64 string `yaml:"credentialBase64"`
+			// EmulatorHost points the client at a Pub/Sub emulator, e.g. "localhost:8085".
+			// PUBSUB_EMULATOR_HOST is used when it is empty.
+			EmulatorHost string `yaml:"emulatorHost"`
 		} `yaml:"pubSub"`
 		Xxl struct {
 			ServerAddr   string `yaml:"serverAddr"`
 			AccessToken  string `yaml:"accessToken"`
 			ExecutorPort string `yaml:"executorPort"`
 			ExecutorName string `yaml:"executorName"`
+			// ExecutorAddress overrides the address registered with the admin.
+			ExecutorAddress string `yaml:"executorAddress"`
 		} `yaml:"xxl"`
 	}
 )
@@ -21,6 +21,7 @@ import (
 	svcerr "newdemo1/resource/jaeger/common/error"
 	"newdemo1/resource/jaeger/common/tls"
 
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	validator "github.com/grpc-ecosystem/go-grpc-middleware/validator"
 )
@@ -123,6 +124,16 @@ func UnaryAuthInterceptor() grpc.UnaryServerInterceptor {
 	}
 }
 
+// StreamAuthInterceptor returns a new streaming server interceptor that extract user info from token.
+func StreamAuthInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = extractUserInfo(stream.Context())
+		return handler(srv, wrapped)
+	}
+}
+
 func recoveryInterceptor() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
 	handler := func(p interface{}) (err error) {
 		log.Print("panic", p)
@@ -182,6 +193,7 @@ func WithDefault(errorMapper map[string]codes.Code) []grpc.ServerOption {
 		),
 		grpc.ChainStreamInterceptor(
 			validator.StreamServerInterceptor(),
+			StreamAuthInterceptor(),
 			streamRecovery,
 			StreamErrorInterceptor(errorMapper),
 		)}
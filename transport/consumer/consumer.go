@@ -0,0 +1,133 @@
+package consumer
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"log"
+	"newdemo1/application"
+	"newdemo1/application/deadletter"
+	"newdemo1/infrastructure/mq/pubsub1"
+	"newdemo1/resource"
+	"sync"
+	"time"
+)
+
+const restartDelay = 5 * time.Second
+
+type (
+	// HandlerFunc processes one message. Returning an error nacks the message.
+	HandlerFunc func(ctx context.Context, message *pubsub1.Message) error
+
+	// Consumer receives from the configured subscriptions and routes every
+	// message to its application handler.
+	Consumer struct {
+		resource *resource.Resource
+		pubsub   pubsub1.Client
+		routes   map[string]HandlerFunc
+		// middlewares wrap every route, outermost first.
+		middlewares []Middleware
+		deadLetter  deadletter.Service
+		cancel      context.CancelFunc
+		wg          sync.WaitGroup
+	}
+)
+
+func NewConsumer(resource *resource.Resource, pubsub pubsub1.Client, app *application.Application) *Consumer {
+	subscriber := resource.Config.Pubsub.Subscriber
+	routes := make(map[string]HandlerFunc)
+	if subscriber.SubscriptionHappenResult != "" {
+		routes[subscriber.SubscriptionHappenResult] = payload(app.Event.HandleHappenResult)
+	}
+	if subscriber.SubscriptionJobFinish != "" {
+		routes[subscriber.SubscriptionJobFinish] = payload(app.Event.HandleJobFinish)
+	}
+
+	return &Consumer{
+		resource: resource,
+		pubsub:   pubsub,
+		routes:   routes,
+		middlewares: []Middleware{
+			WithRedriveTarget(),
+			WithTracing(),
+			WithLogging(resource.Jaeger.Tracer),
+			WithMetrics(resource.Datadog.Metrics(), resource.Config.Telemetry.Tracer.SourceEnv),
+		},
+		deadLetter: app.DeadLetter,
+	}
+}
+
+// Use appends middlewares to the chain every handler runs through. It must be called before Run.
+func (c *Consumer) Use(middlewares ...Middleware) {
+	c.middlewares = append(c.middlewares, middlewares...)
+}
+
+func (c *Consumer) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	for subscription, handler := range c.routes {
+		c.wg.Add(1)
+		settings := c.resource.Config.Pubsub.Subscriber.Settings[subscription]
+		middlewares := append(append([]Middleware{}, c.middlewares...),
+			WithDeadLetter(c.resource.Log, c.deadLetter, settings.MaxDeliveryAttempts),
+			WithRecovery(c.resource.Log),
+			WithTimeout(settings.Timeout),
+		)
+		go c.receive(ctx, subscription, Chain(handler, middlewares...))
+	}
+}
+
+// Stop cancels every receiver and waits for in-flight messages to settle.
+func (c *Consumer) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+}
+
+// receive keeps a subscription open, restarting it after transient failures until ctx is done.
+func (c *Consumer) receive(ctx context.Context, subscription string, handler HandlerFunc) {
+	defer c.wg.Done()
+	log.Println("[Recurring Service Consumer] receiving from", subscription)
+
+	for {
+		err := c.pubsub.Subscribe(ctx, subscription, func(ctx context.Context, message *pubsub1.Message) {
+			if err := handler(withSubscription(ctx, subscription), message); err != nil {
+				message.Nack()
+				return
+			}
+			message.Ack()
+		}, c.options(subscription)...)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.resource.Log.Error(ctx, "receive stopped", err, zap.String("subscription", subscription))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+func (c *Consumer) options(subscription string) []pubsub1.SubscribeOption {
+	settings, ok := c.resource.Config.Pubsub.Subscriber.Settings[subscription]
+	if !ok {
+		return nil
+	}
+	return []pubsub1.SubscribeOption{
+		pubsub1.WithMaxOutstandingMessages(settings.MaxOutstandingMessages),
+		pubsub1.WithConcurrency(settings.Concurrency),
+		pubsub1.WithAckDeadline(settings.AckDeadline),
+	}
+}
+
+// payload adapts an application handler that only needs the message body.
+func payload(handle func(ctx context.Context, data []byte) error) HandlerFunc {
+	return func(ctx context.Context, message *pubsub1.Message) error {
+		return handle(ctx, message.Data)
+	}
+}
@@ -0,0 +1,300 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"newdemo1/application/deadletter"
+	"newdemo1/infrastructure/mq/pubsub1"
+	"newdemo1/resource/jaeger/common/telemetry"
+	"newdemo1/resource/jaeger/common/telemetry/instrumentation/filter"
+	"newdemo1/resource/jaeger/common/tracer"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const metricName = "pubsub.consume"
+
+// loggedAttributes are the message attributes WithLogging writes; the others
+// may carry data of the sender that does not belong in the logs.
+var loggedAttributes = []string{
+	"subscriptionId",
+	"correlationId",
+	"attempt",
+	"eventType",
+	deadletter.AttributeRedrivenFrom,
+	deadletter.AttributeRedriveTo,
+}
+
+type (
+	// Middleware wraps a HandlerFunc the way commonHttp.Option wraps an http.Handler.
+	Middleware func(next HandlerFunc) HandlerFunc
+
+	// DeadLetterRecorder stores a message that exhausted its delivery attempts.
+	DeadLetterRecorder interface {
+		Record(ctx context.Context, subscription string, message *pubsub1.Message, attempts int, cause error) error
+	}
+
+	subscriptionKey struct{}
+)
+
+// Chain wraps handler with middlewares; the first middleware is the outermost.
+func Chain(handler HandlerFunc, middlewares ...Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Subscription returns the name of the subscription the message in ctx was received from.
+func Subscription(ctx context.Context) string {
+	subscription, _ := ctx.Value(subscriptionKey{}).(string)
+	return subscription
+}
+
+func withSubscription(ctx context.Context, subscription string) context.Context {
+	return context.WithValue(ctx, subscriptionKey{}, subscription)
+}
+
+// WithRecovery turns a panicking handler into a failed, nacked message.
+func WithRecovery(logger telemetry.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message *pubsub1.Message) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("consumer: handler panic: %v", p)
+					logger.Error(ctx, "message handler panic", err,
+						zap.String("subscription", Subscription(ctx)),
+						zap.String("messageId", message.ID),
+						zap.ByteString("stack", debug.Stack()))
+				}
+			}()
+			return next(ctx, message)
+		}
+	}
+}
+
+// WithRedriveTarget acks a redriven message addressed to another subscription of
+// the same topic without handling it, so a redrive reaches only the subscription
+// the message failed on.
+func WithRedriveTarget() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message *pubsub1.Message) error {
+			target, ok := message.Attributes[deadletter.AttributeRedriveTo]
+			if ok && target != Subscription(ctx) {
+				return nil
+			}
+			return next(ctx, message)
+		}
+	}
+}
+
+// WithLogging logs every message and its outcome. The payload is masked with the
+// telemetry body filter rules, matched against the subscription name, and only
+// the loggedAttributes of the message are written.
+func WithLogging(api *telemetry.API) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message *pubsub1.Message) error {
+			subscription := Subscription(ctx)
+			var payload interface{} = string(message.Data)
+			if api.Filter != nil {
+				rules := api.Filter.PayloadFilter(&filter.TargetFilter{
+					Method: subscription,
+				})
+				payload = filter.BodyFilter(rules, payload)
+			}
+			fields := []zap.Field{
+				zap.String("subscription", subscription),
+				zap.String("messageId", message.ID),
+				zap.Int("deliveryAttempt", message.DeliveryAttempt),
+			}
+			api.Logger().Info(ctx, "PubSub Message", append(fields,
+				zap.Any("attributes", allowedAttributes(message.Attributes)),
+				zap.Any("payload", payload))...)
+
+			start := time.Now()
+			err := next(ctx, message)
+			fields = append(fields, zap.Int64("elapsedMs", time.Since(start).Milliseconds()))
+			if err != nil {
+				api.Logger().Error(ctx, "PubSub Message failed", err, fields...)
+				return err
+			}
+			api.Logger().Info(ctx, "PubSub Message handled", fields...)
+			return nil
+		}
+	}
+}
+
+// allowedAttributes returns the loggedAttributes present in attributes.
+func allowedAttributes(attributes map[string]string) map[string]string {
+	allowed := make(map[string]string, len(loggedAttributes))
+	for _, key := range loggedAttributes {
+		if value, ok := attributes[key]; ok {
+			allowed[key] = value
+		}
+	}
+	return allowed
+}
+
+// WithMetrics counts messages by subscription and status and records their handling time.
+func WithMetrics(metrics telemetry.Metrics, sourceEnv string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message *pubsub1.Message) error {
+			start := time.Now()
+			err := next(ctx, message)
+
+			status := "success"
+			if err != nil {
+				status = "failed"
+			}
+			tags := []string{
+				"subscription:" + Subscription(ctx),
+				"status:" + status,
+				"src_env:" + sourceEnv,
+			}
+			elapsed := float64(time.Since(start).Milliseconds())
+			metrics.Count(metricName, 1, tags)
+			metrics.Histogram(metricName+".histogram", elapsed, tags)
+			metrics.Distribution(metricName+".distribution", elapsed, tags)
+			return err
+		}
+	}
+}
+
+// WithTracing runs the handler in a span named after the subscription.
+func WithTracing() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message *pubsub1.Message) error {
+			subscription := Subscription(ctx)
+			tr := tracer.StartTrace(ctx, "consumer."+subscription)
+			err := next(tr.Context(), message)
+			tags := map[string]interface{}{
+				"subscription":    subscription,
+				"messageId":       message.ID,
+				"deliveryAttempt": message.DeliveryAttempt,
+			}
+			if err != nil {
+				tags["error"] = err
+			}
+			tr.Finish(tags)
+			return err
+		}
+	}
+}
+
+// WithTimeout bounds the time a handler may spend on one message. A handler
+// still running when it expires fails the message so it is redelivered.
+func WithTimeout(timeout time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		if timeout <= 0 {
+			return next
+		}
+		return func(ctx context.Context, message *pubsub1.Message) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := next(ctx, message)
+			if err == nil && ctx.Err() != nil {
+				err = fmt.Errorf("consumer: handler exceeded %s: %w", timeout, ctx.Err())
+			}
+			return err
+		}
+	}
+}
+
+// failureTTL is how long a message's failures are remembered by the
+// in-memory count WithDeadLetter falls back on.
+const failureTTL = time.Hour
+
+// WithDeadLetter records a message that failed maxAttempts times and acks it so
+// it stops being redelivered. The broker's delivery attempt is used when it
+// reports one, which Pub/Sub does for a subscription with a dead-letter policy.
+// Otherwise failures are counted in memory: per replica, lost on restart, and
+// forgotten once a message has not failed for failureTTL.
+func WithDeadLetter(logger telemetry.Logger, recorder DeadLetterRecorder, maxAttempts int) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		if maxAttempts <= 0 {
+			return next
+		}
+		failures := newFailureCounts(failureTTL)
+		return func(ctx context.Context, message *pubsub1.Message) error {
+			err := next(ctx, message)
+			if err == nil {
+				failures.forget(message.ID)
+				return nil
+			}
+			attempts := message.DeliveryAttempt
+			if attempts <= 0 {
+				attempts = failures.add(message.ID)
+			}
+			if attempts < maxAttempts {
+				return err
+			}
+			failures.forget(message.ID)
+
+			subscription := Subscription(ctx)
+			if recordErr := recorder.Record(ctx, subscription, message, attempts, err); recordErr != nil {
+				logger.Error(ctx, "failed to dead-letter message", recordErr,
+					zap.String("subscription", subscription),
+					zap.String("messageId", message.ID))
+				return err
+			}
+			logger.Warn(ctx, "message moved to dead letters",
+				zap.String("subscription", subscription),
+				zap.String("messageId", message.ID),
+				zap.Int("attempts", attempts),
+				zap.String("error", err.Error()))
+			return nil
+		}
+	}
+}
+
+type (
+	// failureCounts counts the failures of messages by id, forgetting those
+	// that have not failed for ttl so it does not grow without bound.
+	failureCounts struct {
+		mu       sync.Mutex
+		ttl      time.Duration
+		now      func() time.Time
+		sweptAt  time.Time
+		failures map[string]failureCount
+	}
+	failureCount struct {
+		count    int
+		failedAt time.Time
+	}
+)
+
+func newFailureCounts(ttl time.Duration) *failureCounts {
+	return &failureCounts{ttl: ttl, now: time.Now, failures: make(map[string]failureCount)}
+}
+
+// add counts a failure of the message id and returns its failures so far.
+func (f *failureCounts) add(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if now.Sub(f.sweptAt) >= f.ttl {
+		for key, failure := range f.failures {
+			if now.Sub(failure.failedAt) >= f.ttl {
+				delete(f.failures, key)
+			}
+		}
+		f.sweptAt = now
+	}
+	failure := f.failures[id]
+	if now.Sub(failure.failedAt) >= f.ttl {
+		failure.count = 0
+	}
+	failure.count++
+	failure.failedAt = now
+	f.failures[id] = failure
+	return failure.count
+}
+
+func (f *failureCounts) forget(id string) {
+	f.mu.Lock()
+	delete(f.failures, id)
+	f.mu.Unlock()
+}
@@ -0,0 +1,145 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"newdemo1/application/deadletter"
+	"newdemo1/infrastructure/mq/pubsub1"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(context.Context, string, ...zap.Field)         {}
+func (nopLogger) Warn(context.Context, string, ...zap.Field)         {}
+func (nopLogger) Error(context.Context, string, error, ...zap.Field) {}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, message *pubsub1.Message) error {
+				calls = append(calls, name+" before")
+				err := next(ctx, message)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+	handler := Chain(func(ctx context.Context, message *pubsub1.Message) error {
+		calls = append(calls, "handler")
+		assert.Equal(t, "sub", Subscription(ctx))
+		return nil
+	}, record("outer"), record("inner"))
+
+	assert.NoError(t, handler(withSubscription(context.Background(), "sub"), pubsub1.NewMessage(nil, nil)))
+	assert.Equal(t, []string{"outer before", "inner before", "handler", "inner after", "outer after"}, calls)
+}
+
+func TestWithRecovery(t *testing.T) {
+	handler := Chain(func(ctx context.Context, message *pubsub1.Message) error {
+		panic("boom")
+	}, WithRecovery(nopLogger{}))
+
+	err := handler(context.Background(), pubsub1.NewMessage(nil, nil))
+	assert.EqualError(t, err, "consumer: handler panic: boom")
+}
+
+func TestWithRedriveTarget(t *testing.T) {
+	var handled int
+	handler := Chain(func(ctx context.Context, message *pubsub1.Message) error {
+		handled++
+		return nil
+	}, WithRedriveTarget())
+
+	ctx := withSubscription(context.Background(), "sub")
+	assert.NoError(t, handler(ctx, pubsub1.NewMessage(nil, nil)))
+	assert.NoError(t, handler(ctx, pubsub1.NewMessage(nil, map[string]string{deadletter.AttributeRedriveTo: "sub"})))
+	assert.NoError(t, handler(ctx, pubsub1.NewMessage(nil, map[string]string{deadletter.AttributeRedriveTo: "other"})))
+	assert.Equal(t, 2, handled)
+}
+
+func TestAllowedAttributes(t *testing.T) {
+	allowed := allowedAttributes(map[string]string{
+		"subscriptionId":                 "42",
+		"correlationId":                  "c-1",
+		deadletter.AttributeRedrivenFrom: "7",
+		"authorization":                  "Bearer secret",
+		"email":                          "user@example.com",
+	})
+	assert.Equal(t, map[string]string{
+		"subscriptionId":                 "42",
+		"correlationId":                  "c-1",
+		deadletter.AttributeRedrivenFrom: "7",
+	}, allowed)
+	assert.Empty(t, allowedAttributes(nil))
+}
+
+func TestWithTimeout(t *testing.T) {
+	slow := func(ctx context.Context, message *pubsub1.Message) error {
+		<-ctx.Done()
+		return nil
+	}
+	err := Chain(slow, WithTimeout(10*time.Millisecond))(context.Background(), pubsub1.NewMessage(nil, nil))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	fast := func(ctx context.Context, message *pubsub1.Message) error {
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+		return nil
+	}
+	assert.NoError(t, Chain(fast, WithTimeout(0))(context.Background(), pubsub1.NewMessage(nil, nil)))
+}
+
+type recorder struct {
+	attempts []int
+}
+
+func (r *recorder) Record(ctx context.Context, subscription string, message *pubsub1.Message, attempts int, cause error) error {
+	r.attempts = append(r.attempts, attempts)
+	return nil
+}
+
+func TestWithDeadLetter(t *testing.T) {
+	failing := func(ctx context.Context, message *pubsub1.Message) error {
+		return errors.New("boom")
+	}
+
+	r := &recorder{}
+	handler := Chain(failing, WithDeadLetter(nopLogger{}, r, 3))
+	message := pubsub1.NewReceivedMessage("1", nil, nil, time.Now(), 0, nil, nil)
+	assert.Error(t, handler(context.Background(), message))
+	assert.Error(t, handler(context.Background(), message))
+	assert.NoError(t, handler(context.Background(), message))
+	assert.Equal(t, []int{3}, r.attempts)
+
+	// The broker's delivery attempt takes precedence over the local count.
+	r = &recorder{}
+	handler = Chain(failing, WithDeadLetter(nopLogger{}, r, 3))
+	message = pubsub1.NewReceivedMessage("2", nil, nil, time.Now(), 5, nil, nil)
+	assert.NoError(t, handler(context.Background(), message))
+	assert.Equal(t, []int{5}, r.attempts)
+}
+
+func TestFailureCountsExpire(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	failures := newFailureCounts(time.Hour)
+	failures.now = func() time.Time { return now }
+
+	assert.Equal(t, 1, failures.add("a"))
+	assert.Equal(t, 2, failures.add("a"))
+	assert.Equal(t, 1, failures.add("b"))
+
+	// A message that stops failing, say as it succeeded on another replica,
+	// is swept once the ttl passed.
+	now = now.Add(61 * time.Minute)
+	assert.Equal(t, 1, failures.add("a"))
+	assert.Len(t, failures.failures, 1)
+
+	failures.forget("a")
+	assert.Empty(t, failures.failures)
+}
@@ -3,10 +3,12 @@ package grpc
 import (
 	"google.golang.org/grpc"
 	"log"
+	"newdemo1/application"
 	"newdemo1/constant"
 	"newdemo1/resource"
 	commonGrpc "newdemo1/resource/jaeger/common/grpc"
 	commonTelemetryGrpc "newdemo1/resource/jaeger/common/telemetry/instrumentation/grpc"
+	"newdemo1/transport/grpc/pb"
 )
 
 type Grpc struct {
@@ -14,18 +16,24 @@ type Grpc struct {
 	server   *grpc.Server
 }
 
-func NewServer(resource *resource.Resource) (*grpc.Server, error) {
+func NewServer(resource *resource.Resource, app *application.Application) (*grpc.Server, error) {
 	commonIntercept := commonGrpc.WithDefault(constant.ServiceErrorCodeToGRPCErrorCode)
 	chainedUnaryInterceptor := grpc.ChainUnaryInterceptor(
 		commonTelemetryGrpc.UnaryServerInterceptor(resource.Jaeger.Tracer, constant.ServiceErrorCodeToGRPCErrorCode),
 	)
 
-	interceptors := append(commonIntercept, chainedUnaryInterceptor)
-	return grpc.NewServer(interceptors...), nil
+	chainedStreamInterceptor := grpc.ChainStreamInterceptor(
+		commonTelemetryGrpc.StreamServerInterceptor(resource.Jaeger.Tracer, constant.ServiceErrorCodeToGRPCErrorCode),
+	)
+
+	interceptors := append(commonIntercept, chainedUnaryInterceptor, chainedStreamInterceptor)
+	server := grpc.NewServer(interceptors...)
+	pb.RegisterSubscriptionServiceServer(server, newSubscriptionServer(app))
+	return server, nil
 }
 
-func NewGrpc(resource *resource.Resource) (Grpc, error) {
-	server, err := NewServer(resource)
+func NewGrpc(resource *resource.Resource, app *application.Application) (Grpc, error) {
+	server, err := NewServer(resource, app)
 	if err != nil {
 		return Grpc{}, err
 	}
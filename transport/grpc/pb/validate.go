@@ -0,0 +1,92 @@
+//go:generate protoc -I . --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative subscription.proto
+package pb
+
+import "errors"
+
+// The Validate methods are run by the validator interceptor before a request
+// reaches the server; the application layer validates the rest.
+
+func (x *CreateSubscriptionRequest) Validate() error {
+	switch {
+	case x.GetOwnerId() == "":
+		return errors.New("owner_id is required")
+	case x.GetSchedule() == "":
+		return errors.New("schedule is required")
+	case x.GetAmount() <= 0:
+		return errors.New("amount must be positive")
+	case x.GetCurrency() == "":
+		return errors.New("currency is required")
+	}
+	return nil
+}
+
+func (x *GetSubscriptionRequest) Validate() error {
+	return validateID(x.GetId())
+}
+
+func (x *ListSubscriptionsRequest) Validate() error {
+	if x.GetPage() < 0 {
+		return errors.New("page must not be negative")
+	}
+	if x.GetSize() < 0 || x.GetSize() > 100 {
+		return errors.New("size must be between 0 and 100")
+	}
+	return nil
+}
+
+func (x *UpdateSubscriptionRequest) Validate() error {
+	return validateID(x.GetId())
+}
+
+func (x *TransitionSubscriptionRequest) Validate() error {
+	return validateID(x.GetId())
+}
+
+func (x *ListRunsRequest) Validate() error {
+	if x.GetPage() < 0 {
+		return errors.New("page must not be negative")
+	}
+	if x.GetSize() < 0 || x.GetSize() > 100 {
+		return errors.New("size must be between 0 and 100")
+	}
+	return nil
+}
+
+func (x *GetRunRequest) Validate() error {
+	return validateID(x.GetId())
+}
+
+func (x *WatchRunsRequest) Validate() error {
+	if x.GetSubscriptionId() == 0 && x.GetOwnerId() == "" {
+		return errors.New("subscription_id or owner_id is required")
+	}
+	return nil
+}
+
+func (x *PreviewScheduleRequest) Validate() error {
+	if x.GetSchedule() == "" {
+		return errors.New("schedule is required")
+	}
+	return validateCount(x.GetCount())
+}
+
+func (x *ListUpcomingRequest) Validate() error {
+	if err := validateID(x.GetId()); err != nil {
+		return err
+	}
+	return validateCount(x.GetCount())
+}
+
+func validateCount(count int32) error {
+	if count < 0 || count > 366 {
+		return errors.New("count must be between 0 and 366")
+	}
+	return nil
+}
+
+func validateID(id uint64) error {
+	if id == 0 {
+		return errors.New("id is required")
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package grpc
+
+import (
+	"context"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"newdemo1/application"
+	"newdemo1/application/run"
+	"newdemo1/application/subscription"
+	"newdemo1/infrastructure/repository"
+	"newdemo1/transport/grpc/pb"
+	"time"
+)
+
+// watchBuffer is the number of run events a WatchRuns stream may fall behind
+// before it starts missing events.
+const watchBuffer = 64
+
+type subscriptionServer struct {
+	pb.UnimplementedSubscriptionServiceServer
+	app *application.Application
+}
+
+func newSubscriptionServer(app *application.Application) pb.SubscriptionServiceServer {
+	return &subscriptionServer{app: app}
+}
+
+func (s *subscriptionServer) CreateSubscription(ctx context.Context, req *pb.CreateSubscriptionRequest) (*pb.Subscription, error) {
+	sub, err := s.app.Subscription.Create(ctx, subscription.CreateRequest{
+		ExternalRef: req.GetExternalRef(),
+		OwnerID:     req.GetOwnerId(),
+		Schedule:    req.GetSchedule(),
+		Amount:      req.GetAmount(),
+		Currency:    req.GetCurrency(),
+		Description: req.GetDescription(),
+		StartAt:     fromTimestamp(req.GetStartAt()),
+		EndAt:       fromTimestamp(req.GetEndAt()),
+		Timezone:    req.GetTimezone(),
+		Calendar:    req.GetCalendar(),
+		Adjustment:  req.GetAdjustment(),
+		RetryPolicy: fromRetryPolicy(req.GetRetryPolicy()),
+
+		MisfirePolicy:     req.GetMisfirePolicy(),
+		MisfireMaxRuns:    int(req.GetMisfireMaxRuns()),
+		ConcurrencyPolicy: req.GetConcurrencyPolicy(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toSubscription(sub), nil
+}
+
+func (s *subscriptionServer) GetSubscription(ctx context.Context, req *pb.GetSubscriptionRequest) (*pb.Subscription, error) {
+	sub, err := s.app.Subscription.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return toSubscription(sub), nil
+}
+
+func (s *subscriptionServer) ListSubscriptions(ctx context.Context, req *pb.ListSubscriptionsRequest) (*pb.ListSubscriptionsResponse, error) {
+	subs, total, err := s.app.Subscription.List(ctx, subscription.ListRequest{
+		OwnerID: req.GetOwnerId(),
+		Status:  req.GetStatus(),
+		Page:    int(req.GetPage()),
+		Size:    int(req.GetSize()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ListSubscriptionsResponse{Total: total}
+	for _, sub := range subs {
+		resp.Subscriptions = append(resp.Subscriptions, toSubscription(sub))
+	}
+	return resp, nil
+}
+
+func (s *subscriptionServer) UpdateSubscription(ctx context.Context, req *pb.UpdateSubscriptionRequest) (*pb.Subscription, error) {
+	var update subscription.UpdateRequest
+	if req.Schedule != nil {
+		update.Schedule = &req.Schedule.Value
+	}
+	if req.Amount != nil {
+		update.Amount = &req.Amount.Value
+	}
+	if req.Currency != nil {
+		update.Currency = &req.Currency.Value
+	}
+	if req.Description != nil {
+		update.Description = &req.Description.Value
+	}
+	if req.Timezone != nil {
+		update.Timezone = &req.Timezone.Value
+	}
+	if req.Calendar != nil {
+		update.Calendar = &req.Calendar.Value
+	}
+	if req.Adjustment != nil {
+		update.Adjustment = &req.Adjustment.Value
+	}
+	if req.MisfirePolicy != nil {
+		update.MisfirePolicy = &req.MisfirePolicy.Value
+	}
+	if req.MisfireMaxRuns != nil {
+		maxRuns := int(req.MisfireMaxRuns.Value)
+		update.MisfireMaxRuns = &maxRuns
+	}
+	if req.ConcurrencyPolicy != nil {
+		update.ConcurrencyPolicy = &req.ConcurrencyPolicy.Value
+	}
+	update.RetryPolicy = fromRetryPolicy(req.GetRetryPolicy())
+	sub, err := s.app.Subscription.Update(ctx, req.GetId(), update)
+	if err != nil {
+		return nil, err
+	}
+	return toSubscription(sub), nil
+}
+
+func (s *subscriptionServer) PauseSubscription(ctx context.Context, req *pb.TransitionSubscriptionRequest) (*pb.Subscription, error) {
+	return s.transition(ctx, req, s.app.Subscription.Pause)
+}
+
+func (s *subscriptionServer) ResumeSubscription(ctx context.Context, req *pb.TransitionSubscriptionRequest) (*pb.Subscription, error) {
+	return s.transition(ctx, req, s.app.Subscription.Resume)
+}
+
+func (s *subscriptionServer) CancelSubscription(ctx context.Context, req *pb.TransitionSubscriptionRequest) (*pb.Subscription, error) {
+	return s.transition(ctx, req, s.app.Subscription.Cancel)
+}
+
+func (s *subscriptionServer) transition(ctx context.Context, req *pb.TransitionSubscriptionRequest, action func(ctx context.Context, id uint64,
+	req subscription.TransitionRequest) (repository.Subscription, error)) (*pb.Subscription, error) {
+	sub, err := action(ctx, req.GetId(), subscription.TransitionRequest{Reason: req.GetReason()})
+	if err != nil {
+		return nil, err
+	}
+	return toSubscription(sub), nil
+}
+
+func (s *subscriptionServer) ListRuns(ctx context.Context, req *pb.ListRunsRequest) (*pb.ListRunsResponse, error) {
+	runs, total, err := s.app.Ledger.List(ctx, run.ListRequest{
+		SubscriptionID: req.GetSubscriptionId(),
+		OwnerID:        req.GetOwnerId(),
+		Status:         req.GetStatus(),
+		From:           fromTimestamp(req.GetFrom()),
+		To:             fromTimestamp(req.GetTo()),
+		Page:           int(req.GetPage()),
+		Size:           int(req.GetSize()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ListRunsResponse{Total: total}
+	for _, ledger := range runs {
+		resp.Runs = append(resp.Runs, toRun(ledger))
+	}
+	return resp, nil
+}
+
+func (s *subscriptionServer) GetRun(ctx context.Context, req *pb.GetRunRequest) (*pb.Run, error) {
+	ledger, err := s.app.Ledger.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return toRun(ledger), nil
+}
+
+// WatchRuns streams the run events of every replica, or of this one when run
+// events are not relayed, until the client goes away.
+func (s *subscriptionServer) WatchRuns(req *pb.WatchRunsRequest, stream pb.SubscriptionService_WatchRunsServer) error {
+	ctx := stream.Context()
+	if req.GetSubscriptionId() != 0 {
+		if _, err := s.app.Subscription.Get(ctx, req.GetSubscriptionId()); err != nil {
+			return err
+		}
+	}
+
+	events, stop := s.app.Runs.Watch(run.Filter{
+		SubscriptionID: req.GetSubscriptionId(),
+		OwnerID:        req.GetOwnerId(),
+	}, watchBuffer)
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(toRunEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *subscriptionServer) PreviewSchedule(ctx context.Context, req *pb.PreviewScheduleRequest) (*pb.PreviewResponse, error) {
+	preview, err := s.app.Subscription.Preview(ctx, subscription.PreviewRequest{
+		Schedule:   req.GetSchedule(),
+		Timezone:   req.GetTimezone(),
+		Calendar:   req.GetCalendar(),
+		Adjustment: req.GetAdjustment(),
+		StartAt:    fromTimestamp(req.GetStartAt()),
+		EndAt:      fromTimestamp(req.GetEndAt()),
+		Count:      int(req.GetCount()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toPreview(preview), nil
+}
+
+func (s *subscriptionServer) ListUpcoming(ctx context.Context, req *pb.ListUpcomingRequest) (*pb.PreviewResponse, error) {
+	preview, err := s.app.Subscription.Upcoming(ctx, req.GetId(), subscription.UpcomingRequest{Count: int(req.GetCount())})
+	if err != nil {
+		return nil, err
+	}
+	return toPreview(preview), nil
+}
+
+func toSubscription(sub repository.Subscription) *pb.Subscription {
+	resp := &pb.Subscription{
+		Id:              sub.ID,
+		OwnerId:         sub.OwnerID,
+		Schedule:        sub.Schedule,
+		Amount:          sub.Amount,
+		Currency:        sub.Currency,
+		Description:     sub.Description,
+		Status:          sub.Status,
+		StartAt:         timestamppb.New(sub.StartAt),
+		EndAt:           toTimestamp(sub.EndAt),
+		NextRunAt:       toTimestamp(sub.NextRunAt),
+		LastRunAt:       toTimestamp(sub.LastRunAt),
+		RunCount:        sub.RunCount,
+		LastResult:      sub.LastResult,
+		LastResultAt:    toTimestamp(sub.LastResultAt),
+		StatusReason:    sub.StatusReason,
+		StatusChangedAt: toTimestamp(sub.StatusChangedAt),
+		CreatedAt:       timestamppb.New(sub.CreatedAt),
+		UpdatedAt:       timestamppb.New(sub.UpdatedAt),
+		RetryPolicy: &pb.RetryPolicy{
+			MaxAttempts:      int32(sub.RetryPolicy.MaxAttempts),
+			InitialBackoffMs: sub.RetryPolicy.InitialBackoffMs,
+			Multiplier:       sub.RetryPolicy.Multiplier,
+			Jitter:           sub.RetryPolicy.Jitter,
+			RetryableCodes:   sub.RetryPolicy.RetryableCodes,
+			ExhaustedStatus:  sub.RetryPolicy.ExhaustedStatus,
+		},
+		MisfirePolicy:     sub.MisfirePolicy,
+		MisfireMaxRuns:    int32(sub.MisfireMaxRuns),
+		Timezone:          sub.Timezone,
+		Calendar:          sub.Calendar,
+		Adjustment:        sub.Adjustment,
+		ConcurrencyPolicy: sub.ConcurrencyPolicy,
+	}
+	if sub.ExternalRef != nil {
+		resp.ExternalRef = *sub.ExternalRef
+	}
+	return resp
+}
+
+func fromRetryPolicy(policy *pb.RetryPolicy) *subscription.RetryPolicy {
+	if policy == nil {
+		return nil
+	}
+	return &subscription.RetryPolicy{
+		MaxAttempts:      int(policy.GetMaxAttempts()),
+		InitialBackoffMs: policy.GetInitialBackoffMs(),
+		Multiplier:       policy.GetMultiplier(),
+		Jitter:           policy.GetJitter(),
+		RetryableCodes:   policy.GetRetryableCodes(),
+		ExhaustedStatus:  policy.GetExhaustedStatus(),
+	}
+}
+
+func toRun(ledger repository.SubscriptionRun) *pb.Run {
+	return &pb.Run{
+		Id:             ledger.ID,
+		SubscriptionId: ledger.SubscriptionID,
+		OwnerId:        ledger.OwnerID,
+		ScheduledAt:    timestamppb.New(ledger.ScheduledAt),
+		TriggeredAt:    timestamppb.New(ledger.TriggeredAt),
+		CorrelationId:  ledger.CorrelationID,
+		Status:         ledger.Status,
+		Attempts:       int32(ledger.Attempts),
+		ErrorCode:      ledger.ErrorCode,
+		ErrorMessage:   ledger.ErrorMessage,
+		ResultAt:       toTimestamp(ledger.ResultAt),
+		FinishedAt:     toTimestamp(ledger.FinishedAt),
+		NextRetryAt:    toTimestamp(ledger.NextRetryAt),
+		Misfire:        ledger.Misfire,
+		Concurrency:    ledger.Concurrency,
+		Republished:    int32(ledger.Republished),
+		ReplacedBy:     toTimestamp(ledger.ReplacedBy),
+	}
+}
+
+func toRunEvent(event run.Event) *pb.RunEvent {
+	return &pb.RunEvent{
+		SubscriptionId: event.SubscriptionID,
+		OwnerId:        event.OwnerID,
+		Type:           event.Type,
+		ScheduledAt:    timestamppb.New(event.ScheduledAt),
+		ErrorCode:      event.ErrorCode,
+		ErrorMessage:   event.ErrorMessage,
+		OccurredAt:     timestamppb.New(event.OccurredAt),
+	}
+}
+
+func toPreview(preview subscription.Preview) *pb.PreviewResponse {
+	resp := &pb.PreviewResponse{Timezone: preview.Timezone}
+	for _, at := range preview.Occurrences {
+		resp.Occurrences = append(resp.Occurrences, timestamppb.New(at))
+	}
+	return resp
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func fromTimestamp(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
@@ -0,0 +1,136 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"newdemo1/application"
+	"newdemo1/application/run"
+	"newdemo1/application/subscription"
+	"newdemo1/constant"
+	"newdemo1/infrastructure/repository"
+	commonGrpc "newdemo1/resource/jaeger/common/grpc"
+	"newdemo1/transport/grpc/pb"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeSubscriptions struct {
+	subscription.Service
+}
+
+func (fakeSubscriptions) Get(ctx context.Context, id uint64) (repository.Subscription, error) {
+	if id != 1 {
+		return repository.Subscription{}, constant.SubscriptionNotFound
+	}
+	return repository.Subscription{ID: 1, OwnerID: "owner", Status: repository.SubscriptionStatusActive}, nil
+}
+
+func dial(t *testing.T, app *application.Application) pb.SubscriptionServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(commonGrpc.WithDefault(constant.ServiceErrorCodeToGRPCErrorCode)...)
+	pb.RegisterSubscriptionServiceServer(server, newSubscriptionServer(app))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewSubscriptionServiceClient(conn)
+}
+
+func TestGetSubscription(t *testing.T) {
+	client := dial(t, &application.Application{Subscription: fakeSubscriptions{}, Runs: run.NewBroadcaster()})
+
+	sub, err := client.GetSubscription(context.Background(), &pb.GetSubscriptionRequest{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "owner", sub.GetOwnerId())
+	assert.Nil(t, sub.GetNextRunAt())
+
+	_, err = client.GetSubscription(context.Background(), &pb.GetSubscriptionRequest{Id: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetSubscription(context.Background(), &pb.GetSubscriptionRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestWatchRuns(t *testing.T) {
+	runs := run.NewBroadcaster()
+	client := dial(t, &application.Application{Subscription: fakeSubscriptions{}, Runs: runs})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchRuns(ctx, &pb.WatchRunsRequest{SubscriptionId: 1})
+	require.NoError(t, err)
+
+	scheduledAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// The watch is registered once the server handler runs, so keep publishing
+	// until the first event arrives.
+	received := make(chan *pb.RunEvent, 1)
+	go func() {
+		event, err := stream.Recv()
+		if err == nil {
+			received <- event
+		}
+	}()
+	for {
+		runs.Publish(run.Event{SubscriptionID: 2, Type: run.EventTriggered, ScheduledAt: scheduledAt})
+		runs.Publish(run.Event{SubscriptionID: 1, Type: run.EventTriggered, ScheduledAt: scheduledAt})
+		select {
+		case event := <-received:
+			assert.Equal(t, uint64(1), event.GetSubscriptionId())
+			assert.Equal(t, run.EventTriggered, event.GetType())
+			assert.True(t, scheduledAt.Equal(event.GetScheduledAt().AsTime()))
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("no run event received")
+		}
+	}
+}
+
+func TestWatchRunsUnknownSubscription(t *testing.T) {
+	client := dial(t, &application.Application{Subscription: fakeSubscriptions{}, Runs: run.NewBroadcaster()})
+
+	stream, err := client.WatchRuns(context.Background(), &pb.WatchRunsRequest{SubscriptionId: 2})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	stream, err = client.WatchRuns(context.Background(), &pb.WatchRunsRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+type fakeLedger struct {
+	run.Service
+}
+
+func (fakeLedger) Get(ctx context.Context, id uint64) (repository.SubscriptionRun, error) {
+	if id != 1 {
+		return repository.SubscriptionRun{}, constant.RunNotFound
+	}
+	return repository.SubscriptionRun{ID: 1, SubscriptionID: 1, CorrelationID: "abc", Status: repository.RunStatusTriggered}, nil
+}
+
+func TestGetRun(t *testing.T) {
+	client := dial(t, &application.Application{Ledger: fakeLedger{}, Runs: run.NewBroadcaster()})
+
+	ledger, err := client.GetRun(context.Background(), &pb.GetRunRequest{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "abc", ledger.GetCorrelationId())
+	assert.Nil(t, ledger.GetResultAt())
+
+	_, err = client.GetRun(context.Background(), &pb.GetRunRequest{Id: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,96 @@
+package bulk
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"newdemo1/application"
+	"newdemo1/application/bulk"
+	"newdemo1/resource"
+	"newdemo1/transport/http/controller/response"
+)
+
+var contentTypes = map[string]string{
+	bulk.FormatCSV:   "text/csv; charset=utf-8",
+	bulk.FormatJSONL: "application/x-ndjson",
+}
+
+type Controller interface {
+	// Import reads rows from the request body and streams a JSON line per row,
+	// then a last line holding the summary, or the error that ended the import.
+	Import(g *gin.Context)
+	// Export streams the matching subscriptions as an attachment.
+	Export(g *gin.Context)
+}
+
+type controller struct {
+	tracerOpsPrefix string
+	resource        *resource.Resource
+	app             *application.Application
+}
+
+// importEnd is the last line of an import response.
+type importEnd struct {
+	Summary bulk.Summary `json:"summary"`
+	Error   string       `json:"error,omitempty"`
+}
+
+func NewController(resource *resource.Resource, app *application.Application) Controller {
+	return &controller{
+		tracerOpsPrefix: "transport/http/controller/bulk/controller.go",
+		resource:        resource,
+		app:             app,
+	}
+}
+
+func (c *controller) Import(g *gin.Context) {
+	var req bulk.ImportRequest
+	if err := g.ShouldBindQuery(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+
+	encoder := json.NewEncoder(g.Writer)
+	summary, err := c.app.Bulk.Import(g.Request.Context(), g.Request.Body, req, func(result bulk.RowResult) error {
+		if !g.Writer.Written() {
+			g.Header("Content-Type", contentTypes[bulk.FormatJSONL])
+			g.Status(http.StatusOK)
+		}
+		return encoder.Encode(result)
+	})
+	// An error before the first row is answered like any other request.
+	if err != nil && !g.Writer.Written() {
+		response.Error(g, err)
+		return
+	}
+	if !g.Writer.Written() {
+		g.Header("Content-Type", contentTypes[bulk.FormatJSONL])
+		g.Status(http.StatusOK)
+	}
+	end := importEnd{Summary: summary}
+	if err != nil {
+		_ = g.Error(err)
+		end.Error = err.Error()
+	}
+	_ = encoder.Encode(end)
+}
+
+func (c *controller) Export(g *gin.Context) {
+	var req bulk.ExportRequest
+	if err := g.ShouldBindQuery(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	g.Header("Content-Type", contentTypes[req.Format])
+	g.Header("Content-Disposition", `attachment; filename="subscriptions.`+req.Format+`"`)
+	if _, err := c.app.Bulk.Export(g.Request.Context(), g.Writer, req); err != nil {
+		// Once rows went out the status is sent; the truncated body is all that is left.
+		if !g.Writer.Written() {
+			g.Header("Content-Type", "")
+			g.Header("Content-Disposition", "")
+			response.Error(g, err)
+			return
+		}
+		_ = g.Error(err)
+	}
+}
@@ -0,0 +1,99 @@
+package calendar
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"newdemo1/application"
+	"newdemo1/application/calendar"
+	"newdemo1/resource"
+	"newdemo1/transport/http/controller/response"
+)
+
+type Controller interface {
+	List(g *gin.Context)
+	Get(g *gin.Context)
+	Create(g *gin.Context)
+	Delete(g *gin.Context)
+	// SaveHoliday adds or renames the holiday on the date in the path.
+	SaveHoliday(g *gin.Context)
+	RemoveHoliday(g *gin.Context)
+}
+
+type controller struct {
+	tracerOpsPrefix string
+	resource        *resource.Resource
+	app             *application.Application
+}
+
+func NewController(resource *resource.Resource, app *application.Application) Controller {
+	return &controller{
+		tracerOpsPrefix: "transport/http/controller/calendar/controller.go",
+		resource:        resource,
+		app:             app,
+	}
+}
+
+func (c *controller) List(g *gin.Context) {
+	calendars, err := c.app.Calendar.List(g.Request.Context())
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, calendars)
+}
+
+func (c *controller) Get(g *gin.Context) {
+	cal, err := c.app.Calendar.Get(g.Request.Context(), g.Param("name"))
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, cal)
+}
+
+func (c *controller) Create(g *gin.Context) {
+	var req calendar.CreateRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	cal, err := c.app.Calendar.Create(g.Request.Context(), req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, cal)
+}
+
+func (c *controller) Delete(g *gin.Context) {
+	if err := c.app.Calendar.Delete(g.Request.Context(), g.Param("name")); err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, nil)
+}
+
+func (c *controller) SaveHoliday(g *gin.Context) {
+	// The body only names the holiday and may be left out.
+	var req calendar.HolidayRequest
+	if err := g.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.InvalidRequest(g, err)
+		return
+	}
+	cal, err := c.app.Calendar.SaveHoliday(g.Request.Context(), g.Param("name"), g.Param("date"), req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, cal)
+}
+
+func (c *controller) RemoveHoliday(g *gin.Context) {
+	cal, err := c.app.Calendar.RemoveHoliday(g.Request.Context(), g.Param("name"), g.Param("date"))
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, cal)
+}
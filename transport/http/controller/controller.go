@@ -3,15 +3,27 @@ package controller
 import (
 	"newdemo1/application"
 	"newdemo1/resource"
+	"newdemo1/transport/http/controller/bulk"
+	"newdemo1/transport/http/controller/calendar"
+	"newdemo1/transport/http/controller/deadletter"
+	"newdemo1/transport/http/controller/run"
 	"newdemo1/transport/http/controller/subscription"
 )
 
 type Controller struct {
 	Subscription subscription.Controller
+	DeadLetter   deadletter.Controller
+	Run          run.Controller
+	Calendar     calendar.Controller
+	Bulk         bulk.Controller
 }
 
 func NewController(resource *resource.Resource, app *application.Application) *Controller {
 	return &Controller{
 		Subscription: subscription.NewController(resource, app),
+		DeadLetter:   deadletter.NewController(resource, app),
+		Run:          run.NewController(resource, app),
+		Calendar:     calendar.NewController(resource, app),
+		Bulk:         bulk.NewController(resource, app),
 	}
 }
@@ -0,0 +1,100 @@
+package deadletter
+
+import (
+	"github.com/gin-gonic/gin"
+	"newdemo1/application"
+	"newdemo1/application/deadletter"
+	"newdemo1/resource"
+	"newdemo1/transport/http/controller/response"
+)
+
+type Controller interface {
+	List(g *gin.Context)
+	Get(g *gin.Context)
+	Redrive(g *gin.Context)
+	Delete(g *gin.Context)
+	Purge(g *gin.Context)
+}
+
+type controller struct {
+	tracerOpsPrefix string
+	resource        *resource.Resource
+	app             *application.Application
+}
+
+func NewController(resource *resource.Resource, app *application.Application) Controller {
+	return &controller{
+		tracerOpsPrefix: "transport/http/controller/deadletter/controller.go",
+		resource:        resource,
+		app:             app,
+	}
+}
+
+func (c *controller) List(g *gin.Context) {
+	var req deadletter.ListRequest
+	if err := g.ShouldBindQuery(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	deadLetters, total, err := c.app.DeadLetter.List(g.Request.Context(), req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, response.Page{Items: deadLetters, Total: total})
+}
+
+func (c *controller) Get(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	deadLetter, err := c.app.DeadLetter.Get(g.Request.Context(), id)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, deadLetter)
+}
+
+func (c *controller) Redrive(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	deadLetter, err := c.app.DeadLetter.Redrive(g.Request.Context(), id)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, deadLetter)
+}
+
+func (c *controller) Delete(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	if err := c.app.DeadLetter.Delete(g.Request.Context(), id); err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, nil)
+}
+
+func (c *controller) Purge(g *gin.Context) {
+	var req deadletter.PurgeRequest
+	if err := g.ShouldBindQuery(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	purged, err := c.app.DeadLetter.Purge(g.Request.Context(), req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, gin.H{"purged": purged})
+}
@@ -0,0 +1,71 @@
+package response
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"newdemo1/constant"
+	commonErr "newdemo1/resource/jaeger/common/error"
+	"strconv"
+)
+
+// Response is the envelope every HTTP endpoint answers with. The telemetry
+// middleware reads responseCode from it for the app_response_code metric tag.
+type Response struct {
+	ResponseCode    string      `json:"responseCode"`
+	ResponseMessage string      `json:"responseMessage"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+// Page wraps a page of a list endpoint.
+type Page struct {
+	Items interface{} `json:"items"`
+	Total int64       `json:"total"`
+}
+
+func Success(g *gin.Context, data interface{}) {
+	g.JSON(http.StatusOK, Response{
+		ResponseCode:    constant.Success.Code,
+		ResponseMessage: constant.Success.Message,
+		Data:            data,
+	})
+}
+
+// Error answers with the status mapped from the service error code; any other
+// error is reported as an internal error.
+func Error(g *gin.Context, err error) {
+	serviceErr := constant.InternalError
+	var target commonErr.ServiceError
+	if errors.As(err, &target) {
+		serviceErr = target
+	}
+	status, ok := constant.ServiceErrorCodeToHttpStatusCode[serviceErr.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	_ = g.Error(err)
+	g.JSON(status, Response{
+		ResponseCode:    serviceErr.Code,
+		ResponseMessage: serviceErr.Message,
+	})
+}
+
+// InvalidRequest reports a request that could not be bound.
+func InvalidRequest(g *gin.Context, err error) {
+	Error(g, commonErr.ServiceError{
+		Code:    constant.InvalidRequest.Code,
+		Message: err.Error(),
+	})
+}
+
+// ID parses the uint64 path parameter name.
+func ID(g *gin.Context, name string) (uint64, error) {
+	id, err := strconv.ParseUint(g.Param(name), 10, 64)
+	if err != nil {
+		return 0, commonErr.ServiceError{
+			Code:    constant.InvalidRequest.Code,
+			Message: "invalid " + name + ": " + g.Param(name),
+		}
+	}
+	return id, nil
+}
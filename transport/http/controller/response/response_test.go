@@ -0,0 +1,40 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"newdemo1/constant"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"not found", constant.SubscriptionNotFound, http.StatusNotFound, constant.SubscriptionNotFound.Code},
+		{"illegal transition", constant.IllegalTransition, http.StatusConflict, constant.IllegalTransition.Code},
+		{"plain error", errors.New("db down"), http.StatusInternalServerError, constant.InternalError.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			g, _ := gin.CreateTestContext(w)
+			Error(g, tt.err)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			var body Response
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.wantCode, body.ResponseCode)
+		})
+	}
+}
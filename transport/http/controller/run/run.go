@@ -0,0 +1,77 @@
+package run
+
+import (
+	"github.com/gin-gonic/gin"
+	"newdemo1/application"
+	"newdemo1/application/run"
+	"newdemo1/resource"
+	"newdemo1/transport/http/controller/response"
+)
+
+type Controller interface {
+	List(g *gin.Context)
+	Get(g *gin.Context)
+	// ListBySubscription lists the runs of the subscription in the path.
+	ListBySubscription(g *gin.Context)
+}
+
+type controller struct {
+	tracerOpsPrefix string
+	resource        *resource.Resource
+	app             *application.Application
+}
+
+func NewController(resource *resource.Resource, app *application.Application) Controller {
+	return &controller{
+		tracerOpsPrefix: "transport/http/controller/run/controller.go",
+		resource:        resource,
+		app:             app,
+	}
+}
+
+func (c *controller) List(g *gin.Context) {
+	var req run.ListRequest
+	if err := g.ShouldBindQuery(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	c.list(g, req)
+}
+
+func (c *controller) ListBySubscription(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	var req run.ListRequest
+	if err := g.ShouldBindQuery(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	req.SubscriptionID = id
+	c.list(g, req)
+}
+
+func (c *controller) Get(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	ledger, err := c.app.Ledger.Get(g.Request.Context(), id)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, ledger)
+}
+
+func (c *controller) list(g *gin.Context, req run.ListRequest) {
+	runs, total, err := c.app.Ledger.List(g.Request.Context(), req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, response.Page{Items: runs, Total: total})
+}
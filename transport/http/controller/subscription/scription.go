@@ -1,15 +1,34 @@
 package subscription
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"io"
 	"net/http"
 
 	"newdemo1/application"
+	"newdemo1/application/subscription"
+	"newdemo1/infrastructure/repository"
 	"newdemo1/resource"
+	"newdemo1/transport/http/controller/response"
 )
 
 type Controller interface {
 	Create(g *gin.Context)
+	Get(g *gin.Context)
+	List(g *gin.Context)
+	Update(g *gin.Context)
+	Pause(g *gin.Context)
+	Resume(g *gin.Context)
+	Cancel(g *gin.Context)
+	Transitions(g *gin.Context)
+	// Preview lists the next occurrences of the draft schedule in the body.
+	Preview(g *gin.Context)
+	Upcoming(g *gin.Context)
+	// ExportICS answers with the next occurrences as a text/calendar attachment.
+	ExportICS(g *gin.Context)
 }
 
 type controller struct {
@@ -19,7 +38,164 @@ type controller struct {
 }
 
 func (c *controller) Create(g *gin.Context) {
-	g.JSON(http.StatusOK, gin.H{"message": "success"})
+	var req subscription.CreateRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	sub, err := c.app.Subscription.Create(g.Request.Context(), req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, sub)
+}
+
+func (c *controller) Get(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	sub, err := c.app.Subscription.Get(g.Request.Context(), id)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, sub)
+}
+
+func (c *controller) List(g *gin.Context) {
+	var req subscription.ListRequest
+	if err := g.ShouldBindQuery(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	subs, total, err := c.app.Subscription.List(g.Request.Context(), req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, response.Page{Items: subs, Total: total})
+}
+
+func (c *controller) Update(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	var req subscription.UpdateRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	sub, err := c.app.Subscription.Update(g.Request.Context(), id, req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, sub)
+}
+
+func (c *controller) Pause(g *gin.Context) {
+	c.transition(g, c.app.Subscription.Pause)
+}
+
+func (c *controller) Resume(g *gin.Context) {
+	c.transition(g, c.app.Subscription.Resume)
+}
+
+func (c *controller) Cancel(g *gin.Context) {
+	c.transition(g, c.app.Subscription.Cancel)
+}
+
+func (c *controller) Transitions(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	transitions, err := c.app.Subscription.Transitions(g.Request.Context(), id)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, transitions)
+}
+
+func (c *controller) Preview(g *gin.Context) {
+	var req subscription.PreviewRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	preview, err := c.app.Subscription.Preview(g.Request.Context(), req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, preview)
+}
+
+func (c *controller) Upcoming(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	var req subscription.UpcomingRequest
+	if err := g.ShouldBindQuery(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	preview, err := c.app.Subscription.Upcoming(g.Request.Context(), id, req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, preview)
+}
+
+func (c *controller) ExportICS(g *gin.Context) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	var req subscription.UpcomingRequest
+	if err := g.ShouldBindQuery(&req); err != nil {
+		response.InvalidRequest(g, err)
+		return
+	}
+	ics, err := c.app.Subscription.ExportICS(g.Request.Context(), id, req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	g.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="subscription-%d.ics"`, id))
+	g.Data(http.StatusOK, "text/calendar; charset=utf-8", ics)
+}
+
+// transition serves the pause, resume and cancel actions, whose body with a reason is optional.
+func (c *controller) transition(g *gin.Context, action func(ctx context.Context, id uint64,
+	req subscription.TransitionRequest) (repository.Subscription, error)) {
+	id, err := response.ID(g, "id")
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	var req subscription.TransitionRequest
+	if err := g.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.InvalidRequest(g, err)
+		return
+	}
+	sub, err := action(g.Request.Context(), id, req)
+	if err != nil {
+		response.Error(g, err)
+		return
+	}
+	response.Success(g, sub)
 }
 
 func NewController(resource *resource.Resource, app *application.Application) Controller {
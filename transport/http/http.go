@@ -31,9 +31,47 @@ func (h *Http) Serve() error {
 		serviceName, _ := json.Marshal(h.resource.Config.Telemetry.Tracer.ServiceName)
 		_, _ = context.Writer.Write(serviceName)
 	})
-	subscription := g.Group("/subscription")
+	subscription := g.Group("/subscriptions")
 	{
-		subscription.GET("/:id", h.controller.Subscription.Create)
+		subscription.POST("", h.controller.Subscription.Create)
+		subscription.GET("", h.controller.Subscription.List)
+		subscription.POST("/preview", h.controller.Subscription.Preview)
+		subscription.GET("/:id", h.controller.Subscription.Get)
+		subscription.PATCH("/:id", h.controller.Subscription.Update)
+		subscription.POST("/:id/pause", h.controller.Subscription.Pause)
+		subscription.POST("/:id/resume", h.controller.Subscription.Resume)
+		subscription.POST("/:id/cancel", h.controller.Subscription.Cancel)
+		subscription.GET("/:id/transitions", h.controller.Subscription.Transitions)
+		subscription.GET("/:id/runs", h.controller.Run.ListBySubscription)
+		subscription.GET("/:id/upcoming", h.controller.Subscription.Upcoming)
+		subscription.GET("/:id/calendar.ics", h.controller.Subscription.ExportICS)
+	}
+	run := g.Group("/runs")
+	{
+		run.GET("", h.controller.Run.List)
+		run.GET("/:id", h.controller.Run.Get)
+	}
+	deadLetter := g.Group("/admin/dead-letters")
+	{
+		deadLetter.GET("", h.controller.DeadLetter.List)
+		deadLetter.DELETE("", h.controller.DeadLetter.Purge)
+		deadLetter.GET("/:id", h.controller.DeadLetter.Get)
+		deadLetter.DELETE("/:id", h.controller.DeadLetter.Delete)
+		deadLetter.POST("/:id/redrive", h.controller.DeadLetter.Redrive)
+	}
+	bulk := g.Group("/admin/subscriptions")
+	{
+		bulk.POST("/import", h.controller.Bulk.Import)
+		bulk.GET("/export", h.controller.Bulk.Export)
+	}
+	calendar := g.Group("/admin/calendars")
+	{
+		calendar.GET("", h.controller.Calendar.List)
+		calendar.POST("", h.controller.Calendar.Create)
+		calendar.GET("/:name", h.controller.Calendar.Get)
+		calendar.DELETE("/:name", h.controller.Calendar.Delete)
+		calendar.PUT("/:name/holidays/:date", h.controller.Calendar.SaveHoliday)
+		calendar.DELETE("/:name/holidays/:date", h.controller.Calendar.RemoveHoliday)
 	}
 	log.Println("[Recurring Service HTTP] server started. Listening on port ", h.resource.Config.Service.HttpPort)
 	return http.ListenAndServe(h.resource.Config.Service.HttpPort, commonHttp.NewHandler(
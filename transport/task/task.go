@@ -0,0 +1,50 @@
+package task
+
+import (
+	"context"
+	"log"
+	"newdemo1/application"
+	"newdemo1/resource"
+	"sync"
+)
+
+// Task runs the background loops of the application until stopped.
+type Task struct {
+	resource *resource.Resource
+	app      *application.Application
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewTask(resource *resource.Resource, app *application.Application) *Task {
+	return &Task{
+		resource: resource,
+		app:      app,
+	}
+}
+
+func (t *Task) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+
+	t.start(ctx, t.app.Scheduler.Run)
+	t.start(ctx, t.app.Outbox.Run)
+	t.start(ctx, t.app.Reconciler.Run)
+	t.start(ctx, t.app.Runs.Run)
+	log.Println("[Recurring Service Task] scheduler, outbox relay, run reconciler and run events started")
+}
+
+func (t *Task) Stop() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.wg.Wait()
+}
+
+func (t *Task) start(ctx context.Context, loop func(ctx context.Context)) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		loop(ctx)
+	}()
+}
@@ -2,37 +2,36 @@ package transport
 
 import (
 	"newdemo1/application"
-	"newdemo1/infrastructure/mq"
+	"newdemo1/infrastructure"
 	"newdemo1/resource"
+	"newdemo1/transport/consumer"
 	"newdemo1/transport/grpc"
 	"newdemo1/transport/http"
+	"newdemo1/transport/task"
+	"newdemo1/transport/xxl"
 )
 
 type Transport struct {
-	Grpc grpc.Grpc
-	Http http.Http
-	MQ   mq.PubSub
-	//Task task.Task
+	Grpc     grpc.Grpc
+	Http     http.Http
+	Consumer *consumer.Consumer
+	Task     *task.Task
+	Xxl      xxl.Xxl
 }
 
-func NewTransport(resource *resource.Resource, app *application.Application) (Transport, error) {
-	grpcTransport, err := grpc.NewGrpc(resource)
+func NewTransport(resource *resource.Resource, infra *infrastructure.Infrastructure, app *application.Application) (Transport, error) {
+	grpcTransport, err := grpc.NewGrpc(resource, app)
 	if err != nil {
 		return Transport{}, err
 	}
 
 	httpTransport := http.NewHttp(resource, app)
-	if err != nil {
-		return Transport{}, err
-	}
-	m, err := mq.NewMQ(resource)
-	if err != nil {
-		return Transport{}, err
-	}
 	return Transport{
-		Grpc: grpcTransport,
-		Http: httpTransport,
-		MQ:   m,
+		Grpc:     grpcTransport,
+		Http:     httpTransport,
+		Consumer: consumer.NewConsumer(resource, infra.MQ.PubSub(), app),
+		Task:     task.NewTask(resource, app),
+		Xxl:      xxl.NewXxl(resource, app),
 	}, nil
 }
 
@@ -41,12 +40,20 @@ func (t *Transport) Run() {
 		_ = t.Http.Serve()
 	}()
 
-	go t.MQ.PubSub()
+	t.Consumer.Run()
 
 	go t.Grpc.Serve()
 
+	go func() {
+		_ = t.Xxl.Serve()
+	}()
+
+	t.Task.Run()
 }
 
 func (t *Transport) Stop() {
+	_ = t.Xxl.Stop()
+	t.Task.Stop()
+	t.Consumer.Stop()
 	_ = t.Grpc.GracefulStop()
 }
@@ -0,0 +1,90 @@
+package xxl
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"time"
+)
+
+const (
+	accessTokenHeader = "XXL-JOB-ACCESS-TOKEN"
+	registryGroup     = "EXECUTOR"
+
+	codeSuccess = 200
+	codeFail    = 500
+	codeTimeout = 502
+)
+
+type (
+	// returnT is the envelope every XXL-Job endpoint answers with.
+	returnT struct {
+		Code    int         `json:"code"`
+		Msg     string      `json:"msg"`
+		Content interface{} `json:"content,omitempty"`
+	}
+	registryParam struct {
+		RegistryGroup string `json:"registryGroup"`
+		RegistryKey   string `json:"registryKey"`
+		RegistryValue string `json:"registryValue"`
+	}
+	callbackParam struct {
+		LogID      int64  `json:"logId"`
+		LogDateTim int64  `json:"logDateTim"`
+		HandleCode int    `json:"handleCode"`
+		HandleMsg  string `json:"handleMsg"`
+	}
+
+	// adminClient calls the admin's executor-facing API.
+	adminClient struct {
+		client *resty.Client
+	}
+)
+
+func newAdminClient(addr, accessToken string) *adminClient {
+	return &adminClient{
+		client: resty.New().
+			SetHostURL(addr).
+			SetHeader(accessTokenHeader, accessToken).
+			SetTimeout(3 * time.Second),
+	}
+}
+
+func (a *adminClient) registry(ctx context.Context, appName, address string) error {
+	return a.post(ctx, "/api/registry", registryParam{
+		RegistryGroup: registryGroup,
+		RegistryKey:   appName,
+		RegistryValue: address,
+	})
+}
+
+func (a *adminClient) registryRemove(ctx context.Context, appName, address string) error {
+	return a.post(ctx, "/api/registryRemove", registryParam{
+		RegistryGroup: registryGroup,
+		RegistryKey:   appName,
+		RegistryValue: address,
+	})
+}
+
+func (a *adminClient) callback(ctx context.Context, params []callbackParam) error {
+	return a.post(ctx, "/api/callback", params)
+}
+
+func (a *adminClient) post(ctx context.Context, path string, body interface{}) error {
+	var result returnT
+	res, err := a.client.R().
+		SetContext(ctx).
+		SetBody(body).
+		SetResult(&result).
+		Post(path)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return fmt.Errorf("xxl: %s returned http status %d", path, res.StatusCode())
+	}
+	if result.Code != codeSuccess {
+		return fmt.Errorf("xxl: %s returned code %d: %s", path, result.Code, result.Msg)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package xxl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultBeatInterval = 30 * time.Second
+
+type (
+	// Config describes how the executor reaches the admin and advertises itself.
+	Config struct {
+		AdminAddr   string
+		AccessToken string
+		AppName     string
+		// ListenAddr is the address the executor API is served on, e.g. ":9999".
+		ListenAddr string
+		// Address is registered with the admin. It defaults to http://<host ip>:<port>/.
+		Address      string
+		BeatInterval time.Duration
+	}
+
+	// Executor implements the XXL-Job executor protocol: it keeps itself
+	// registered with the admin, serves beat, idleBeat, run, kill and log, and
+	// reports every trigger result through the admin callback.
+	Executor struct {
+		cfg      Config
+		admin    *adminClient
+		logs     *logStore
+		server   *http.Server
+		listener net.Listener
+
+		mu       sync.Mutex
+		handlers map[string]Handler
+		jobs     map[int64]*jobThread
+
+		stop chan struct{}
+		wg   sync.WaitGroup
+	}
+
+	jobIDParam struct {
+		JobID int64 `json:"jobId"`
+	}
+	logParam struct {
+		LogDateTim  int64 `json:"logDateTim"`
+		LogID       int64 `json:"logId"`
+		FromLineNum int   `json:"fromLineNum"`
+	}
+	logResult struct {
+		FromLineNum int    `json:"fromLineNum"`
+		ToLineNum   int    `json:"toLineNum"`
+		LogContent  string `json:"logContent"`
+		IsEnd       bool   `json:"isEnd"`
+	}
+)
+
+func NewExecutor(cfg Config) *Executor {
+	if cfg.BeatInterval <= 0 {
+		cfg.BeatInterval = defaultBeatInterval
+	}
+	e := &Executor{
+		cfg:      cfg,
+		admin:    newAdminClient(cfg.AdminAddr, cfg.AccessToken),
+		logs:     newLogStore(),
+		handlers: make(map[string]Handler),
+		jobs:     make(map[int64]*jobThread),
+		stop:     make(chan struct{}),
+	}
+	e.server = &http.Server{Handler: e.Handler()}
+	return e
+}
+
+// Register binds a handler to the JobHandler name configured in the admin.
+func (e *Executor) Register(name string, handler Handler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers[name] = handler
+}
+
+// Handler returns the executor API.
+func (e *Executor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/beat", e.authorize(e.beat))
+	mux.HandleFunc("/idleBeat", e.authorize(e.idleBeat))
+	mux.HandleFunc("/run", e.authorize(e.run))
+	mux.HandleFunc("/kill", e.authorize(e.kill))
+	mux.HandleFunc("/log", e.authorize(e.log))
+	return mux
+}
+
+// Start listens on ListenAddr and begins the registry heartbeat.
+func (e *Executor) Start() error {
+	listener, err := net.Listen("tcp", e.cfg.ListenAddr)
+	if err != nil {
+		return err
+	}
+	e.listener = listener
+	if e.cfg.Address == "" {
+		e.cfg.Address = advertisedAddress(listener.Addr())
+	}
+
+	e.wg.Add(1)
+	go e.heartbeat()
+	return nil
+}
+
+// Serve serves the executor API on the listener opened by Start.
+func (e *Executor) Serve() error {
+	err := e.server.Serve(e.listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Stop deregisters from the admin, kills running jobs and shuts the API down.
+func (e *Executor) Stop(ctx context.Context) error {
+	close(e.stop)
+	e.wg.Wait()
+
+	e.mu.Lock()
+	jobs := e.jobs
+	e.jobs = make(map[int64]*jobThread)
+	e.mu.Unlock()
+	for _, job := range jobs {
+		job.kill()
+	}
+	return e.server.Shutdown(ctx)
+}
+
+func (e *Executor) heartbeat() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.cfg.BeatInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), e.cfg.BeatInterval)
+		if err := e.admin.registry(ctx, e.cfg.AppName, e.cfg.Address); err != nil {
+			log.Println("[Recurring Service XXL] registry failed:", err)
+		}
+		cancel()
+
+		select {
+		case <-e.stop:
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			if err := e.admin.registryRemove(ctx, e.cfg.AppName, e.cfg.Address); err != nil {
+				log.Println("[Recurring Service XXL] registry remove failed:", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Executor) authorize(next func(r *http.Request) returnT) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result := returnT{Code: codeFail, Msg: "invalid request, HttpMethod not support."}
+		switch {
+		case r.Method != http.MethodPost:
+		case e.cfg.AccessToken != "" && r.Header.Get(accessTokenHeader) != e.cfg.AccessToken:
+			result.Msg = "The access token is wrong."
+		default:
+			result = next(r)
+		}
+		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+func (e *Executor) beat(*http.Request) returnT {
+	return returnT{Code: codeSuccess}
+}
+
+func (e *Executor) idleBeat(r *http.Request) returnT {
+	var param jobIDParam
+	if err := json.NewDecoder(r.Body).Decode(&param); err != nil {
+		return returnT{Code: codeFail, Msg: err.Error()}
+	}
+
+	e.mu.Lock()
+	job, ok := e.jobs[param.JobID]
+	e.mu.Unlock()
+	if ok && job.busy() {
+		return returnT{Code: codeFail, Msg: "job thread is running or has trigger queue."}
+	}
+	return returnT{Code: codeSuccess}
+}
+
+func (e *Executor) run(r *http.Request) returnT {
+	var param TriggerParam
+	if err := json.NewDecoder(r.Body).Decode(&param); err != nil {
+		return returnT{Code: codeFail, Msg: err.Error()}
+	}
+	if param.GlueType != "" && param.GlueType != glueTypeBean {
+		return returnT{Code: codeFail, Msg: fmt.Sprintf("glueType[%s] is not supported.", param.GlueType)}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	handler, ok := e.handlers[param.ExecutorHandler]
+	if !ok {
+		return returnT{Code: codeFail, Msg: fmt.Sprintf("job handler [%s] not found.", param.ExecutorHandler)}
+	}
+
+	job, exists := e.jobs[param.JobID]
+	if exists && job.name != param.ExecutorHandler {
+		go job.kill()
+		exists = false
+	}
+	if exists && job.busy() {
+		switch param.ExecutorBlockStrategy {
+		case blockDiscardLater:
+			return returnT{Code: codeFail, Msg: "block strategy effect：" + blockDiscardLater}
+		case blockCoverEarly:
+			go job.kill()
+			exists = false
+		}
+	}
+	if !exists {
+		job = newJobThread(param.JobID, param.ExecutorHandler, handler, e.logs, e.callback)
+		e.jobs[param.JobID] = job
+	}
+	if !job.push(&param) {
+		return returnT{Code: codeFail, Msg: "trigger queue is full."}
+	}
+	return returnT{Code: codeSuccess}
+}
+
+func (e *Executor) kill(r *http.Request) returnT {
+	var param jobIDParam
+	if err := json.NewDecoder(r.Body).Decode(&param); err != nil {
+		return returnT{Code: codeFail, Msg: err.Error()}
+	}
+
+	e.mu.Lock()
+	job, ok := e.jobs[param.JobID]
+	delete(e.jobs, param.JobID)
+	e.mu.Unlock()
+	if !ok {
+		return returnT{Code: codeSuccess, Msg: "job thread already killed."}
+	}
+	job.kill()
+	return returnT{Code: codeSuccess}
+}
+
+func (e *Executor) log(r *http.Request) returnT {
+	var param logParam
+	if err := json.NewDecoder(r.Body).Decode(&param); err != nil {
+		return returnT{Code: codeFail, Msg: err.Error()}
+	}
+	content, toLine, end := e.logs.read(param.LogID, param.FromLineNum)
+	return returnT{Code: codeSuccess, Content: logResult{
+		FromLineNum: param.FromLineNum,
+		ToLineNum:   toLine,
+		LogContent:  content,
+		IsEnd:       end,
+	}}
+}
+
+func (e *Executor) callback(param *TriggerParam, code int, msg string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := e.admin.callback(ctx, []callbackParam{{
+		LogID:      param.LogID,
+		LogDateTim: param.LogDateTime,
+		HandleCode: code,
+		HandleMsg:  msg,
+	}})
+	if err != nil {
+		log.Println("[Recurring Service XXL] callback failed for log", param.LogID, err)
+	}
+}
+
+func advertisedAddress(addr net.Addr) string {
+	_, port, _ := net.SplitHostPort(addr.String())
+	host := "127.0.0.1"
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+				host = ipNet.IP.String()
+				break
+			}
+		}
+	}
+	return fmt.Sprintf("http://%s/", net.JoinHostPort(host, port))
+}
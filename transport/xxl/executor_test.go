@@ -0,0 +1,268 @@
+package xxl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "secret"
+
+// fakeAdmin records what the executor sends to the admin API.
+type fakeAdmin struct {
+	server         *httptest.Server
+	registry       chan registryParam
+	registryRemove chan registryParam
+	callback       chan callbackParam
+}
+
+func newFakeAdmin(t *testing.T) *fakeAdmin {
+	a := &fakeAdmin{
+		registry:       make(chan registryParam, 16),
+		registryRemove: make(chan registryParam, 16),
+		callback:       make(chan callbackParam, 16),
+	}
+	a.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get(accessTokenHeader) != testToken {
+			_ = json.NewEncoder(w).Encode(returnT{Code: codeFail, Msg: "The access token is wrong."})
+			return
+		}
+		switch r.URL.Path {
+		case "/api/registry", "/api/registryRemove":
+			var param registryParam
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&param))
+			if r.URL.Path == "/api/registry" {
+				a.registry <- param
+			} else {
+				a.registryRemove <- param
+			}
+		case "/api/callback":
+			var params []callbackParam
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+			for _, p := range params {
+				a.callback <- p
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(returnT{Code: codeSuccess})
+	}))
+	t.Cleanup(a.server.Close)
+	return a
+}
+
+func (a *fakeAdmin) nextCallback(t *testing.T) callbackParam {
+	select {
+	case p := <-a.callback:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("no callback received")
+		return callbackParam{}
+	}
+}
+
+func newTestExecutor(t *testing.T, admin *fakeAdmin) (*Executor, *httptest.Server) {
+	e := NewExecutor(Config{
+		AdminAddr:   admin.server.URL,
+		AccessToken: testToken,
+		AppName:     "recurring-executor",
+		ListenAddr:  "127.0.0.1:0",
+	})
+	server := httptest.NewServer(e.Handler())
+	t.Cleanup(server.Close)
+	return e, server
+}
+
+func call(t *testing.T, server *httptest.Server, path, token string, body interface{}) returnT {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewReader(data))
+	require.NoError(t, err)
+	req.Header.Set(accessTokenHeader, token)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var result returnT
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	return result
+}
+
+func TestExecutorRegistry(t *testing.T) {
+	admin := newFakeAdmin(t)
+	e := NewExecutor(Config{
+		AdminAddr:    admin.server.URL,
+		AccessToken:  testToken,
+		AppName:      "recurring-executor",
+		ListenAddr:   "127.0.0.1:0",
+		Address:      "http://10.0.0.1:9999/",
+		BeatInterval: 20 * time.Millisecond,
+	})
+	require.NoError(t, e.Start())
+	go func() { _ = e.Serve() }()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-admin.registry:
+			assert.Equal(t, registryParam{RegistryGroup: "EXECUTOR", RegistryKey: "recurring-executor",
+				RegistryValue: "http://10.0.0.1:9999/"}, p)
+		case <-time.After(5 * time.Second):
+			t.Fatal("executor did not heartbeat")
+		}
+	}
+
+	require.NoError(t, e.Stop(context.Background()))
+	select {
+	case p := <-admin.registryRemove:
+		assert.Equal(t, "recurring-executor", p.RegistryKey)
+	case <-time.After(5 * time.Second):
+		t.Fatal("executor did not deregister")
+	}
+}
+
+func TestExecutorRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  Handler
+		timeout  int64
+		wantCode int
+		wantMsg  string
+	}{
+		{
+			name:     "success",
+			handler:  func(ctx context.Context, param *TriggerParam) error { return nil },
+			wantCode: codeSuccess,
+		},
+		{
+			name:     "failure",
+			handler:  func(ctx context.Context, param *TriggerParam) error { return errors.New("boom") },
+			wantCode: codeFail,
+			wantMsg:  "boom",
+		},
+		{
+			name:     "panic",
+			handler:  func(ctx context.Context, param *TriggerParam) error { panic("oops") },
+			wantCode: codeFail,
+			wantMsg:  "job panic: oops",
+		},
+		{
+			name: "timeout",
+			handler: func(ctx context.Context, param *TriggerParam) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			timeout:  1,
+			wantCode: codeTimeout,
+			wantMsg:  "job timeout",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := newFakeAdmin(t)
+			e, server := newTestExecutor(t, admin)
+			e.Register("job", tt.handler)
+
+			result := call(t, server, "/run", testToken, TriggerParam{
+				JobID:           int64(i + 1),
+				ExecutorHandler: "job",
+				ExecutorTimeout: tt.timeout,
+				LogID:           int64(100 + i),
+				LogDateTime:     1700000000000,
+				GlueType:        glueTypeBean,
+			})
+			assert.Equal(t, codeSuccess, result.Code)
+
+			cb := admin.nextCallback(t)
+			assert.Equal(t, int64(100+i), cb.LogID)
+			assert.Equal(t, int64(1700000000000), cb.LogDateTim)
+			assert.Equal(t, tt.wantCode, cb.HandleCode)
+			assert.Equal(t, tt.wantMsg, cb.HandleMsg)
+		})
+	}
+}
+
+func TestExecutorRejects(t *testing.T) {
+	admin := newFakeAdmin(t)
+	_, server := newTestExecutor(t, admin)
+
+	result := call(t, server, "/beat", "wrong", struct{}{})
+	assert.Equal(t, codeFail, result.Code)
+	assert.Equal(t, "The access token is wrong.", result.Msg)
+
+	result = call(t, server, "/beat", testToken, struct{}{})
+	assert.Equal(t, codeSuccess, result.Code)
+
+	result = call(t, server, "/run", testToken, TriggerParam{JobID: 1, ExecutorHandler: "missing"})
+	assert.Equal(t, codeFail, result.Code)
+
+	result = call(t, server, "/run", testToken, TriggerParam{JobID: 1, ExecutorHandler: "job", GlueType: "GLUE_SHELL"})
+	assert.Equal(t, codeFail, result.Code)
+}
+
+func TestExecutorKillAndIdleBeat(t *testing.T) {
+	admin := newFakeAdmin(t)
+	e, server := newTestExecutor(t, admin)
+	started := make(chan struct{})
+	e.Register("block", func(ctx context.Context, param *TriggerParam) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	result := call(t, server, "/run", testToken, TriggerParam{JobID: 7, ExecutorHandler: "block", LogID: 1})
+	require.Equal(t, codeSuccess, result.Code)
+	<-started
+
+	result = call(t, server, "/idleBeat", testToken, jobIDParam{JobID: 7})
+	assert.Equal(t, codeFail, result.Code)
+
+	result = call(t, server, "/run", testToken, TriggerParam{JobID: 7, ExecutorHandler: "block", LogID: 2,
+		ExecutorBlockStrategy: blockDiscardLater})
+	assert.Equal(t, codeFail, result.Code)
+
+	result = call(t, server, "/kill", testToken, jobIDParam{JobID: 7})
+	assert.Equal(t, codeSuccess, result.Code)
+
+	cb := admin.nextCallback(t)
+	assert.Equal(t, int64(1), cb.LogID)
+	assert.Equal(t, codeFail, cb.HandleCode)
+	assert.Equal(t, "job killed", cb.HandleMsg)
+
+	result = call(t, server, "/idleBeat", testToken, jobIDParam{JobID: 7})
+	assert.Equal(t, codeSuccess, result.Code)
+}
+
+func TestExecutorLog(t *testing.T) {
+	admin := newFakeAdmin(t)
+	e, server := newTestExecutor(t, admin)
+	e.Register("chatty", func(ctx context.Context, param *TriggerParam) error {
+		Log(ctx, "processing %s", param.ExecutorParams)
+		return nil
+	})
+
+	result := call(t, server, "/run", testToken, TriggerParam{JobID: 3, ExecutorHandler: "chatty",
+		ExecutorParams: "batch-1", LogID: 42})
+	require.Equal(t, codeSuccess, result.Code)
+	admin.nextCallback(t)
+
+	result = call(t, server, "/log", testToken, logParam{LogID: 42, FromLineNum: 1})
+	require.Equal(t, codeSuccess, result.Code)
+
+	content, ok := result.Content.(map[string]interface{})
+	require.True(t, ok)
+	assert.Contains(t, content["logContent"], "processing batch-1")
+	assert.Equal(t, true, content["isEnd"])
+	assert.Equal(t, float64(3), content["toLineNum"])
+}
@@ -0,0 +1,264 @@
+package xxl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	blockSerial       = "SERIAL_EXECUTION"
+	blockDiscardLater = "DISCARD_LATER"
+	blockCoverEarly   = "COVER_EARLY"
+
+	glueTypeBean = "BEAN"
+
+	maxLogs    = 1000
+	queueDepth = 64
+)
+
+var errKilled = errors.New("job killed")
+
+type (
+	// TriggerParam is the payload the admin sends to /run.
+	TriggerParam struct {
+		JobID                 int64  `json:"jobId"`
+		ExecutorHandler       string `json:"executorHandler"`
+		ExecutorParams        string `json:"executorParams"`
+		ExecutorBlockStrategy string `json:"executorBlockStrategy"`
+		ExecutorTimeout       int64  `json:"executorTimeout"`
+		LogID                 int64  `json:"logId"`
+		LogDateTime           int64  `json:"logDateTime"`
+		GlueType              string `json:"glueType"`
+		GlueSource            string `json:"glueSource"`
+		GlueUpdatetime        int64  `json:"glueUpdatetime"`
+		BroadcastIndex        int64  `json:"broadcastIndex"`
+		BroadcastTotal        int64  `json:"broadcastTotal"`
+	}
+
+	// Handler runs one trigger of a job. A returned error is reported to the admin as a failure.
+	Handler func(ctx context.Context, param *TriggerParam) error
+
+	// jobThread executes the triggers of one job id one at a time, like the
+	// JobThread of the reference executor.
+	jobThread struct {
+		id       int64
+		name     string
+		handler  Handler
+		queue    chan *TriggerParam
+		stop     chan struct{}
+		done     chan struct{}
+		mu       sync.Mutex
+		running  bool
+		killed   bool
+		cancel   context.CancelFunc
+		finished func(param *TriggerParam, code int, msg string)
+		logs     *logStore
+	}
+
+	logKey struct{}
+
+	jobLog struct {
+		mu    sync.Mutex
+		lines []string
+		done  bool
+	}
+	logStore struct {
+		mu    sync.Mutex
+		logs  map[int64]*jobLog
+		order []int64
+	}
+)
+
+func newJobThread(id int64, name string, handler Handler, logs *logStore,
+	finished func(param *TriggerParam, code int, msg string)) *jobThread {
+	j := &jobThread{
+		id:       id,
+		name:     name,
+		handler:  handler,
+		queue:    make(chan *TriggerParam, queueDepth),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		finished: finished,
+		logs:     logs,
+	}
+	go j.loop()
+	return j
+}
+
+func (j *jobThread) loop() {
+	defer close(j.done)
+	for {
+		select {
+		case <-j.stop:
+			j.drain()
+			return
+		case param := <-j.queue:
+			j.execute(param)
+		}
+	}
+}
+
+// push queues a trigger; it reports false when the queue is full.
+func (j *jobThread) push(param *TriggerParam) bool {
+	select {
+	case j.queue <- param:
+		return true
+	default:
+		return false
+	}
+}
+
+func (j *jobThread) busy() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.running || len(j.queue) > 0
+}
+
+// kill cancels the running trigger, fails the queued ones and ends the thread.
+func (j *jobThread) kill() {
+	j.mu.Lock()
+	j.killed = true
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.mu.Unlock()
+
+	select {
+	case <-j.stop:
+	default:
+		close(j.stop)
+	}
+	<-j.done
+}
+
+func (j *jobThread) drain() {
+	for {
+		select {
+		case param := <-j.queue:
+			j.finished(param, codeFail, errKilled.Error())
+		default:
+			return
+		}
+	}
+}
+
+func (j *jobThread) execute(param *TriggerParam) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if param.ExecutorTimeout > 0 {
+		var timeoutCancel context.CancelFunc
+		ctx, timeoutCancel = context.WithTimeout(ctx, time.Duration(param.ExecutorTimeout)*time.Second)
+		defer timeoutCancel()
+	}
+	ctx = context.WithValue(ctx, logKey{}, j.logs.open(param.LogID))
+
+	j.mu.Lock()
+	j.running = true
+	j.cancel = cancel
+	j.mu.Unlock()
+
+	Log(ctx, "job %s started, params: %s", j.name, param.ExecutorParams)
+	err := j.invoke(ctx, param)
+
+	j.mu.Lock()
+	j.running = false
+	j.cancel = nil
+	killed := j.killed
+	j.mu.Unlock()
+
+	code, msg := codeSuccess, ""
+	switch {
+	case killed:
+		code, msg = codeFail, errKilled.Error()
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		code, msg = codeTimeout, "job timeout"
+	case err != nil:
+		code, msg = codeFail, err.Error()
+	}
+	Log(ctx, "job %s finished with code %d %s", j.name, code, msg)
+	j.logs.close(param.LogID)
+	j.finished(param, code, msg)
+}
+
+func (j *jobThread) invoke(ctx context.Context, param *TriggerParam) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Println("[Recurring Service XXL] job panic", j.name, p)
+			err = fmt.Errorf("job panic: %v", p)
+		}
+	}()
+	return j.handler(ctx, param)
+}
+
+// Log appends a line to the XXL-Job log of the trigger running in ctx, which
+// the admin reads back through /log.
+func Log(ctx context.Context, format string, args ...interface{}) {
+	l, ok := ctx.Value(logKey{}).(*jobLog)
+	if !ok {
+		return
+	}
+	line := time.Now().Format("2006-01-02 15:04:05") + " " + fmt.Sprintf(format, args...)
+	l.append(line)
+}
+
+func (l *jobLog) append(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, line)
+}
+
+func newLogStore() *logStore {
+	return &logStore{logs: make(map[int64]*jobLog)}
+}
+
+func (s *logStore) open(id int64) *jobLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.logs[id]; ok {
+		return l
+	}
+	l := &jobLog{}
+	s.logs[id] = l
+	s.order = append(s.order, id)
+	if len(s.order) > maxLogs {
+		delete(s.logs, s.order[0])
+		s.order = s.order[1:]
+	}
+	return l
+}
+
+func (s *logStore) close(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.logs[id]; ok {
+		l.mu.Lock()
+		l.done = true
+		l.mu.Unlock()
+	}
+}
+
+// read returns the lines from fromLine (1-based) onwards.
+func (s *logStore) read(id int64, fromLine int) (content string, toLine int, end bool) {
+	s.mu.Lock()
+	l, ok := s.logs[id]
+	s.mu.Unlock()
+	if !ok {
+		return "", fromLine, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if fromLine < 1 {
+		fromLine = 1
+	}
+	if fromLine > len(l.lines) {
+		return "", fromLine - 1, l.done
+	}
+	return strings.Join(l.lines[fromLine-1:], "\n"), len(l.lines), l.done
+}
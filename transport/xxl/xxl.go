@@ -0,0 +1,65 @@
+package xxl
+
+import (
+	"context"
+	"log"
+	"newdemo1/application"
+	"newdemo1/resource"
+)
+
+// SchedulerJob runs one scheduler tick, letting the admin drive scheduling
+// instead of (or in addition to) the in-process loop.
+const SchedulerJob = "recurringScheduler"
+
+// ReconcilerJob runs one reconciliation of stuck runs.
+const ReconcilerJob = "recurringReconciler"
+
+type Xxl struct {
+	resource *resource.Resource
+	executor *Executor
+}
+
+func NewXxl(resource *resource.Resource, app *application.Application) Xxl {
+	cfg := resource.Credential.Xxl
+	executor := NewExecutor(Config{
+		AdminAddr:   cfg.ServerAddr,
+		AccessToken: cfg.AccessToken,
+		AppName:     cfg.ExecutorName,
+		ListenAddr:  ":" + cfg.ExecutorPort,
+		Address:     cfg.ExecutorAddress,
+	})
+	executor.Register(SchedulerJob, func(ctx context.Context, param *TriggerParam) error {
+		return app.Scheduler.Tick(ctx)
+	})
+	executor.Register(ReconcilerJob, func(ctx context.Context, param *TriggerParam) error {
+		return app.Reconciler.Reconcile(ctx)
+	})
+
+	return Xxl{
+		resource: resource,
+		executor: executor,
+	}
+}
+
+func (x *Xxl) enabled() bool {
+	return x.resource.Credential.Xxl.ServerAddr != ""
+}
+
+func (x *Xxl) Serve() error {
+	if !x.enabled() {
+		return nil
+	}
+	if err := x.executor.Start(); err != nil {
+		log.Println("[Recurring Service XXL] executor failed to start:", err)
+		return err
+	}
+	log.Println("[Recurring Service XXL] executor started. Listening on port ", x.resource.Credential.Xxl.ExecutorPort)
+	return x.executor.Serve()
+}
+
+func (x *Xxl) Stop() error {
+	if !x.enabled() {
+		return nil
+	}
+	return x.executor.Stop(context.Background())
+}